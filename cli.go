@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"goauthx/internal/command"
+	"goauthx/internal/rbac"
+	"io"
+	"os"
+	"strings"
+)
+
+// 退出码：命令执行失败为 1，参数错误为 2
+const (
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+// commandResult --json 模式下每条命令输出一个 JSON 对象（脚本模式下每行一个）
+type commandResult struct {
+	Command string `json:"command"`
+	Line    int    `json:"line,omitempty"`
+	OK      bool   `json:"ok"`
+	Output  string `json:"output"`
+	Error   string `json:"error,omitempty"`
+}
+
+// batch 非交互模式下执行命令，不启动 HTTP 服务
+type batch struct {
+	json bool
+	out  io.Writer
+	errs io.Writer
+}
+
+// prepare 初始化命令依赖的内置角色与权限，便于在全新的数据库上执行 role assign 等命令
+func (b *batch) prepare() bool {
+	if err := rbac.EnsureDefaults(); err != nil {
+		b.report(commandResult{Error: fmt.Sprintf("init roles and permissions: %v", err)})
+		return false
+	}
+	return true
+}
+
+// execute 执行一条命令，line 为脚本中的行号，单条命令时为 0
+func (b *batch) execute(input string, line int) bool {
+	if !b.json {
+		if err := command.Run(input, b.out); err != nil {
+			b.report(commandResult{Command: input, Line: line, Error: err.Error()})
+			return false
+		}
+		return true
+	}
+	var output bytes.Buffer
+	err := command.Run(input, &output)
+	res := commandResult{Command: input, Line: line, OK: err == nil, Output: output.String()}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	b.report(res)
+	return err == nil
+}
+
+// report 输出 --json 结果或错误信息
+func (b *batch) report(res commandResult) {
+	if b.json {
+		_ = json.NewEncoder(b.out).Encode(res)
+		return
+	}
+	if res.Error == "" {
+		return
+	}
+	if res.Line > 0 {
+		fmt.Fprintf(b.errs, "line %d: %s: %s\n", res.Line, res.Command, res.Error)
+		return
+	}
+	fmt.Fprintln(b.errs, "error:", res.Error)
+}
+
+// runExec 执行一条命令：goauthx exec [--json] <command line>
+// 命令可以作为一个参数整体传入，也可以拆成多个参数
+func runExec(args []string) int {
+	fs := flag.NewFlagSet("exec", flag.ContinueOnError)
+	jsonOut := fs.Bool("json", false, "print the result as a JSON object")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, `usage: goauthx exec [--json] "<command>"`)
+		return exitUsage
+	}
+	input := fs.Arg(0)
+	if fs.NArg() > 1 {
+		input = command.QuoteArgs(fs.Args())
+	}
+	b := &batch{json: *jsonOut, out: os.Stdout, errs: os.Stderr}
+	if !b.prepare() || !b.execute(input, 0) {
+		return exitFailure
+	}
+	return 0
+}
+
+// runScript 逐行执行脚本中的命令：goauthx run [--json] [--keep-going] <script|->
+// 忽略空行与 # 开头的注释，默认遇到第一个错误即停止
+func runScript(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	jsonOut := fs.Bool("json", false, "print one JSON object per command")
+	keepGoing := fs.Bool("keep-going", false, "continue after a failed command")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: goauthx run [--json] [--keep-going] <script|->")
+		return exitUsage
+	}
+	var in io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return exitFailure
+		}
+		defer f.Close()
+		in = f
+	}
+
+	b := &batch{json: *jsonOut, out: os.Stdout, errs: os.Stderr}
+	if !b.prepare() {
+		return exitFailure
+	}
+	status := 0
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		input := strings.TrimSpace(scanner.Text())
+		if input == "" || strings.HasPrefix(input, "#") {
+			continue
+		}
+		if !b.execute(input, line) {
+			status = exitFailure
+			if !*keepGoing {
+				break
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	return status
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, `Usage:
+  goauthx [serve]                                     start the HTTP server with the console
+  goauthx exec [--json] "<command>"                   run one console command and exit
+  goauthx run [--json] [--keep-going] <script|->      run console commands from a file, one per line
+  goauthx ctl [-socket path] [command...]             connect to the console of a running server
+
+Run "goauthx exec help" to list the console commands.
+`)
+}
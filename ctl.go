@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"goauthx/internal/command"
+	"goauthx/internal/config"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"strings"
+)
+
+// runCtl 连接正在运行的服务的远程控制台，返回进程退出码
+// 用法：goauthx ctl [-socket path] [command...]
+// 不带命令时，终端中进入交互模式，否则逐行执行标准输入中的命令
+func runCtl(args []string) int {
+	fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	socket := fs.String("socket", defaultSocketPath(), "remote console socket path")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	client, err := command.Dial(*socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "connect to %s: %v\n", *socket, err)
+		return 1
+	}
+	defer client.Close()
+
+	if fs.NArg() > 0 {
+		if err := client.Execute(command.QuoteArgs(fs.Args()), os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		err := command.RunTerminal(os.Stdin, os.Stdout, client.Execute)
+		if err != nil && !errors.Is(err, io.EOF) {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		return 0
+	}
+
+	status := 0
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		input := strings.TrimSpace(scanner.Text())
+		if input == "" || strings.HasPrefix(input, "#") {
+			continue
+		}
+		if err := client.Execute(input, os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			// 连接断开时不再继续
+			if !errors.Is(err, command.ErrRemoteCommand) {
+				return 1
+			}
+			status = 1
+		}
+	}
+	return status
+}
+
+// defaultSocketPath 使用当前目录 config.json 中的套接字路径，没有配置文件时使用默认值
+// 不调用 config.GetConfig，避免在当前目录生成 config.json
+func defaultSocketPath() string {
+	if _, err := os.Stat("config.json"); err == nil {
+		if path := config.GetConfig().Console.SocketPath; path != "" {
+			return path
+		}
+	}
+	return config.DefaultConfig().Console.SocketPath
+}
@@ -0,0 +1,241 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"goauthx/internal/db"
+	"goauthx/internal/rbac"
+	"goauthx/internal/web/account/jwts"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MaxPageSize 管理接口分页的最大条数
+const MaxPageSize = 100
+
+// UserFilter 管理接口查询用户的条件，Username、Email 为不区分大小写的子串匹配
+type UserFilter struct {
+	Username      string
+	Email         string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Page          int
+	PageSize      int
+}
+
+// ListUsers 按条件分页查询用户，按用户ID升序，返回当前页与总数
+func ListUsers(f UserFilter) ([]UserDoc, int64, error) {
+	if f.Page < 1 {
+		f.Page = 1
+	}
+	if f.PageSize < 1 || f.PageSize > MaxPageSize {
+		f.PageSize = MaxPageSize
+	}
+	filter := bson.M{}
+	if f.Username != "" {
+		filter["username"] = bson.M{"$regex": regexp.QuoteMeta(f.Username), "$options": "i"}
+	}
+	if f.Email != "" {
+		filter["email"] = bson.M{"$regex": regexp.QuoteMeta(f.Email), "$options": "i"}
+	}
+	created := bson.M{}
+	if f.CreatedAfter != nil {
+		created["$gte"] = *f.CreatedAfter
+	}
+	if f.CreatedBefore != nil {
+		created["$lt"] = *f.CreatedBefore
+	}
+	if len(created) > 0 {
+		filter["created_at"] = created
+	}
+
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return nil, 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	coll := conn.DB.Collection("users")
+	total, err := coll.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "_id", Value: 1}}).
+		SetSkip(int64((f.Page - 1) * f.PageSize)).
+		SetLimit(int64(f.PageSize))
+	cursor, err := coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	users := make([]UserDoc, 0)
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+// ActiveBans 批量查询用户当前生效的封禁，key 为用户ID
+func ActiveBans(userIDs []int) (map[int]*UserBan, error) {
+	bans := make(map[int]*UserBan)
+	if len(userIDs) == 0 {
+		return bans, nil
+	}
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	filter := activeBanFilter()
+	filter["user_id"] = bson.M{"$in": userIDs}
+	cursor, err := conn.DB.Collection("users_bans").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "ban_start_time", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var list []UserBan
+	if err := cursor.All(ctx, &list); err != nil {
+		return nil, err
+	}
+	// 同一用户有多条时保留最新的一条，与 IsUserBanned 一致
+	for i := range list {
+		bans[list[i].UserID] = &list[i]
+	}
+	return bans, nil
+}
+
+// UpdateUserRequest 管理员修改用户资料，字段为 nil 表示不修改
+type UpdateUserRequest struct {
+	Username *string `json:"username"`
+	Email    *string `json:"email"`
+	Password *string `json:"password"`
+	// EmailVerified 直接设置邮箱验证状态，不修改时修改邮箱会使其变为未验证
+	EmailVerified *bool `json:"email_verified"`
+}
+
+type UpdateUserResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	// EmailChanged 邮箱已修改且需要重新验证，由调用方决定是否发送验证邮件
+	EmailChanged bool `json:"-"`
+}
+
+// UpdateUser 修改用户名、邮箱、密码或邮箱验证状态，不需要验证码
+// 修改密码后该用户的所有会话都会被强制下线，修改邮箱后邮箱变为未验证
+func UpdateUser(userID int64, req *UpdateUserRequest) (UpdateUserResponse, int) {
+	set := bson.M{}
+	var conflicts []bson.M
+	if req.Username != nil {
+		username := strings.ToLower(strings.TrimSpace(*req.Username))
+		if !usernamePattern.MatchString(username) {
+			return UpdateUserResponse{Code: 1, Message: "Username must be lowercase letters, numbers, or underscores"}, http.StatusBadRequest
+		}
+		set["username"] = username
+		conflicts = append(conflicts, bson.M{"username": username})
+	}
+	emailChanged := false
+	if req.Email != nil {
+		email := strings.TrimSpace(*req.Email)
+		if !IsEmail(email) {
+			return UpdateUserResponse{Code: 1, Message: "Invalid email"}, http.StatusBadRequest
+		}
+		user, err := FindUserByID(userID)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				return UpdateUserResponse{Code: 1, Message: "User not found"}, http.StatusNotFound
+			}
+			return UpdateUserResponse{Code: 2, Message: "Database error"}, http.StatusInternalServerError
+		}
+		if email != user.Email {
+			set["email"] = email
+			conflicts = append(conflicts, bson.M{"email": email})
+			emailChanged = req.EmailVerified == nil
+		}
+	}
+	if req.Password != nil {
+		password := strings.TrimSpace(*req.Password)
+		if password == "" {
+			return UpdateUserResponse{Code: 1, Message: "Missing fields"}, http.StatusBadRequest
+		}
+		hashedPassword, err := hashPassword(password)
+		if err != nil {
+			return UpdateUserResponse{Code: 2, Message: "Password encryption failed"}, http.StatusInternalServerError
+		}
+		set["password"] = hashedPassword
+	}
+	update := bson.M{}
+	switch {
+	case req.EmailVerified != nil && *req.EmailVerified:
+		set["email_verified"] = true
+		set["email_verified_at"] = time.Now()
+	case req.EmailVerified != nil || emailChanged:
+		set["email_verified"] = false
+		update["$unset"] = bson.M{"email_verified_at": ""}
+	}
+	if len(set) == 0 {
+		// 只提交了与当前相同的邮箱
+		if req.Email != nil {
+			return UpdateUserResponse{Code: 0, Message: "User updated"}, http.StatusOK
+		}
+		return UpdateUserResponse{Code: 1, Message: "Nothing to update"}, http.StatusBadRequest
+	}
+	update["$set"] = set
+
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return UpdateUserResponse{Code: 2, Message: "Database connection error"}, http.StatusInternalServerError
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if len(conflicts) > 0 {
+		count, err := conn.DB.Collection("users").CountDocuments(ctx, bson.M{
+			"_id": bson.M{"$ne": userID},
+			"$or": conflicts,
+		})
+		if err != nil {
+			return UpdateUserResponse{Code: 2, Message: "Database error"}, http.StatusInternalServerError
+		}
+		if count > 0 {
+			return UpdateUserResponse{Code: 1, Message: "Username or email already exists"}, http.StatusConflict
+		}
+	}
+
+	res, err := conn.DB.Collection("users").UpdateOne(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		return UpdateUserResponse{Code: 2, Message: "Update user failed"}, http.StatusInternalServerError
+	}
+	if res.MatchedCount == 0 {
+		return UpdateUserResponse{Code: 1, Message: "User not found"}, http.StatusNotFound
+	}
+	if req.Password != nil {
+		jwts.RemoveUserJWTsFromWhitelist(int(userID))
+	}
+	return UpdateUserResponse{Code: 0, Message: "User updated", EmailChanged: emailChanged}, http.StatusOK
+}
+
+// DeleteUser 删除用户及其会话与角色，用户不存在时返回 mongo.ErrNoDocuments
+// 个人访问令牌由调用方通过 pat.RevokeUserTokens 删除
+func DeleteUser(userID int64) error {
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := conn.DB.Collection("users").DeleteOne(ctx, bson.M{"_id": userID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	jwts.RemoveUserJWTsFromWhitelist(int(userID))
+	return rbac.RemoveUserRoles(int(userID))
+}
@@ -0,0 +1,57 @@
+package account
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"goauthx/internal/db"
+	"goauthx/internal/web/account/jwts"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type EmailResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// ChangeEmail 修改用户邮箱，调用前需已完成新邮箱的验证码校验，新邮箱视为已验证
+// revokeOthers 为 true 时下线除 currentSessionID 以外的所有会话
+func ChangeEmail(userID int64, newEmail string, revokeOthers bool, currentSessionID string) (EmailResponse, int) {
+	newEmail = strings.TrimSpace(newEmail)
+	if newEmail == "" {
+		return EmailResponse{Code: 1, Message: "Missing fields"}, http.StatusBadRequest
+	}
+
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return EmailResponse{Code: 2, Message: "Database connection error"}, http.StatusInternalServerError
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	count, err := conn.DB.Collection("users").CountDocuments(ctx, bson.M{"email": newEmail})
+	if err != nil {
+		return EmailResponse{Code: 2, Message: "Database error"}, http.StatusInternalServerError
+	}
+	if count > 0 {
+		return EmailResponse{Code: 1, Message: "Email already exists"}, http.StatusConflict
+	}
+
+	res, err := conn.DB.Collection("users").UpdateOne(ctx,
+		bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"email": newEmail, "email_verified": true, "email_verified_at": time.Now()}},
+	)
+	if err != nil {
+		return EmailResponse{Code: 2, Message: "Change email failed"}, http.StatusInternalServerError
+	}
+	if res.MatchedCount == 0 {
+		return EmailResponse{Code: 1, Message: "User not found"}, http.StatusNotFound
+	}
+
+	if revokeOthers {
+		jwts.RemoveUserSessionsExcept(int(userID), currentSessionID)
+	}
+
+	return EmailResponse{Code: 0, Message: "Email changed"}, http.StatusOK
+}
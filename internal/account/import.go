@@ -0,0 +1,344 @@
+package account
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"goauthx/internal/db"
+	"goauthx/internal/passhash"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 导入文件格式
+const (
+	ImportJSONL = "jsonl"
+	ImportCSV   = "csv"
+
+	// 结果中最多返回的错误明细数量
+	maxImportErrors = 100
+	// JSONL 单行的长度上限
+	maxImportLineSize = 1 << 20
+)
+
+var (
+	ErrImportFormat = errors.New("import format must be jsonl or csv")
+	// ErrImportDatabase 数据库不可用，导入中止
+	ErrImportDatabase = errors.New("database error")
+)
+
+// ImportRecord 导入文件中的一个用户，CSV 的表头使用相同的字段名
+// password_hash 按 password_format 保存，登录成功后自动转换为当前配置的算法
+type ImportRecord struct {
+	// ID 原系统的用户ID，只在保留原ID时使用
+	ID            int64  `json:"id"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	// CreatedAt RFC 3339 时间，或 Unix 时间戳（秒或毫秒），为空时为导入时间
+	CreatedAt      string `json:"created_at"`
+	PasswordHash   string `json:"password_hash"`
+	PasswordSalt   string `json:"password_salt"`
+	PasswordFormat string `json:"password_format"`
+}
+
+type ImportOptions struct {
+	// Format jsonl 或 csv
+	Format string
+	// PasswordFormat 记录中没有 password_format 时使用的哈希格式
+	PasswordFormat string
+	// KeepIDs 使用记录中的原ID，否则按注册的方式分配新ID
+	KeepIDs bool
+	// DryRun 只校验，不写入数据库
+	DryRun bool
+}
+
+type ImportError struct {
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+type ImportResult struct {
+	Total    int `json:"total"`
+	Imported int `json:"imported"`
+	// Skipped 用户名、邮箱或ID已存在的记录
+	Skipped int           `json:"skipped"`
+	Failed  int           `json:"failed"`
+	Errors  []ImportError `json:"errors,omitempty"`
+}
+
+func (r *ImportResult) addError(line int, skipped bool, err error) {
+	if skipped {
+		r.Skipped++
+	} else {
+		r.Failed++
+	}
+	if len(r.Errors) < maxImportErrors {
+		r.Errors = append(r.Errors, ImportError{Line: line, Message: err.Error()})
+	}
+}
+
+// errImportExists 记录与已有用户冲突，计入 Skipped
+type errImportExists struct{ msg string }
+
+func (e *errImportExists) Error() string { return e.msg }
+
+// ImportUsers 从 JSONL 或 CSV 批量导入用户，逐条处理，单条失败不影响其他记录
+// 返回的错误只表示无法继续导入，如格式错误或数据库不可用
+func ImportUsers(r io.Reader, opts ImportOptions) (*ImportResult, error) {
+	if opts.PasswordFormat != "" && !slices.Contains(passhash.ImportFormats, opts.PasswordFormat) {
+		return nil, fmt.Errorf("unknown password hash format %q", opts.PasswordFormat)
+	}
+	var coll *mongo.Collection
+	if !opts.DryRun {
+		conn, err := db.GetMongoConnector()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrImportDatabase, err)
+		}
+		coll = conn.DB.Collection("users")
+	}
+
+	result := &ImportResult{}
+	// 同一文件中重复的用户名、邮箱与ID
+	seen := map[string]bool{}
+	err := readImportRecords(r, opts.Format, func(line int, rec *ImportRecord, err error) error {
+		result.Total++
+		if err == nil {
+			err = importRecord(coll, rec, opts, seen)
+		}
+		if err != nil {
+			var exists *errImportExists
+			if errors.As(err, &exists) {
+				result.addError(line, true, err)
+				return nil
+			}
+			if isFatalImportError(err) {
+				return fmt.Errorf("%w: %v", ErrImportDatabase, err)
+			}
+			result.addError(line, false, err)
+			return nil
+		}
+		result.Imported++
+		return nil
+	})
+	return result, err
+}
+
+// isFatalImportError 数据库不可用时停止导入，而不是把剩余记录都记为失败
+func isFatalImportError(err error) bool {
+	return mongo.IsTimeout(err) || mongo.IsNetworkError(err) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// readImportRecords 逐条读取记录，单条记录解析失败时 err 不为空
+func readImportRecords(r io.Reader, format string, fn func(line int, rec *ImportRecord, err error) error) error {
+	switch format {
+	case ImportJSONL, "":
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxImportLineSize)
+		line := 0
+		for scanner.Scan() {
+			line++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var rec ImportRecord
+			var err error
+			if e := json.Unmarshal([]byte(text), &rec); e != nil {
+				err = fmt.Errorf("invalid JSON: %w", e)
+			}
+			if err := fn(line, &rec, err); err != nil {
+				return err
+			}
+		}
+		return scanner.Err()
+	case ImportCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		header, err := reader.Read()
+		if err != nil {
+			return fmt.Errorf("read CSV header: %w", err)
+		}
+		columns := map[string]int{}
+		for i, name := range header {
+			columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+		}
+		for _, required := range []string{"username", "email", "password_hash"} {
+			if _, ok := columns[required]; !ok {
+				return fmt.Errorf("CSV header is missing column %s", required)
+			}
+		}
+		for {
+			row, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			var parseErr *csv.ParseError
+			if err != nil && !errors.As(err, &parseErr) {
+				return err
+			}
+			line, _ := reader.FieldPos(0)
+			if err != nil {
+				line = parseErr.Line
+			}
+			var rec *ImportRecord
+			if err == nil {
+				rec, err = csvImportRecord(row, columns)
+			}
+			if err := fn(line, rec, err); err != nil {
+				return err
+			}
+		}
+	default:
+		return ErrImportFormat
+	}
+}
+
+func csvImportRecord(row []string, columns map[string]int) (*ImportRecord, error) {
+	get := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+	rec := &ImportRecord{
+		Username:       get("username"),
+		Email:          get("email"),
+		CreatedAt:      get("created_at"),
+		PasswordHash:   get("password_hash"),
+		PasswordFormat: get("password_format"),
+	}
+	// 盐中的空格是有效字符
+	if i, ok := columns["password_salt"]; ok && i < len(row) {
+		rec.PasswordSalt = row[i]
+	}
+	var err error
+	if v := get("id"); v != "" {
+		if rec.ID, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid id %q", v)
+		}
+	}
+	if v := get("email_verified"); v != "" {
+		if rec.EmailVerified, err = strconv.ParseBool(v); err != nil {
+			return nil, fmt.Errorf("invalid email_verified %q", v)
+		}
+	}
+	return rec, nil
+}
+
+// parseImportTime 解析 RFC 3339 时间或 Unix 时间戳，大于 1e11 的时间戳视为毫秒
+func parseImportTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}, fmt.Errorf("invalid created_at %q", s)
+	}
+	if n > 1e11 {
+		return time.UnixMilli(n), nil
+	}
+	return time.Unix(n, 0), nil
+}
+
+// importRecord 校验并写入一条记录，coll 为空时只校验
+func importRecord(coll *mongo.Collection, rec *ImportRecord, opts ImportOptions, seen map[string]bool) error {
+	username := strings.ToLower(strings.TrimSpace(rec.Username))
+	email := strings.TrimSpace(rec.Email)
+	if username == "" || email == "" || strings.TrimSpace(rec.PasswordHash) == "" {
+		return errors.New("missing fields")
+	}
+	if !usernamePattern.MatchString(username) {
+		return fmt.Errorf("invalid username %q", rec.Username)
+	}
+	if !IsEmail(email) {
+		return fmt.Errorf("invalid email %q", email)
+	}
+	if opts.KeepIDs && rec.ID <= 0 {
+		return errors.New("missing id")
+	}
+	format := strings.TrimSpace(rec.PasswordFormat)
+	if format == "" {
+		format = opts.PasswordFormat
+	}
+	if format == "" {
+		return errors.New("missing password_format")
+	}
+	hashed, err := passhash.ImportHash(format, rec.PasswordHash, rec.PasswordSalt)
+	if err != nil {
+		return fmt.Errorf("password_hash: %w", err)
+	}
+	createdAt := time.Now()
+	if rec.CreatedAt != "" {
+		if createdAt, err = parseImportTime(rec.CreatedAt); err != nil {
+			return err
+		}
+	}
+
+	keys := []string{"username:" + username, "email:" + strings.ToLower(email)}
+	if opts.KeepIDs {
+		keys = append(keys, "id:"+strconv.FormatInt(rec.ID, 10))
+	}
+	for _, key := range keys {
+		if seen[key] {
+			return &errImportExists{msg: "duplicate " + strings.Replace(key, ":", " ", 1) + " in file"}
+		}
+	}
+	for _, key := range keys {
+		seen[key] = true
+	}
+	if coll == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conflicts := []bson.M{{"username": username}, {"email": email}}
+	if opts.KeepIDs {
+		conflicts = append(conflicts, bson.M{"_id": rec.ID})
+	}
+	count, err := coll.CountDocuments(ctx, bson.M{"$or": conflicts})
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return &errImportExists{msg: fmt.Sprintf("user %s or email %s already exists", username, email)}
+	}
+
+	userID := rec.ID
+	if opts.KeepIDs {
+		// 先推进计数器，避免导入期间注册的用户分配到相同的ID
+		if err := db.AdvanceSequenceValue("user_id", userID); err != nil {
+			return err
+		}
+	} else if userID, err = db.GetNextSequenceValue("user_id"); err != nil {
+		return err
+	}
+	doc := UserDoc{
+		UserId:        userID,
+		Username:      username,
+		Email:         email,
+		Password:      hashed,
+		CreatedAt:     createdAt,
+		EmailVerified: &rec.EmailVerified,
+	}
+	if rec.EmailVerified {
+		now := time.Now()
+		doc.EmailVerifiedAt = &now
+	}
+	if _, err := coll.InsertOne(ctx, doc); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return &errImportExists{msg: fmt.Sprintf("user id %d already exists", userID)}
+		}
+		return err
+	}
+	return nil
+}
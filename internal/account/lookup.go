@@ -0,0 +1,68 @@
+package account
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"goauthx/internal/db"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+var emailPattern = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
+
+// IsEmail 判断是否为邮箱
+func IsEmail(s string) bool {
+	return emailPattern.MatchString(s)
+}
+
+// 判断是否为纯数字
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// findUser 按条件查找单个用户，不存在时返回 mongo.ErrNoDocuments
+func findUser(filter bson.M) (*UserDoc, error) {
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var user UserDoc
+	if err := conn.DB.Collection("users").FindOne(ctx, filter).Decode(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// FindUserByEmail 按邮箱查找用户
+func FindUserByEmail(email string) (*UserDoc, error) {
+	return findUser(bson.M{"email": email})
+}
+
+// FindUserByID 按用户ID查找用户
+func FindUserByID(userID int64) (*UserDoc, error) {
+	return findUser(bson.M{"_id": userID})
+}
+
+// FindUserByLogin 按登录名查找用户，登录名可以是邮箱、纯数字ID或用户名
+func FindUserByLogin(login string) (*UserDoc, error) {
+	switch {
+	case IsEmail(login):
+		return FindUserByEmail(login)
+	case isNumeric(login):
+		if id, err := strconv.ParseInt(login, 10, 64); err == nil {
+			return FindUserByID(id)
+		}
+	}
+	return findUser(bson.M{"username": login})
+}
@@ -0,0 +1,237 @@
+package account
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"goauthx/internal/config"
+	"goauthx/internal/db"
+	"strings"
+	"time"
+)
+
+const (
+	recoveryCodeCount = 10
+	// 每个用户在 mfaFailureWindow 内最多允许 mfaMaxFailures 次两步验证失败，
+	// 所有入口（登录、托管登录页、设备授权页、魔法链接）共用
+	mfaMaxFailures   = 10
+	mfaFailureWindow = 15 * time.Minute
+)
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication not enabled")
+	ErrNoPendingTOTP     = errors.New("no pending TOTP enrollment")
+	ErrInvalidMFACode    = errors.New("invalid two-factor code")
+	ErrMFALocked         = errors.New("too many failed two-factor attempts")
+)
+
+// hashRecoveryCode 恢复码本身是高熵随机串，使用 SHA-256 存储即可
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateRecoveryCodes 生成一组恢复码，返回明文（仅展示一次）与哈希
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := totpEncoding.EncodeToString(buf)
+		code := raw[:4] + "-" + raw[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func updateUser(userID int64, filter bson.M, update bson.M) (bool, error) {
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	filter["_id"] = userID
+	res, err := conn.DB.Collection("users").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount > 0, nil
+}
+
+// BeginTOTPEnrollment 生成待确认的 TOTP 密钥，返回密钥和 otpauth:// 链接
+func BeginTOTPEnrollment(userID int64) (string, string, error) {
+	user, err := FindUserByID(userID)
+	if err != nil {
+		return "", "", err
+	}
+	if user.TOTPEnabled {
+		return "", "", ErrMFAAlreadyEnabled
+	}
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := updateUser(userID, bson.M{}, bson.M{"$set": bson.M{"totp_pending_secret": secret}}); err != nil {
+		return "", "", err
+	}
+	return secret, totpURI(config.GetConfig().Name, user.Username, secret), nil
+}
+
+// ConfirmTOTPEnrollment 使用验证器生成的动态码确认绑定，成功后返回恢复码明文
+func ConfirmTOTPEnrollment(userID int64, code string) ([]string, error) {
+	user, err := FindUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if user.TOTPPendingSecret == "" {
+		return nil, ErrNoPendingTOTP
+	}
+	step, ok := matchTOTP(user.TOTPPendingSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"totp_secret":    user.TOTPPendingSecret,
+			"totp_enabled":   true,
+			"totp_last_step": step,
+			"recovery_codes": hashes,
+		},
+		"$unset": bson.M{"totp_pending_secret": ""},
+	}
+	if _, err := updateUser(userID, bson.M{}, update); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTOTP 关闭两步验证并清除密钥和恢复码
+func DisableTOTP(userID int64) error {
+	update := bson.M{
+		"$set": bson.M{"totp_enabled": false},
+		"$unset": bson.M{
+			"totp_secret":           "",
+			"totp_pending_secret":   "",
+			"totp_last_step":        "",
+			"recovery_codes":        "",
+			"mfa_failures":          "",
+			"mfa_failures_reset_at": "",
+		},
+	}
+	_, err := updateUser(userID, bson.M{}, update)
+	return err
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧恢复码全部作废
+func RegenerateRecoveryCodes(userID int64) ([]string, error) {
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	ok, err := updateUser(userID, bson.M{"totp_enabled": true}, bson.M{"$set": bson.M{"recovery_codes": hashes}})
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrMFANotEnabled
+	}
+	return codes, nil
+}
+
+// reserveMFAAttempt 在校验前先计入一次失败，并发请求也不会超过上限
+// 最近一次失败 mfaFailureWindow 之后计数清零
+func reserveMFAAttempt(userID int64) error {
+	now := time.Now()
+	if _, err := updateUser(userID,
+		bson.M{"mfa_failures_reset_at": bson.M{"$lte": now}},
+		bson.M{"$unset": bson.M{"mfa_failures": "", "mfa_failures_reset_at": ""}},
+	); err != nil {
+		return err
+	}
+	reserved, err := updateUser(userID,
+		bson.M{"mfa_failures": bson.M{"$not": bson.M{"$gte": mfaMaxFailures}}},
+		bson.M{
+			"$inc": bson.M{"mfa_failures": 1},
+			"$set": bson.M{"mfa_failures_reset_at": now.Add(mfaFailureWindow)},
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if !reserved {
+		return ErrMFALocked
+	}
+	return nil
+}
+
+// clearMFAFailures 校验成功后清除失败计数
+func clearMFAFailures(userID int64) error {
+	_, err := updateUser(userID, bson.M{}, bson.M{"$unset": bson.M{"mfa_failures": "", "mfa_failures_reset_at": ""}})
+	return err
+}
+
+// VerifyMFA 校验动态码或恢复码，动态码不可重放，恢复码使用后即作废
+// 连续失败次数过多时返回 ErrMFALocked
+func VerifyMFA(user *UserDoc, code string) error {
+	if !user.TOTPEnabled {
+		return ErrMFANotEnabled
+	}
+	if err := reserveMFAAttempt(user.UserId); err != nil {
+		return err
+	}
+	if err := verifyMFACode(user, code); err != nil {
+		return err
+	}
+	return clearMFAFailures(user.UserId)
+}
+
+// verifyMFACode 校验动态码或恢复码
+func verifyMFACode(user *UserDoc, code string) error {
+	code = strings.TrimSpace(code)
+	if step, ok := matchTOTP(user.TOTPSecret, code, time.Now()); ok {
+		// 只有时间步长大于上次使用的步长才算有效，防止同一动态码被重放
+		used, err := updateUser(user.UserId,
+			bson.M{"totp_last_step": bson.M{"$lt": step}},
+			bson.M{"$set": bson.M{"totp_last_step": step}},
+		)
+		if err != nil {
+			return err
+		}
+		if !used {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+	if code == "" {
+		return ErrInvalidMFACode
+	}
+	hash := hashRecoveryCode(code)
+	used, err := updateUser(user.UserId,
+		bson.M{"recovery_codes": hash},
+		bson.M{"$pull": bson.M{"recovery_codes": hash}},
+	)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"goauthx/internal/db"
+	"strconv"
+	"time"
+)
+
+// 每个用户最多注册的通行密钥数量
+const maxWebAuthnCredentials = 20
+
+var (
+	ErrWebAuthnCredentialExists   = errors.New("credential already registered")
+	ErrWebAuthnCredentialLimit    = errors.New("too many credentials registered")
+	ErrWebAuthnCredentialNotFound = errors.New("credential not found")
+)
+
+// WebAuthnCredential 用户注册的通行密钥，保存在用户文档的 webauthn_credentials 数组中
+type WebAuthnCredential struct {
+	ID []byte `bson:"id"`
+	// Name 用户给凭据起的名称，便于区分不同设备
+	Name string `bson:"name,omitempty"`
+	// PublicKey COSE_Key 格式的公钥
+	PublicKey      []byte     `bson:"public_key"`
+	Algorithm      int64      `bson:"algorithm"`
+	SignCount      uint32     `bson:"sign_count"`
+	AAGUID         []byte     `bson:"aaguid,omitempty"`
+	Transports     []string   `bson:"transports,omitempty"`
+	BackupEligible bool       `bson:"backup_eligible,omitempty"`
+	CreatedAt      time.Time  `bson:"created_at"`
+	LastUsedAt     *time.Time `bson:"last_used_at,omitempty"`
+}
+
+// WebAuthnCredential 按凭据ID查找用户的通行密钥
+func (u *UserDoc) WebAuthnCredential(id []byte) *WebAuthnCredential {
+	for i := range u.WebAuthnCredentials {
+		if bytes.Equal(u.WebAuthnCredentials[i].ID, id) {
+			return &u.WebAuthnCredentials[i]
+		}
+	}
+	return nil
+}
+
+// WebAuthnUserHandle 用户在认证器中的标识，使用十进制用户ID，不包含邮箱等个人信息
+func WebAuthnUserHandle(userID int64) []byte {
+	return []byte(strconv.FormatInt(userID, 10))
+}
+
+// ParseWebAuthnUserHandle 解析认证器返回的用户标识
+func ParseWebAuthnUserHandle(handle []byte) (int64, bool) {
+	if !isNumeric(string(handle)) {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(string(handle), 10, 64)
+	return id, err == nil
+}
+
+// ensureWebAuthnIndex 凭据ID在所有用户之间唯一
+func ensureWebAuthnIndex(coll *mongo.Collection) {
+	_, _ = coll.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys: bson.D{{Key: "webauthn_credentials.id", Value: 1}},
+		Options: options.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"webauthn_credentials.id": bson.M{"$exists": true}}),
+	})
+}
+
+// AddWebAuthnCredential 为用户添加通行密钥
+func AddWebAuthnCredential(userID int64, cred WebAuthnCredential) error {
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return err
+	}
+	coll := conn.DB.Collection("users")
+	ensureWebAuthnIndex(coll)
+
+	if _, err := findUser(bson.M{"webauthn_credentials.id": cred.ID}); err == nil {
+		return ErrWebAuthnCredentialExists
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+	if cred.CreatedAt.IsZero() {
+		cred.CreatedAt = time.Now()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// 数组已满时不匹配，避免并发注册超过上限
+	filter := bson.M{
+		"_id": userID,
+		"webauthn_credentials." + strconv.Itoa(maxWebAuthnCredentials-1): bson.M{"$exists": false},
+	}
+	res, err := coll.UpdateOne(ctx, filter, bson.M{"$push": bson.M{"webauthn_credentials": cred}})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrWebAuthnCredentialExists
+		}
+		return err
+	}
+	if res.MatchedCount == 0 {
+		if _, err := FindUserByID(userID); err != nil {
+			return err
+		}
+		return ErrWebAuthnCredentialLimit
+	}
+	return nil
+}
+
+// FindUserByWebAuthnCredential 按凭据ID查找用户，不存在时返回 mongo.ErrNoDocuments
+func FindUserByWebAuthnCredential(id []byte) (*UserDoc, *WebAuthnCredential, error) {
+	user, err := findUser(bson.M{"webauthn_credentials.id": id})
+	if err != nil {
+		return nil, nil, err
+	}
+	cred := user.WebAuthnCredential(id)
+	if cred == nil {
+		return nil, nil, mongo.ErrNoDocuments
+	}
+	return user, cred, nil
+}
+
+// UpdateWebAuthnSignCount 登录成功后保存新的签名计数与使用时间
+func UpdateWebAuthnSignCount(userID int64, id []byte, signCount uint32) error {
+	_, err := updateUser(userID, bson.M{"webauthn_credentials.id": id}, bson.M{"$set": bson.M{
+		"webauthn_credentials.$.sign_count":   signCount,
+		"webauthn_credentials.$.last_used_at": time.Now(),
+	}})
+	return err
+}
+
+// RemoveWebAuthnCredential 删除用户的通行密钥
+func RemoveWebAuthnCredential(userID int64, id []byte) error {
+	modified, err := updateUser(userID, bson.M{}, bson.M{"$pull": bson.M{"webauthn_credentials": bson.M{"id": id}}})
+	if err != nil {
+		return err
+	}
+	if !modified {
+		return ErrWebAuthnCredentialNotFound
+	}
+	return nil
+}
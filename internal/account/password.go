@@ -0,0 +1,147 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"goauthx/internal/db"
+	"goauthx/internal/passhash"
+	"goauthx/internal/web/account/jwts"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type PasswordResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// hashPassword 使用 password_hash 配置的算法计算密码哈希，注册和重置密码共用
+func hashPassword(password string) (string, error) {
+	return passhash.Hash(password)
+}
+
+// CheckPassword 校验用户密码是否正确
+// 校验成功而哈希的算法或参数已过时时，按当前配置重新计算并保存
+func CheckPassword(user *UserDoc, password string) bool {
+	ok, rehash, err := passhash.Verify(password, user.Password)
+	if err != nil {
+		log.Printf("用户 %d 的密码哈希无法校验: %v", user.UserId, err)
+		return false
+	}
+	if ok && rehash {
+		upgradePasswordHash(user, password)
+	}
+	return ok
+}
+
+// upgradePasswordHash 升级密码哈希，失败时保留原哈希，下次登录再试
+func upgradePasswordHash(user *UserDoc, password string) {
+	hashed, err := hashPassword(password)
+	if err != nil {
+		log.Printf("用户 %d 的密码哈希升级失败: %v", user.UserId, err)
+		return
+	}
+	// 只在密码未被同时修改时覆盖
+	if _, err := updateUser(user.UserId, bson.M{"password": user.Password}, bson.M{"$set": bson.M{"password": hashed}}); err != nil {
+		log.Printf("用户 %d 的密码哈希升级失败: %v", user.UserId, err)
+		return
+	}
+	user.Password = hashed
+}
+
+// ResetPassword 重置密码核心逻辑，调用前需已完成邮箱验证码校验
+// 重置成功后该用户的所有会话都会被强制下线
+func ResetPassword(email, newPassword string) (PasswordResponse, int) {
+	email = strings.TrimSpace(email)
+	newPassword = strings.TrimSpace(newPassword)
+	if email == "" || newPassword == "" {
+		return PasswordResponse{Code: 1, Message: "Missing fields"}, http.StatusBadRequest
+	}
+
+	user, err := FindUserByEmail(email)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return PasswordResponse{Code: 1, Message: "User not found"}, http.StatusNotFound
+		}
+		return PasswordResponse{Code: 2, Message: "Database error"}, http.StatusInternalServerError
+	}
+
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return PasswordResponse{Code: 2, Message: "Password encryption failed"}, http.StatusInternalServerError
+	}
+
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return PasswordResponse{Code: 2, Message: "Database connection error"}, http.StatusInternalServerError
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = conn.DB.Collection("users").UpdateOne(ctx,
+		bson.M{"_id": user.UserId},
+		bson.M{"$set": bson.M{"password": hashedPassword}},
+	)
+	if err != nil {
+		return PasswordResponse{Code: 2, Message: "Reset password failed"}, http.StatusInternalServerError
+	}
+
+	// 通过邮箱验证码重置密码，同时完成邮箱验证
+	if !user.IsEmailVerified() {
+		_ = SetEmailVerified(user.UserId, true)
+	}
+
+	// 密码已变更，所有旧会话失效；个人访问令牌由调用方通过 pat.RevokeUserTokens 删除
+	jwts.RemoveUserJWTsFromWhitelist(int(user.UserId))
+
+	return PasswordResponse{Code: 0, Message: "Password reset success"}, http.StatusOK
+}
+
+// ChangePassword 已登录用户修改密码，需要校验当前密码
+// revokeOthers 为 true 时下线除 currentSessionID 以外的所有会话
+func ChangePassword(userID int64, oldPassword, newPassword string, revokeOthers bool, currentSessionID string) (PasswordResponse, int) {
+	oldPassword = strings.TrimSpace(oldPassword)
+	newPassword = strings.TrimSpace(newPassword)
+	if oldPassword == "" || newPassword == "" {
+		return PasswordResponse{Code: 1, Message: "Missing fields"}, http.StatusBadRequest
+	}
+
+	user, err := FindUserByID(userID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return PasswordResponse{Code: 1, Message: "User not found"}, http.StatusNotFound
+		}
+		return PasswordResponse{Code: 2, Message: "Database error"}, http.StatusInternalServerError
+	}
+	if !CheckPassword(user, oldPassword) {
+		return PasswordResponse{Code: 3, Message: "Incorrect password"}, http.StatusUnauthorized
+	}
+
+	hashedPassword, err := hashPassword(newPassword)
+	if err != nil {
+		return PasswordResponse{Code: 2, Message: "Password encryption failed"}, http.StatusInternalServerError
+	}
+
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return PasswordResponse{Code: 2, Message: "Database connection error"}, http.StatusInternalServerError
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = conn.DB.Collection("users").UpdateOne(ctx,
+		bson.M{"_id": user.UserId},
+		bson.M{"$set": bson.M{"password": hashedPassword}},
+	)
+	if err != nil {
+		return PasswordResponse{Code: 2, Message: "Change password failed"}, http.StatusInternalServerError
+	}
+
+	if revokeOthers {
+		jwts.RemoveUserSessionsExcept(int(user.UserId), currentSessionID)
+	}
+
+	return PasswordResponse{Code: 0, Message: "Password changed"}, http.StatusOK
+}
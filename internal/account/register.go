@@ -4,7 +4,6 @@ import (
 	"context"
 	"go.mongodb.org/mongo-driver/bson"
 	"goauthx/internal/db"
-	"golang.org/x/crypto/bcrypt"
 	"net/http"
 	"regexp"
 	"strings"
@@ -27,11 +26,14 @@ type RegisterRequest struct {
 	Password string `json:"password"`
 	Email    string `json:"email"`
 	Captcha  string `json:"captcha"`
+	// EmailVerified 调用方已校验过邮箱验证码，控制台、管理接口创建的账号为 false
+	EmailVerified bool `json:"-"`
 }
 
 type RegisterResponse struct {
 	Code    int    `json:"code"`
 	Message string `json:"message"`
+	UserID  int64  `json:"user_id,omitempty"`
 }
 
 // 注册核心逻辑，供 HTTP handler 和命令复用
@@ -69,7 +71,7 @@ func RegisterUser(req *RegisterRequest) (RegisterResponse, int) {
 		return RegisterResponse{Code: 1, Message: "Username or email already exists"}, http.StatusConflict
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := hashPassword(req.Password)
 	if err != nil {
 		return RegisterResponse{Code: 2, Message: "Password encryption failed"}, http.StatusInternalServerError
 	}
@@ -79,12 +81,17 @@ func RegisterUser(req *RegisterRequest) (RegisterResponse, int) {
 		return RegisterResponse{Code: 2, Message: "Failed to generate userId"}, http.StatusInternalServerError
 	}
 
+	now := time.Now()
 	userDoc := UserDoc{
-		UserId:    userId,
-		Username:  req.Username,
-		Password:  string(hashedPassword),
-		Email:     req.Email,
-		CreatedAt: time.Now(),
+		UserId:        userId,
+		Username:      req.Username,
+		Password:      hashedPassword,
+		Email:         req.Email,
+		CreatedAt:     now,
+		EmailVerified: &req.EmailVerified,
+	}
+	if req.EmailVerified {
+		userDoc.EmailVerifiedAt = &now
 	}
 
 	_, err = conn.DB.Collection("users").InsertOne(ctx, userDoc)
@@ -92,5 +99,5 @@ func RegisterUser(req *RegisterRequest) (RegisterResponse, int) {
 		return RegisterResponse{Code: 2, Message: "Register failed"}, http.StatusInternalServerError
 	}
 
-	return RegisterResponse{Code: 0, Message: "Register success"}, http.StatusOK
+	return RegisterResponse{Code: 0, Message: "Register success", UserID: userId}, http.StatusOK
 }
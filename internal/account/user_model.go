@@ -8,4 +8,27 @@ type UserDoc struct {
 	Email     string    `bson:"email"`
 	Password  string    `bson:"password"`
 	CreatedAt time.Time `bson:"created_at,omitempty"`
+
+	// 邮箱验证状态，记录验证状态之前创建的账号没有该字段
+	EmailVerified   *bool      `bson:"email_verified,omitempty"`
+	EmailVerifiedAt *time.Time `bson:"email_verified_at,omitempty"`
+
+	// 两步验证（TOTP），恢复码只保存哈希
+	TOTPEnabled       bool     `bson:"totp_enabled,omitempty"`
+	TOTPSecret        string   `bson:"totp_secret,omitempty"`
+	TOTPPendingSecret string   `bson:"totp_pending_secret,omitempty"`
+	TOTPLastStep      int64    `bson:"totp_last_step,omitempty"`
+	RecoveryCodes     []string `bson:"recovery_codes,omitempty"`
+	// 两步验证连续失败次数，超过上限后锁定到 MFAFailuresResetAt
+	MFAFailures        int        `bson:"mfa_failures,omitempty"`
+	MFAFailuresResetAt *time.Time `bson:"mfa_failures_reset_at,omitempty"`
+
+	// 通行密钥（WebAuthn）
+	WebAuthnCredentials []WebAuthnCredential `bson:"webauthn_credentials,omitempty"`
+}
+
+// IsEmailVerified 判断邮箱是否已验证
+// 没有记录验证状态的旧账号只能通过验证码注册，视为已验证
+func (u *UserDoc) IsEmailVerified() bool {
+	return u.EmailVerified == nil || *u.EmailVerified
 }
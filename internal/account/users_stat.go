@@ -2,24 +2,97 @@ package account
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"goauthx/internal/db"
 	"goauthx/internal/web/account/jwts"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const (
+	BanStatusActive  = "active"
+	BanStatusExpired = "expired"
+	BanStatusLifted  = "lifted"
+)
+
+var ErrInvalidBanDuration = errors.New("invalid ban duration")
+
 type UserBan struct {
 	BanID     primitive.ObjectID `bson:"_id,omitempty"`
 	UserID    int                `bson:"user_id"`
-	BannedBy  int                `bson:"banned_by,omitempty"`
+	BannedBy  *int               `bson:"banned_by,omitempty"`
 	BanReason string             `bson:"ban_reason,omitempty"`
 	BanStart  time.Time          `bson:"ban_start_time,omitempty"`
 	BanEnd    *time.Time         `bson:"ban_end_time,omitempty"`
 	IsActive  bool               `bson:"is_active"`
 	CreatedAt time.Time          `bson:"created_at"`
 	UpdatedAt time.Time          `bson:"updated_at"`
+
+	// set when the ban is lifted by an admin, UnbannedBy is nil for the console and admin_secret
+	UnbannedBy  *int       `bson:"unbanned_by,omitempty"`
+	UnbanReason string     `bson:"unban_reason,omitempty"`
+	UnbannedAt  *time.Time `bson:"unbanned_at,omitempty"`
+}
+
+// Status returns active, expired or lifted
+func (b *UserBan) Status(now time.Time) string {
+	switch {
+	case !b.IsActive:
+		return BanStatusLifted
+	case b.BanEnd != nil && !b.BanEnd.After(now):
+		return BanStatusExpired
+	}
+	return BanStatusActive
+}
+
+// activeBanFilter matches bans in effect: is_active and ban_end_time is null or in the future
+func activeBanFilter() bson.M {
+	return bson.M{
+		"is_active": true,
+		"$or": []bson.M{
+			{"ban_end_time": bson.M{"$eq": nil}},
+			{"ban_end_time": bson.M{"$gt": time.Now()}},
+		},
+	}
+}
+
+// ParseBanEnd parses a ban duration such as 30m, 12h, 7d, 2w or permanent
+// and returns the end time, the zero time means a permanent ban
+func ParseBanEnd(s string, now time.Time) (time.Time, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch s {
+	case "permanent", "perm", "forever":
+		return time.Time{}, nil
+	case "":
+		return time.Time{}, ErrInvalidBanDuration
+	}
+	var d time.Duration
+	unit := s[len(s)-1]
+	if unit == 'd' || unit == 'w' {
+		n, err := strconv.Atoi(s[:len(s)-1])
+		if err != nil {
+			return time.Time{}, ErrInvalidBanDuration
+		}
+		d = time.Duration(n) * 24 * time.Hour
+		if unit == 'w' {
+			d *= 7
+		}
+	} else {
+		var err error
+		if d, err = time.ParseDuration(s); err != nil {
+			return time.Time{}, ErrInvalidBanDuration
+		}
+	}
+	if d <= 0 {
+		return time.Time{}, fmt.Errorf("%w: must be positive", ErrInvalidBanDuration)
+	}
+	return now.Add(d), nil
 }
 
 // IsUserBanned checks if the user is currently banned (is_active=1 and ban_end_time is null or in the future)
@@ -30,15 +103,9 @@ func IsUserBanned(userID int) (bool, *UserBan, error) {
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	filter := bson.M{
-		"user_id":   userID,
-		"is_active": true,
-		"$or": []bson.M{
-			{"ban_end_time": bson.M{"$eq": nil}},
-			{"ban_end_time": bson.M{"$gt": time.Now()}},
-		},
-	}
-	findOpts := options.FindOne().SetSort(bson.D{{"ban_start_time", -1}})
+	filter := activeBanFilter()
+	filter["user_id"] = userID
+	findOpts := options.FindOne().SetSort(bson.D{{Key: "ban_start_time", Value: -1}})
 	var ban UserBan
 	err = conn.DB.Collection("users_bans").FindOne(ctx, filter, findOpts).Decode(&ban)
 	if err != nil {
@@ -50,7 +117,33 @@ func IsUserBanned(userID int) (bool, *UserBan, error) {
 	return true, &ban, nil
 }
 
-// BanUser inserts a new ban record for the user
+func init() {
+	jwts.RegisterRefreshCheck(checkRefreshAllowed)
+}
+
+// checkRefreshAllowed 刷新 Token 前确认用户仍然存在、未被封禁，且满足登录时的邮箱验证要求
+func checkRefreshAllowed(userID int) error {
+	user, err := FindUserByID(int64(userID))
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return fmt.Errorf("%w: user not found", jwts.ErrRefreshDenied)
+		}
+		return err
+	}
+	banned, _, err := IsUserBanned(userID)
+	if err != nil {
+		return err
+	}
+	if banned {
+		return fmt.Errorf("%w: user is banned", jwts.ErrRefreshDenied)
+	}
+	if EmailVerificationRequired(user) {
+		return fmt.Errorf("%w: email not verified", jwts.ErrRefreshDenied)
+	}
+	return nil
+}
+
+// BanUser inserts a new ban record for the user, a zero banEnd means a permanent ban
 func BanUser(userID int, bannedBy *int, reason string, banEnd time.Time) error {
 	conn, err := db.GetMongoConnector()
 	if err != nil {
@@ -59,11 +152,15 @@ func BanUser(userID int, bannedBy *int, reason string, banEnd time.Time) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	now := time.Now()
+	var end *time.Time
+	if !banEnd.IsZero() {
+		end = &banEnd
+	}
 	banDoc := bson.M{
 		"user_id":        userID,
 		"banned_by":      bannedBy,
 		"ban_reason":     reason,
-		"ban_end_time":   banEnd,
+		"ban_end_time":   end,
 		"is_active":      true,
 		"created_at":     now,
 		"updated_at":     now,
@@ -76,24 +173,60 @@ func BanUser(userID int, bannedBy *int, reason string, banEnd time.Time) error {
 	return err
 }
 
-// UnbanUser sets is_active=false for all active bans of the user
-func UnbanUser(userID int) error {
+// UnbanUser lifts all bans of the user that are currently in effect,
+// recording who lifted them and why, and returns the number of bans lifted
+func UnbanUser(userID int, unbannedBy *int, reason string) (int64, error) {
 	conn, err := db.GetMongoConnector()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
-	filter := bson.M{
-		"user_id":   userID,
-		"is_active": true,
-	}
+	filter := activeBanFilter()
+	filter["user_id"] = userID
+	now := time.Now()
 	update := bson.M{
 		"$set": bson.M{
-			"is_active":  false,
-			"updated_at": time.Now(),
+			"is_active":    false,
+			"unbanned_by":  unbannedBy,
+			"unban_reason": reason,
+			"unbanned_at":  now,
+			"updated_at":   now,
 		},
 	}
-	_, err = conn.DB.Collection("users_bans").UpdateMany(ctx, filter, update)
-	return err
+	res, err := conn.DB.Collection("users_bans").UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// findBans returns ban records matching the filter, newest first
+func findBans(filter bson.M) ([]UserBan, error) {
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := conn.DB.Collection("users_bans").Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "ban_start_time", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	bans := make([]UserBan, 0)
+	if err := cursor.All(ctx, &bans); err != nil {
+		return nil, err
+	}
+	return bans, nil
+}
+
+// ListUserBans returns the full ban history of the user, including expired and lifted bans
+func ListUserBans(userID int) ([]UserBan, error) {
+	return findBans(bson.M{"user_id": userID})
+}
+
+// ListActiveBans returns all bans currently in effect
+func ListActiveBans() ([]UserBan, error) {
+	return findBans(activeBanFilter())
 }
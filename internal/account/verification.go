@@ -0,0 +1,195 @@
+package account
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"goauthx/internal/config"
+	"goauthx/internal/db"
+	"goauthx/internal/smtp"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// 邮箱验证邮件模板，{{LINK}} 为验证链接，{{TOKEN}} 为验证令牌
+const verificationTemplatePath = "./resources/template/email/verify_email.html"
+
+var (
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrVerificationLinkBase     = errors.New("email_verification.link_base_url or oauth.issuer must be set to send verification links")
+)
+
+// emailVerification 邮箱验证令牌，只保存哈希，绑定签发时的邮箱
+type emailVerification struct {
+	Hash      string    `bson:"_id"`
+	UserID    int64     `bson:"user_id"`
+	Email     string    `bson:"email"`
+	CreatedAt time.Time `bson:"created_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+// getVerificationCollection 获取 email_verifications 集合，过期的令牌由TTL索引清理
+func getVerificationCollection() (*mongo.Collection, error) {
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return nil, err
+	}
+	coll := conn.DB.Collection("email_verifications")
+	_, _ = coll.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	return coll, nil
+}
+
+func hashVerificationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// verificationLinkBase 验证链接的地址前缀，未配置时返回 ErrVerificationLinkBase
+func verificationLinkBase() (string, error) {
+	cfg := config.GetConfig()
+	base := cfg.EmailVerification.LinkBaseURL
+	if base == "" {
+		base = cfg.OAuth.Issuer
+	}
+	if base == "" {
+		return "", ErrVerificationLinkBase
+	}
+	return strings.TrimSuffix(base, "/"), nil
+}
+
+// newVerificationToken 为用户当前邮箱签发验证令牌，之前未使用的令牌作废
+func newVerificationToken(user *UserDoc) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	coll, err := getVerificationCollection()
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := coll.DeleteMany(ctx, bson.M{"user_id": user.UserId}); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	ttl := time.Duration(config.GetConfig().EmailVerification.TokenTTLHours) * time.Hour
+	if ttl <= 0 {
+		ttl = 48 * time.Hour
+	}
+	_, err = coll.InsertOne(ctx, emailVerification{
+		Hash:      hashVerificationToken(token),
+		UserID:    user.UserId,
+		Email:     user.Email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// SendVerificationEmail 向用户当前邮箱发送验证链接
+func SendVerificationEmail(user *UserDoc) error {
+	base, err := verificationLinkBase()
+	if err != nil {
+		return err
+	}
+	htmlBytes, err := os.ReadFile(verificationTemplatePath)
+	if err != nil {
+		return fmt.Errorf("load email template: %w", err)
+	}
+	token, err := newVerificationToken(user)
+	if err != nil {
+		return err
+	}
+	link := base + "/email/verify?token=" + url.QueryEscape(token)
+
+	cfg := config.GetConfig()
+	htmlBody := strings.ReplaceAll(string(htmlBytes), "{{LINK}}", link)
+	htmlBody = strings.ReplaceAll(htmlBody, "{{TOKEN}}", token)
+	htmlBody = strings.ReplaceAll(htmlBody, "{{NAME}}", cfg.Name)
+	htmlBody = strings.ReplaceAll(htmlBody, "{{USERNAME}}", user.Username)
+	subject := fmt.Sprintf("验证您的 %s 邮箱", cfg.Name)
+	return email.SendEmail([]string{user.Email}, subject, htmlBody)
+}
+
+// VerifyEmail 使用验证令牌完成邮箱验证，令牌只能使用一次
+// 签发后用户修改过邮箱的令牌无效
+func VerifyEmail(token string) (*UserDoc, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, ErrInvalidVerificationToken
+	}
+	coll, err := getVerificationCollection()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var record emailVerification
+	err = coll.FindOneAndDelete(ctx, bson.M{"_id": hashVerificationToken(token)}).Decode(&record)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, err
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, ErrInvalidVerificationToken
+	}
+	user, err := FindUserByID(record.UserID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrInvalidVerificationToken
+		}
+		return nil, err
+	}
+	if !strings.EqualFold(user.Email, record.Email) {
+		return nil, ErrInvalidVerificationToken
+	}
+	if err := SetEmailVerified(user.UserId, true); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// SetEmailVerified 设置邮箱验证状态，已验证的账号保留原验证时间
+func SetEmailVerified(userID int64, verified bool) error {
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	filter := bson.M{"_id": userID}
+	var update bson.M
+	if verified {
+		filter["email_verified"] = false
+		update = bson.M{"$set": bson.M{"email_verified": true, "email_verified_at": time.Now()}}
+	} else {
+		update = bson.M{"$set": bson.M{"email_verified": false}, "$unset": bson.M{"email_verified_at": ""}}
+	}
+	_, err = conn.DB.Collection("users").UpdateOne(ctx, filter, update)
+	return err
+}
+
+// EmailVerificationRequired 判断是否因邮箱未验证而禁止登录
+func EmailVerificationRequired(user *UserDoc) bool {
+	return config.GetConfig().EmailVerification.RequireForLogin && !user.IsEmailVerified()
+}
@@ -0,0 +1,202 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FlagType is the value type of a flag
+type FlagType int
+
+const (
+	StringFlag FlagType = iota
+	BoolFlag
+	IntFlag
+	DurationFlag
+)
+
+func (t FlagType) String() string {
+	switch t {
+	case BoolFlag:
+		return "bool"
+	case IntFlag:
+		return "int"
+	case DurationFlag:
+		return "duration"
+	}
+	return "string"
+}
+
+// Flag declares a typed flag, given as --name value, --name=value or -s value.
+// Bool flags take no value unless written as --name=false.
+type Flag struct {
+	Name  string
+	Short string
+	Type  FlagType
+	// Default is parsed with the flag type when the flag is not given
+	Default string
+	Usage   string
+}
+
+func (f *Flag) parse(value string) (any, error) {
+	switch f.Type {
+	case BoolFlag:
+		return strconv.ParseBool(value)
+	case IntFlag:
+		return strconv.Atoi(value)
+	case DurationFlag:
+		return time.ParseDuration(value)
+	}
+	return value, nil
+}
+
+// SplitArgs splits a command line like a shell does: arguments are separated
+// by whitespace, single quotes keep everything literally, double quotes keep
+// spaces and allow \" and \\ escapes, and a backslash outside quotes escapes
+// the next character.
+func SplitArgs(input string) ([]string, error) {
+	var args []string
+	var cur strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, c := range input {
+		switch {
+		case escaped:
+			if quote == '"' && c != '"' && c != '\\' {
+				cur.WriteRune('\\')
+			}
+			cur.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				inArg = false
+			}
+		default:
+			cur.WriteRune(c)
+			inArg = true
+		}
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// findFlag returns the declared flag for --name or -s
+func (c *Command) findFlag(arg string) *Flag {
+	for i := range c.Flags {
+		f := &c.Flags[i]
+		if arg == "--"+f.Name || (f.Short != "" && arg == "-"+f.Short) {
+			return f
+		}
+	}
+	return nil
+}
+
+// parseFlags separates flags from positional arguments. Commands without
+// declared flags receive every argument as positional; "--" ends the flags.
+func (c *Command) parseFlags(args []string) (map[string]any, []string, error) {
+	values := make(map[string]any)
+	for i := range c.Flags {
+		f := &c.Flags[i]
+		if f.Default == "" {
+			continue
+		}
+		v, err := f.parse(f.Default)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid default of --%s: %w", f.Name, err)
+		}
+		values[f.Name] = v
+	}
+	if len(c.Flags) == 0 {
+		return values, args, nil
+	}
+
+	positional := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			positional = append(positional, args[i+1:]...)
+			break
+		}
+		if len(arg) < 2 || arg[0] != '-' {
+			positional = append(positional, arg)
+			continue
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		f := c.findFlag(name)
+		if f == nil {
+			return nil, nil, fmt.Errorf("unknown flag: %s", name)
+		}
+		if !hasValue {
+			if f.Type == BoolFlag {
+				value = "true"
+			} else {
+				if i+1 >= len(args) {
+					return nil, nil, fmt.Errorf("flag --%s needs a value", f.Name)
+				}
+				i++
+				value = args[i]
+			}
+		}
+		v, err := f.parse(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid %s value for --%s: %s", f.Type, f.Name, value)
+		}
+		values[f.Name] = v
+	}
+	return values, positional, nil
+}
+
+// String returns the value of a string flag
+func (ctx *Context) String(name string) string {
+	v, _ := ctx.flags[name].(string)
+	return v
+}
+
+// Bool returns the value of a bool flag
+func (ctx *Context) Bool(name string) bool {
+	v, _ := ctx.flags[name].(bool)
+	return v
+}
+
+// Int returns the value of an int flag
+func (ctx *Context) Int(name string) int {
+	v, _ := ctx.flags[name].(int)
+	return v
+}
+
+// Duration returns the value of a duration flag
+func (ctx *Context) Duration(name string) time.Duration {
+	v, _ := ctx.flags[name].(time.Duration)
+	return v
+}
+
+// IsSet reports whether the flag was given or has a default
+func (ctx *Context) IsSet(name string) bool {
+	_, ok := ctx.flags[name]
+	return ok
+}
@@ -0,0 +1,133 @@
+package command
+
+import (
+	"fmt"
+	"goauthx/internal/account"
+	"strings"
+	"time"
+)
+
+// Bans issued from the console have no banned_by and are shown as "operator".
+func init() {
+	Register(&Command{
+		Name:        "ban",
+		Description: "Ban a user and log out all of its sessions; duration is 30m, 12h, 7d, 2w or permanent",
+		Usage:       "<user> <duration|permanent> <reason...>",
+		MinArgs:     3,
+		Run:         banUser,
+	})
+	Register(&Command{
+		Name:        "unban",
+		Description: "Lift the bans of a user that are in effect",
+		Usage:       "<user> [reason...]",
+		MinArgs:     1,
+		Run:         unbanUser,
+	})
+	Register(&Command{
+		Name:        "bans",
+		Description: "List bans in effect, or the full ban history of a user",
+		Usage:       "[user]",
+		Run:         listBans,
+	})
+}
+
+func banUser(ctx *Context) error {
+	user, err := findUser(ctx.Args[0])
+	if err != nil {
+		return err
+	}
+	end, err := account.ParseBanEnd(ctx.Args[1], time.Now())
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, ctx.Args[1])
+	}
+	reason := strings.Join(ctx.Args[2:], " ")
+	if err := account.BanUser(int(user.UserId), nil, reason, end); err != nil {
+		return err
+	}
+	ctx.Printf("Banned %s (%d) %s: %s\n", user.Username, user.UserId, formatBanEnd(&end), reason)
+	return nil
+}
+
+func unbanUser(ctx *Context) error {
+	user, err := findUser(ctx.Args[0])
+	if err != nil {
+		return err
+	}
+	lifted, err := account.UnbanUser(int(user.UserId), nil, strings.Join(ctx.Args[1:], " "))
+	if err != nil {
+		return err
+	}
+	if lifted == 0 {
+		return fmt.Errorf("%s is not banned", user.Username)
+	}
+	ctx.Printf("Unbanned %s (%d), %d ban(s) lifted\n", user.Username, user.UserId, lifted)
+	return nil
+}
+
+func listBans(ctx *Context) error {
+	if len(ctx.Args) == 0 {
+		bans, err := account.ListActiveBans()
+		if err != nil {
+			return err
+		}
+		if len(bans) == 0 {
+			ctx.Println("No active bans")
+			return nil
+		}
+		for _, b := range bans {
+			name := "?"
+			if user, err := account.FindUserByID(int64(b.UserID)); err == nil {
+				name = user.Username
+			}
+			ctx.Printf(" - %s (%d) %s by %s: %s\n", name, b.UserID,
+				formatBanEnd(b.BanEnd), formatActor(b.BannedBy), b.BanReason)
+		}
+		return nil
+	}
+
+	user, err := findUser(ctx.Args[0])
+	if err != nil {
+		return err
+	}
+	bans, err := account.ListUserBans(int(user.UserId))
+	if err != nil {
+		return err
+	}
+	if len(bans) == 0 {
+		ctx.Printf("%s (%d) has never been banned\n", user.Username, user.UserId)
+		return nil
+	}
+	now := time.Now()
+	for _, b := range bans {
+		ctx.Printf(" - [%s] %s %s by %s: %s\n", b.Status(now), b.BanStart.Format(time.DateTime),
+			formatBanEnd(b.BanEnd), formatActor(b.BannedBy), b.BanReason)
+		if b.Status(now) == account.BanStatusLifted {
+			line := "     lifted"
+			if b.UnbannedAt != nil {
+				line += " " + b.UnbannedAt.Format(time.DateTime)
+			}
+			line += " by " + formatActor(b.UnbannedBy)
+			if b.UnbanReason != "" {
+				line += ": " + b.UnbanReason
+			}
+			ctx.Println(line)
+		}
+	}
+	return nil
+}
+
+// formatBanEnd formats the end of a ban, nil or zero means permanent
+func formatBanEnd(end *time.Time) string {
+	if end == nil || end.IsZero() {
+		return "permanently"
+	}
+	return "until " + end.Format(time.DateTime)
+}
+
+// formatActor formats the admin who banned or unbanned a user
+func formatActor(id *int) string {
+	if id == nil {
+		return "operator"
+	}
+	return fmt.Sprintf("user %d", *id)
+}
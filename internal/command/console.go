@@ -0,0 +1,127 @@
+package command
+
+import (
+	"errors"
+	"golang.org/x/term"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// RunTerminal runs the interactive console on a terminal with line editing,
+// history (up/down arrows) and tab completion of commands, subcommands and flags.
+// Log output is routed through the terminal so it does not break the prompt.
+// execute runs one command line, Run for the local registry.
+// It returns io.EOF when the user presses Ctrl-C or Ctrl-D.
+func RunTerminal(in, out *os.File, execute func(input string, out io.Writer) error) error {
+	fd := int(in.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = term.Restore(fd, state) }()
+
+	t := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{in, out}, "> ")
+	if width, height, err := term.GetSize(int(out.Fd())); err == nil {
+		_ = t.SetSize(width, height)
+	}
+	t.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		return Complete(line, pos)
+	}
+	log.SetOutput(t)
+	defer log.SetOutput(os.Stderr)
+
+	for {
+		input, err := t.ReadLine()
+		if err != nil && !errors.Is(err, term.ErrPasteIndicator) {
+			return err
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+		if err := execute(input, t); err != nil {
+			log.Printf("命令执行错误: %v", err)
+		}
+	}
+}
+
+// Complete completes the word before pos: command names first, then
+// subcommands, and flag names for words starting with "-".
+// "help" completes the command it describes.
+func Complete(line string, pos int) (string, int, bool) {
+	head, tail := line[:pos], line[pos:]
+	words := strings.Fields(head)
+	current := ""
+	if len(words) > 0 && !strings.HasSuffix(head, " ") {
+		current = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+	if len(words) > 0 && strings.ToLower(words[0]) == "help" {
+		words = words[1:]
+	}
+
+	var candidates []string
+	for _, name := range completions(words, current) {
+		if strings.HasPrefix(name, current) {
+			candidates = append(candidates, name)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", 0, false
+	}
+	completion := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, completion) {
+			completion = completion[:len(completion)-1]
+		}
+	}
+	if len(candidates) == 1 {
+		completion += " "
+	}
+	if len(completion) <= len(current) {
+		return "", 0, false
+	}
+	newHead := head[:len(head)-len(current)] + completion
+	return newHead + tail, len(newHead), true
+}
+
+// completions returns the possible next words after words
+func completions(words []string, current string) []string {
+	if len(words) == 0 {
+		return ListCommands()
+	}
+	cmd, ok := Lookup(words[0])
+	if !ok {
+		return nil
+	}
+	for _, w := range words[1:] {
+		if len(cmd.Subcommands) == 0 {
+			break
+		}
+		if cmd = cmd.Subcommand(w); cmd == nil {
+			return nil
+		}
+	}
+	var names []string
+	switch {
+	case strings.HasPrefix(current, "-"):
+		for _, f := range cmd.Flags {
+			names = append(names, "--"+f.Name)
+		}
+	case len(cmd.Subcommands) > 0:
+		for _, sub := range cmd.Subcommands {
+			names = append(names, sub.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -2,42 +2,183 @@ package command
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"sort"
 	"strings"
 )
 
-// Handler interface that all command handlers must implement
+// Handler interface for plain handlers that receive the raw arguments
 type Handler interface {
 	Execute(args []string) error
 }
 
-// Registry to hold all handlers
-var handlers = make(map[string]Handler)
+// Command describes a console command. A command either has subcommands
+// or a Run function; the registry takes care of dispatching, flag parsing,
+// argument count checks and help output.
+type Command struct {
+	Name        string
+	Description string
+	// Usage lists the positional arguments, e.g. "<user> [reason...]"
+	Usage string
+	// MinArgs is the minimum number of positional arguments
+	MinArgs     int
+	Flags       []Flag
+	Subcommands []*Command
+	Run         func(ctx *Context) error
 
-// RegisterHandler registers a handler for a command
+	parent *Command
+}
+
+// Context is passed to Command.Run
+type Context struct {
+	Command *Command
+	// Args holds the positional arguments, flags removed
+	Args []string
+	// Out receives the command output
+	Out   io.Writer
+	flags map[string]any
+}
+
+// Registry to hold all commands
+var commands = make(map[string]*Command)
+
+// Register registers a command and its subcommands
+func Register(cmd *Command) {
+	cmd.link(nil)
+	commands[strings.ToLower(cmd.Name)] = cmd
+}
+
+// RegisterHandler registers a plain handler for a command
 func RegisterHandler(command string, handler Handler) {
-	handlers[strings.ToLower(command)] = handler
+	Register(&Command{
+		Name: command,
+		Run: func(ctx *Context) error {
+			return handler.Execute(ctx.Args)
+		},
+	})
 }
 
-// ParseAndExecute parses the input and executes the corresponding handler
-// Command format: "help arg1 arg2 ..."
-func ParseAndExecute(input string) error {
-	parts := strings.Fields(input)
+func (c *Command) link(parent *Command) {
+	c.parent = parent
+	for _, sub := range c.Subcommands {
+		sub.link(c)
+	}
+}
+
+// Path returns the full command name, e.g. "role assign"
+func (c *Command) Path() string {
+	if c.parent == nil {
+		return c.Name
+	}
+	return c.parent.Path() + " " + c.Name
+}
+
+// Synopsis returns the one line usage of the command
+func (c *Command) Synopsis() string {
+	parts := []string{c.Path()}
+	if len(c.Subcommands) > 0 {
+		names := make([]string, 0, len(c.Subcommands))
+		for _, sub := range c.sortedSubcommands() {
+			names = append(names, sub.Name)
+		}
+		parts = append(parts, "<"+strings.Join(names, "|")+">")
+	}
+	if len(c.Flags) > 0 {
+		parts = append(parts, "[flags]")
+	}
+	if c.Usage != "" {
+		parts = append(parts, c.Usage)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Subcommand returns the subcommand with the given name
+func (c *Command) Subcommand(name string) *Command {
+	for _, sub := range c.Subcommands {
+		if sub.Name == strings.ToLower(name) {
+			return sub
+		}
+	}
+	return nil
+}
+
+func (c *Command) sortedSubcommands() []*Command {
+	subs := append([]*Command{}, c.Subcommands...)
+	sort.Slice(subs, func(i, j int) bool { return subs[i].Name < subs[j].Name })
+	return subs
+}
+
+// execute dispatches to a subcommand or parses the flags and runs the command
+func (c *Command) execute(args []string, out io.Writer) error {
+	if len(c.Subcommands) > 0 {
+		if len(args) == 0 {
+			return fmt.Errorf("usage: %s", c.Synopsis())
+		}
+		sub := c.Subcommand(args[0])
+		if sub == nil {
+			return fmt.Errorf("unknown subcommand: %s", args[0])
+		}
+		return sub.execute(args[1:], out)
+	}
+	if c.Run == nil {
+		return fmt.Errorf("command %s is not runnable", c.Path())
+	}
+	flags, positional, err := c.parseFlags(args)
+	if err != nil {
+		return err
+	}
+	if len(positional) < c.MinArgs {
+		return fmt.Errorf("usage: %s", c.Synopsis())
+	}
+	return c.Run(&Context{Command: c, Args: positional, Out: out, flags: flags})
+}
+
+// Lookup returns the registered command with the given name
+func Lookup(name string) (*Command, bool) {
+	cmd, ok := commands[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// Run parses the input line and executes the command, writing its output to out
+// Arguments are split like a shell: quotes and backslashes can be used to keep spaces
+func Run(input string, out io.Writer) error {
+	parts, err := SplitArgs(input)
+	if err != nil {
+		return err
+	}
 	if len(parts) == 0 {
 		return fmt.Errorf("no command provided")
 	}
-	cmd := strings.ToLower(parts[0])
-	handler, ok := handlers[cmd]
+	cmd, ok := Lookup(parts[0])
 	if !ok {
-		return fmt.Errorf("unknown command: %s", cmd)
+		return fmt.Errorf("unknown command: %s", strings.ToLower(parts[0]))
 	}
-	// Pass all arguments after the command as args (can be multiple)
-	return handler.Execute(parts[1:])
+	return cmd.execute(parts[1:], out)
+}
+
+// ParseAndExecute parses the input and executes the corresponding command on stdout
+// Command format: "help arg1 arg2 ..."
+func ParseAndExecute(input string) error {
+	return Run(input, os.Stdout)
 }
 
+// ListCommands returns the names of all registered commands, sorted
 func ListCommands() []string {
-	cmds := make([]string, 0, len(handlers))
-	for cmd := range handlers {
+	cmds := make([]string, 0, len(commands))
+	for cmd := range commands {
 		cmds = append(cmds, cmd)
 	}
+	sort.Strings(cmds)
 	return cmds
-}
\ No newline at end of file
+}
+
+// Printf writes formatted output of the command
+func (ctx *Context) Printf(format string, a ...any) {
+	_, _ = fmt.Fprintf(ctx.Out, format, a...)
+}
+
+// Println writes a line of output of the command
+func (ctx *Context) Println(a ...any) {
+	_, _ = fmt.Fprintln(ctx.Out, a...)
+}
@@ -2,19 +2,83 @@ package command
 
 import (
 	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
 )
 
-// helpHandler implements the Handler interface for the "help" command
-type helpHandler struct{}
-
-func (h *helpHandler) Execute(args []string) error {
-	fmt.Println("Available commands:")
-	for _, cmd := range ListCommands() {
-		fmt.Println(" -", cmd)
+// help prints the command list or the usage of a command
+// Usage:
+//
+//	help
+//	help <command> [subcommand...]
+func help(ctx *Context) error {
+	if len(ctx.Args) == 0 {
+		ctx.Println("Available commands:")
+		tw := tabwriter.NewWriter(ctx.Out, 0, 4, 2, ' ', 0)
+		for _, name := range ListCommands() {
+			cmd, _ := Lookup(name)
+			_, _ = fmt.Fprintf(tw, " - %s\t%s\n", name, cmd.Description)
+		}
+		_ = tw.Flush()
+		ctx.Println(`Run "help <command>" for details.`)
+		return nil
+	}
+	cmd, ok := Lookup(ctx.Args[0])
+	if !ok {
+		return fmt.Errorf("unknown command: %s", ctx.Args[0])
+	}
+	for _, name := range ctx.Args[1:] {
+		sub := cmd.Subcommand(name)
+		if sub == nil {
+			return fmt.Errorf("unknown subcommand: %s", name)
+		}
+		cmd = sub
 	}
+	printUsage(ctx.Out, cmd)
 	return nil
 }
 
+// printUsage prints the usage, description, flags and subcommands of a command
+func printUsage(out io.Writer, cmd *Command) {
+	_, _ = fmt.Fprintln(out, "Usage:", cmd.Synopsis())
+	if cmd.Description != "" {
+		_, _ = fmt.Fprintln(out)
+		_, _ = fmt.Fprintln(out, cmd.Description)
+	}
+	tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	if len(cmd.Flags) > 0 {
+		_, _ = fmt.Fprintln(tw, "\nFlags:")
+		for _, f := range cmd.Flags {
+			names := "    --" + f.Name
+			if f.Short != "" {
+				names = "-" + f.Short + ", --" + f.Name
+			}
+			if f.Type != BoolFlag {
+				names += " <" + f.Type.String() + ">"
+			}
+			line := f.Usage
+			if f.Default != "" {
+				line += " (default " + f.Default + ")"
+			}
+			_, _ = fmt.Fprintf(tw, "  %s\t%s\n", names, line)
+		}
+	}
+	if len(cmd.Subcommands) > 0 {
+		_, _ = fmt.Fprintln(tw, "\nSubcommands:")
+		for _, sub := range cmd.sortedSubcommands() {
+			usage := strings.TrimPrefix(sub.Synopsis(), cmd.Path()+" ")
+			_, _ = fmt.Fprintf(tw, "  %s\t%s\n", usage, sub.Description)
+		}
+	}
+	_ = tw.Flush()
+}
+
 func init() {
-	RegisterHandler("help", &helpHandler{})
-}
\ No newline at end of file
+	Register(&Command{
+		Name:        "help",
+		Description: "Show available commands or the usage of a command",
+		Usage:       "[command] [subcommand...]",
+		Run:         help,
+	})
+}
@@ -0,0 +1,57 @@
+package command
+
+import (
+	"fmt"
+	"goauthx/internal/web/account/jwts"
+)
+
+func init() {
+	Register(&Command{
+		Name:        "jwtkeys",
+		Description: "Manage the JWT signing keys",
+		Subcommands: []*Command{
+			{
+				Name:        "list",
+				Description: "List signing keys",
+				Run: func(ctx *Context) error {
+					keys, err := jwts.ListKeys()
+					if err != nil {
+						return err
+					}
+					for _, k := range keys {
+						line := fmt.Sprintf(" - %s %s %s created=%s", k.KID, k.Algorithm, k.Status, k.CreatedAt.Format("2006-01-02 15:04:05"))
+						if k.RetiredAt != nil {
+							line += " retired=" + k.RetiredAt.Format("2006-01-02 15:04:05")
+						}
+						ctx.Println(line)
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "rotate",
+				Description: "Generate a new signing key and retire the current one",
+				Run: func(ctx *Context) error {
+					kid, err := jwts.RotateKeys()
+					if err != nil {
+						return err
+					}
+					ctx.Println("New signing key:", kid)
+					return nil
+				},
+			},
+			{
+				Name:        "prune",
+				Description: "Delete retired keys older than the maximum token lifetime",
+				Run: func(ctx *Context) error {
+					n, err := jwts.PruneKeys()
+					if err != nil {
+						return err
+					}
+					ctx.Printf("Pruned %d retired key(s)\n", n)
+					return nil
+				},
+			},
+		},
+	})
+}
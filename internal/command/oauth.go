@@ -0,0 +1,101 @@
+package command
+
+import (
+	"goauthx/internal/oauth"
+	"strings"
+)
+
+func init() {
+	Register(&Command{
+		Name:        "oauthclient",
+		Description: "Manage OAuth 2.0 clients",
+		Subcommands: []*Command{
+			{
+				Name:        "create",
+				Description: "Register a client, the secret of a confidential client is shown only once",
+				Usage:       "<name> <redirect_uri[,redirect_uri...]>",
+				MinArgs:     2,
+				Flags: []Flag{
+					{Name: "scope", Short: "s", Type: StringFlag, Usage: "comma separated scopes the client may request, default openid,profile,email"},
+					{Name: "public", Type: BoolFlag, Usage: "public client (SPA, mobile app) without a secret, PKCE required"},
+					{Name: "trusted", Type: BoolFlag, Usage: "first-party client, the consent page is skipped"},
+				},
+				Run: func(ctx *Context) error {
+					var scopes []string
+					if ctx.IsSet("scope") {
+						scopes = splitList(ctx.String("scope"))
+					}
+					client, secret, err := oauth.CreateClient(ctx.Args[0], splitList(ctx.Args[1]), scopes, ctx.Bool("public"), ctx.Bool("trusted"))
+					if err != nil {
+						return err
+					}
+					ctx.Println("client_id:", client.ClientID)
+					if secret != "" {
+						ctx.Println("client_secret:", secret, "(shown only once)")
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "list",
+				Description: "List clients",
+				Run: func(ctx *Context) error {
+					clients, err := oauth.ListClients()
+					if err != nil {
+						return err
+					}
+					for _, c := range clients {
+						kind := "confidential"
+						if c.IsPublic() {
+							kind = "public"
+						}
+						if c.Trusted {
+							kind += ",trusted"
+						}
+						ctx.Printf(" - %s %q [%s] redirect=%s scope=%s\n",
+							c.ClientID, c.Name, kind, strings.Join(c.RedirectURIs, ","), strings.Join(c.Scopes, " "))
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "delete",
+				Description: "Delete a client",
+				Usage:       "<client_id>",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					if err := oauth.DeleteClient(ctx.Args[0]); err != nil {
+						return err
+					}
+					ctx.Println("Deleted client", ctx.Args[0])
+					return nil
+				},
+			},
+			{
+				Name:        "secret",
+				Description: "Rotate the secret of a confidential client",
+				Usage:       "<client_id>",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					secret, err := oauth.RotateClientSecret(ctx.Args[0])
+					if err != nil {
+						return err
+					}
+					ctx.Println("client_secret:", secret, "(shown only once)")
+					return nil
+				},
+			},
+		},
+	})
+}
+
+// splitList splits a comma separated argument, dropping empty items
+func splitList(s string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,67 @@
+package command
+
+import (
+	"encoding/base64"
+	"fmt"
+	"goauthx/internal/account"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register(&Command{
+		Name:        "passkey",
+		Description: "Manage the WebAuthn passkeys of users",
+		Subcommands: []*Command{
+			{
+				Name:        "list",
+				Description: "List the passkeys of a user",
+				Usage:       "<user>",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					user, err := findUser(ctx.Args[0])
+					if err != nil {
+						return err
+					}
+					if len(user.WebAuthnCredentials) == 0 {
+						ctx.Printf("%s (%d) has no passkeys\n", user.Username, user.UserId)
+						return nil
+					}
+					for _, c := range user.WebAuthnCredentials {
+						line := fmt.Sprintf(" - %s name=%q alg=%d created=%s", base64.RawURLEncoding.EncodeToString(c.ID),
+							c.Name, c.Algorithm, c.CreatedAt.Format(time.DateTime))
+						if c.LastUsedAt != nil {
+							line += " last_used=" + c.LastUsedAt.Format(time.DateTime)
+						}
+						if c.BackupEligible {
+							line += " synced"
+						}
+						ctx.Println(line)
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "delete",
+				Description: "Delete a passkey of a user, the id is shown by passkey list",
+				Usage:       "<user> <id>",
+				MinArgs:     2,
+				Run: func(ctx *Context) error {
+					user, err := findUser(ctx.Args[0])
+					if err != nil {
+						return err
+					}
+					id, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(ctx.Args[1], "="))
+					if err != nil || len(id) == 0 {
+						return fmt.Errorf("invalid passkey id: %s", ctx.Args[1])
+					}
+					if err := account.RemoveWebAuthnCredential(user.UserId, id); err != nil {
+						return err
+					}
+					ctx.Printf("Deleted passkey %s of %s (%d)\n", ctx.Args[1], user.Username, user.UserId)
+					return nil
+				},
+			},
+		},
+	})
+}
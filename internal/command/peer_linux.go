@@ -0,0 +1,32 @@
+//go:build linux
+
+package command
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// checkPeer rejects clients whose uid differs from the uid of the server
+func checkPeer(conn *net.UnixConn) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var cred *syscall.Ucred
+	var credErr error
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil {
+		return err
+	}
+	if credErr != nil {
+		return credErr
+	}
+	if uid := os.Getuid(); int(cred.Uid) != uid {
+		return fmt.Errorf("peer uid %d does not match server uid %d", cred.Uid, uid)
+	}
+	return nil
+}
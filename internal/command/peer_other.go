@@ -0,0 +1,11 @@
+//go:build !linux
+
+package command
+
+import "net"
+
+// checkPeer relies on the 0600 permissions of the socket where peer
+// credentials are not available
+func checkPeer(conn *net.UnixConn) error {
+	return nil
+}
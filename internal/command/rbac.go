@@ -0,0 +1,236 @@
+package command
+
+import (
+	"fmt"
+	"goauthx/internal/rbac"
+	"strings"
+)
+
+// <user> can be an email, a numeric id or a username, same as login.
+func init() {
+	Register(&Command{
+		Name:        "role",
+		Description: "Manage roles and role assignments",
+		Subcommands: []*Command{
+			{
+				Name:        "list",
+				Description: "List roles with their permissions",
+				Run: func(ctx *Context) error {
+					roles, err := rbac.ListRoles()
+					if err != nil {
+						return err
+					}
+					for _, r := range roles {
+						line := fmt.Sprintf(" - %s [%s]", r.Name, strings.Join(r.Permissions, ","))
+						if r.BuiltIn {
+							line += " (built-in)"
+						}
+						if r.Description != "" {
+							line += " " + r.Description
+						}
+						ctx.Println(line)
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "show",
+				Description: "Show a role and the users having it",
+				Usage:       "<role>",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					role, err := rbac.GetRole(ctx.Args[0])
+					if err != nil {
+						return err
+					}
+					users, err := rbac.RoleUsers(role.Name)
+					if err != nil {
+						return err
+					}
+					ctx.Println("Role:", role.Name)
+					ctx.Println("Description:", role.Description)
+					ctx.Println("Permissions:", strings.Join(role.Permissions, ", "))
+					ctx.Println("Users:", joinInts(users))
+					return nil
+				},
+			},
+			{
+				Name:        "create",
+				Description: "Create a role",
+				Usage:       "<role> [permission,permission...] [description...]",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					var perms []string
+					var desc string
+					if len(ctx.Args) > 1 {
+						perms = splitList(ctx.Args[1])
+						desc = strings.Join(ctx.Args[2:], " ")
+					}
+					if err := rbac.CreateRole(ctx.Args[0], desc, perms); err != nil {
+						return err
+					}
+					ctx.Println("Created role", ctx.Args[0])
+					return nil
+				},
+			},
+			{
+				Name:        "delete",
+				Description: "Delete a role and its assignments",
+				Usage:       "<role>",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					if err := rbac.DeleteRole(ctx.Args[0]); err != nil {
+						return err
+					}
+					ctx.Println("Deleted role", ctx.Args[0])
+					return nil
+				},
+			},
+			{
+				Name:        "grant",
+				Description: "Grant permissions to a role",
+				Usage:       "<role> <permission,permission...>",
+				MinArgs:     2,
+				Run: func(ctx *Context) error {
+					if err := rbac.GrantPermissions(ctx.Args[0], splitList(ctx.Args[1])); err != nil {
+						return err
+					}
+					ctx.Println("Updated permissions of", ctx.Args[0])
+					return nil
+				},
+			},
+			{
+				Name:        "revoke",
+				Description: "Revoke permissions from a role",
+				Usage:       "<role> <permission,permission...>",
+				MinArgs:     2,
+				Run: func(ctx *Context) error {
+					if err := rbac.RevokePermissions(ctx.Args[0], splitList(ctx.Args[1])); err != nil {
+						return err
+					}
+					ctx.Println("Updated permissions of", ctx.Args[0])
+					return nil
+				},
+			},
+			{
+				Name:        "assign",
+				Description: "Assign a role to a user",
+				Usage:       "<user> <role>",
+				MinArgs:     2,
+				Run: func(ctx *Context) error {
+					user, err := findUser(ctx.Args[0])
+					if err != nil {
+						return err
+					}
+					if err := rbac.AssignRole(int(user.UserId), ctx.Args[1]); err != nil {
+						return err
+					}
+					ctx.Printf("Assigned role %s to %s (%d)\n", ctx.Args[1], user.Username, user.UserId)
+					return nil
+				},
+			},
+			{
+				Name:        "unassign",
+				Description: "Remove a role from a user",
+				Usage:       "<user> <role>",
+				MinArgs:     2,
+				Run: func(ctx *Context) error {
+					user, err := findUser(ctx.Args[0])
+					if err != nil {
+						return err
+					}
+					removed, err := rbac.UnassignRole(int(user.UserId), ctx.Args[1])
+					if err != nil {
+						return err
+					}
+					if !removed {
+						return fmt.Errorf("%s does not have role %s", user.Username, ctx.Args[1])
+					}
+					ctx.Printf("Removed role %s from %s (%d)\n", ctx.Args[1], user.Username, user.UserId)
+					return nil
+				},
+			},
+			{
+				Name:        "user",
+				Description: "Show the roles of a user",
+				Usage:       "<user>",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					user, err := findUser(ctx.Args[0])
+					if err != nil {
+						return err
+					}
+					roles, err := rbac.UserRoles(int(user.UserId))
+					if err != nil {
+						return err
+					}
+					ctx.Printf("%s (%d): %s\n", user.Username, user.UserId, strings.Join(roles, ", "))
+					return nil
+				},
+			},
+		},
+	})
+
+	Register(&Command{
+		Name:        "permission",
+		Description: "Manage permissions",
+		Subcommands: []*Command{
+			{
+				Name:        "list",
+				Description: "List permissions",
+				Run: func(ctx *Context) error {
+					perms, err := rbac.ListPermissions()
+					if err != nil {
+						return err
+					}
+					for _, p := range perms {
+						line := " - " + p.Name
+						if p.BuiltIn {
+							line += " (built-in)"
+						}
+						if p.Description != "" {
+							line += " " + p.Description
+						}
+						ctx.Println(line)
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "create",
+				Description: "Create a custom permission for downstream services",
+				Usage:       "<name> [description...]",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					if err := rbac.CreatePermission(ctx.Args[0], strings.Join(ctx.Args[1:], " ")); err != nil {
+						return err
+					}
+					ctx.Println("Created permission", ctx.Args[0])
+					return nil
+				},
+			},
+			{
+				Name:        "delete",
+				Description: "Delete a custom permission",
+				Usage:       "<name>",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					if err := rbac.DeletePermission(ctx.Args[0]); err != nil {
+						return err
+					}
+					ctx.Println("Deleted permission", ctx.Args[0])
+					return nil
+				},
+			},
+		},
+	})
+}
+
+// joinInts formats a list of ids separated by commas
+func joinInts(ids []int) string {
+	items := make([]string, 0, len(ids))
+	for _, id := range ids {
+		items = append(items, fmt.Sprint(id))
+	}
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,135 @@
+package command
+
+import (
+	"goauthx/internal/oauth"
+	"goauthx/internal/web/account/jwts"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register(&Command{
+		Name:        "serviceaccount",
+		Description: "Manage service accounts for the client_credentials grant",
+		Subcommands: []*Command{
+			{
+				Name:        "create",
+				Description: "Create a service account, the secret is shown only once",
+				Usage:       "<name> [scope,scope...]",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					var scopes []string
+					if len(ctx.Args) > 1 {
+						scopes = splitList(ctx.Args[1])
+					}
+					sa, secret, err := oauth.CreateServiceAccount(ctx.Args[0], scopes)
+					if err != nil {
+						return err
+					}
+					ctx.Println("client_id:", sa.ID)
+					ctx.Println("client_secret:", secret, "(shown only once)")
+					return nil
+				},
+			},
+			{
+				Name:        "list",
+				Description: "List service accounts",
+				Run: func(ctx *Context) error {
+					accounts, err := oauth.ListServiceAccounts()
+					if err != nil {
+						return err
+					}
+					for _, sa := range accounts {
+						status := "enabled"
+						if sa.Disabled {
+							status = "disabled"
+						}
+						lastUsed := "never"
+						if sa.LastUsedAt != nil {
+							lastUsed = sa.LastUsedAt.Format(time.RFC3339)
+						}
+						ctx.Printf(" - %s %q [%s] scope=%s last_used=%s\n",
+							sa.ID, sa.Name, status, strings.Join(sa.Scopes, " "), lastUsed)
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "scopes",
+				Description: "Replace the allowed scopes of a service account",
+				Usage:       "<id> <scope,scope...>",
+				MinArgs:     2,
+				Run: func(ctx *Context) error {
+					if err := oauth.SetServiceAccountScopes(ctx.Args[0], splitList(ctx.Args[1])); err != nil {
+						return err
+					}
+					ctx.Println("Updated scopes of", ctx.Args[0])
+					return nil
+				},
+			},
+			{
+				Name:        "secret",
+				Description: "Rotate the secret of a service account",
+				Usage:       "<id>",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					secret, err := oauth.RotateServiceAccountSecret(ctx.Args[0])
+					if err != nil {
+						return err
+					}
+					ctx.Println("client_secret:", secret, "(shown only once)")
+					return nil
+				},
+			},
+			{
+				Name:        "disable",
+				Description: "Disable a service account and revoke its tokens",
+				Usage:       "<id>",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					id := ctx.Args[0]
+					if err := oauth.SetServiceAccountDisabled(id, true); err != nil {
+						return err
+					}
+					revoked, err := jwts.RemoveServiceJWTs(id)
+					if err != nil {
+						return err
+					}
+					ctx.Printf("Disabled %s, revoked %d token(s)\n", id, revoked)
+					return nil
+				},
+			},
+			{
+				Name:        "enable",
+				Description: "Enable a disabled service account",
+				Usage:       "<id>",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					if err := oauth.SetServiceAccountDisabled(ctx.Args[0], false); err != nil {
+						return err
+					}
+					ctx.Println("Enabled", ctx.Args[0])
+					return nil
+				},
+			},
+			{
+				Name:        "delete",
+				Description: "Delete a service account and revoke its tokens",
+				Usage:       "<id>",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					id := ctx.Args[0]
+					if err := oauth.DeleteServiceAccount(id); err != nil {
+						return err
+					}
+					revoked, err := jwts.RemoveServiceJWTs(id)
+					if err != nil {
+						return err
+					}
+					ctx.Printf("Deleted %s, revoked %d token(s)\n", id, revoked)
+					return nil
+				},
+			},
+		},
+	})
+}
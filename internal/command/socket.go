@@ -0,0 +1,166 @@
+package command
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Remote console protocol: the client sends one command line per line,
+// the server streams the command output followed by a status trailer:
+// a NUL byte, then "OK" or "ERR <message>", then a newline.
+const (
+	statusMarker = '\x00'
+	statusOK     = "OK"
+	statusError  = "ERR "
+)
+
+// ErrRemoteCommand wraps errors reported by the server for a command
+var ErrRemoteCommand = errors.New("command failed")
+
+// ServeSocket serves the command registry on a Unix domain socket that only
+// the current user can connect to. A stale socket left by a previous run is
+// removed; if another instance is still listening an error is returned.
+func ServeSocket(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+			return fmt.Errorf("console socket %s is in use by another instance", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	ln, err := listenPrivate(path)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(path)
+	defer ln.Close()
+	log.Printf("Console listening on unix:%s\n", path)
+	for {
+		conn, err := ln.AcceptUnix()
+		if err != nil {
+			return err
+		}
+		go serveConn(conn)
+	}
+}
+
+// listenPrivate creates the socket inside a temporary 0700 directory, restricts
+// it to 0600 and only then moves it to path, so it is never reachable with the
+// permissions of the process umask.
+func listenPrivate(path string) (*net.UnixListener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".console-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	tmp := filepath.Join(dir, "console.sock")
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: tmp, Net: "unix"})
+	if err != nil {
+		return nil, err
+	}
+	// the socket is renamed, ServeSocket removes it from its final path
+	ln.SetUnlinkOnClose(false)
+	if err := os.Chmod(tmp, 0600); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// serveConn executes the commands of one client, output goes to the connection
+func serveConn(conn *net.UnixConn) {
+	defer conn.Close()
+	if err := checkPeer(conn); err != nil {
+		log.Printf("Console connection rejected: %v\n", err)
+		return
+	}
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		input := strings.TrimSpace(scanner.Text())
+		if input == "" {
+			continue
+		}
+		status := statusOK
+		if err := Run(input, conn); err != nil {
+			// 状态行只有一行
+			status = statusError + strings.ReplaceAll(err.Error(), "\n", " ")
+		}
+		if _, err := fmt.Fprintf(conn, "%c%s\n", statusMarker, status); err != nil {
+			return
+		}
+	}
+}
+
+// Client is a connection to the remote console
+type Client struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// Dial connects to the remote console socket
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, reader: bufio.NewReader(conn)}, nil
+}
+
+// Execute sends a command line and copies its output to out. An error
+// reported by the server is returned wrapped in ErrRemoteCommand.
+func (c *Client) Execute(input string, out io.Writer) error {
+	if strings.ContainsAny(input, "\r\n") {
+		return fmt.Errorf("command must be a single line")
+	}
+	if _, err := fmt.Fprintln(c.conn, input); err != nil {
+		return err
+	}
+	output, err := c.reader.ReadString(statusMarker)
+	if _, werr := io.WriteString(out, strings.TrimSuffix(output, string(statusMarker))); werr != nil {
+		return werr
+	}
+	if err != nil {
+		return err
+	}
+	status, err := c.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	status = strings.TrimSuffix(status, "\n")
+	if status == statusOK {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrRemoteCommand, strings.TrimPrefix(status, statusError))
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// QuoteArgs joins arguments into a command line that SplitArgs splits back
+// into the same arguments
+func QuoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if arg != "" && !strings.ContainsAny(arg, " \t\r\n'\"\\") {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,296 @@
+package command
+
+import (
+	"fmt"
+	"goauthx/internal/account"
+	"goauthx/internal/passhash"
+	"goauthx/internal/rbac"
+	"goauthx/internal/web/account/jwts"
+	"goauthx/internal/web/account/pat"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// <user> can be an email, a numeric id or a username, same as login.
+func init() {
+	Register(&Command{
+		Name:        "user",
+		Description: "Manage user accounts",
+		Subcommands: []*Command{
+			{
+				Name:        "create",
+				Description: "Create a user without a captcha, a verification link is sent to the email",
+				Usage:       "<username> <email> <password>",
+				MinArgs:     3,
+				Flags: []Flag{
+					{Name: "verified", Type: BoolFlag, Usage: "mark the email as verified and send no verification link"},
+				},
+				Run: func(ctx *Context) error {
+					if !account.IsEmail(ctx.Args[1]) {
+						return fmt.Errorf("invalid email: %s", ctx.Args[1])
+					}
+					resp, _ := account.RegisterUser(&account.RegisterRequest{
+						Username:      ctx.Args[0],
+						Email:         ctx.Args[1],
+						Password:      ctx.Args[2],
+						EmailVerified: ctx.Bool("verified"),
+					})
+					if resp.Code != 0 {
+						return fmt.Errorf("%s", resp.Message)
+					}
+					ctx.Printf("Created user %s (%d)\n", strings.ToLower(ctx.Args[0]), resp.UserID)
+					if ctx.Bool("verified") {
+						return nil
+					}
+					user, err := account.FindUserByID(resp.UserID)
+					if err == nil {
+						err = account.SendVerificationEmail(user)
+					}
+					if err != nil {
+						// The account exists, the link can be sent again with user verify --send
+						ctx.Printf("Warning: verification email not sent: %v\n", err)
+						return nil
+					}
+					ctx.Println("Verification email sent to", user.Email)
+					return nil
+				},
+			},
+			{
+				Name:        "import",
+				Description: "Import users from a JSONL or CSV file, foreign password hashes are rehashed on first login",
+				Usage:       "<file>",
+				MinArgs:     1,
+				Flags: []Flag{
+					{Name: "format", Short: "f", Type: StringFlag, Usage: "jsonl or csv, default from the file extension"},
+					{Name: "password-format", Short: "p", Type: StringFlag, Usage: "hash format for records without password_format: " + strings.Join(passhash.ImportFormats, ", ")},
+					{Name: "keep-ids", Type: BoolFlag, Usage: "keep the id of each record instead of allocating new ids"},
+					{Name: "dry-run", Type: BoolFlag, Usage: "validate the file without importing"},
+				},
+				Run: func(ctx *Context) error {
+					format := ctx.String("format")
+					if format == "" {
+						format = account.ImportJSONL
+						if strings.EqualFold(filepath.Ext(ctx.Args[0]), ".csv") {
+							format = account.ImportCSV
+						}
+					}
+					file, err := os.Open(ctx.Args[0])
+					if err != nil {
+						return err
+					}
+					defer file.Close()
+					result, err := account.ImportUsers(file, account.ImportOptions{
+						Format:         format,
+						PasswordFormat: ctx.String("password-format"),
+						KeepIDs:        ctx.Bool("keep-ids"),
+						DryRun:         ctx.Bool("dry-run"),
+					})
+					if result != nil {
+						for _, e := range result.Errors {
+							ctx.Printf(" - line %d: %s\n", e.Line, e.Message)
+						}
+						if hidden := result.Skipped + result.Failed - len(result.Errors); hidden > 0 {
+							ctx.Printf(" - ... %d more\n", hidden)
+						}
+						verb := "Imported"
+						if ctx.Bool("dry-run") {
+							verb = "Validated"
+						}
+						ctx.Printf("%s %d of %d user(s), %d skipped, %d failed\n", verb, result.Imported, result.Total, result.Skipped, result.Failed)
+					}
+					return err
+				},
+			},
+			{
+				Name:        "show",
+				Description: "Show a user with roles, ban status, sessions and tokens",
+				Usage:       "<user>",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					user, err := findUser(ctx.Args[0])
+					if err != nil {
+						return err
+					}
+					return showUser(ctx, user)
+				},
+			},
+			{
+				Name:        "passwd",
+				Description: "Set the password of a user, log out all of its sessions and revoke its personal access tokens",
+				Usage:       "<user> <new password>",
+				MinArgs:     2,
+				Run: func(ctx *Context) error {
+					user, err := findUser(ctx.Args[0])
+					if err != nil {
+						return err
+					}
+					password := ctx.Args[1]
+					resp, _ := account.UpdateUser(user.UserId, &account.UpdateUserRequest{Password: &password})
+					if resp.Code != 0 {
+						return fmt.Errorf("%s", resp.Message)
+					}
+					tokens, err := pat.RevokeUserTokens(int(user.UserId))
+					if err != nil {
+						return fmt.Errorf("password changed but revoking personal access tokens failed: %w", err)
+					}
+					ctx.Printf("Password of %s (%d) changed, all sessions logged out, %d personal access token(s) revoked\n", user.Username, user.UserId, tokens)
+					return nil
+				},
+			},
+			{
+				Name:        "verify",
+				Description: "Mark the email of a user as verified, or send a new verification link",
+				Usage:       "<user>",
+				MinArgs:     1,
+				Flags: []Flag{
+					{Name: "send", Type: BoolFlag, Usage: "send a verification link instead of marking the email verified"},
+				},
+				Run: func(ctx *Context) error {
+					user, err := findUser(ctx.Args[0])
+					if err != nil {
+						return err
+					}
+					if user.IsEmailVerified() {
+						return fmt.Errorf("email of %s (%d) is already verified", user.Username, user.UserId)
+					}
+					if ctx.Bool("send") {
+						if err := account.SendVerificationEmail(user); err != nil {
+							return err
+						}
+						ctx.Println("Verification email sent to", user.Email)
+						return nil
+					}
+					if err := account.SetEmailVerified(user.UserId, true); err != nil {
+						return err
+					}
+					ctx.Printf("Email %s of %s (%d) marked as verified\n", user.Email, user.Username, user.UserId)
+					return nil
+				},
+			},
+			{
+				Name:        "delete",
+				Description: "Delete a user with its sessions, personal access tokens and roles",
+				Usage:       "<user>",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					user, err := findUser(ctx.Args[0])
+					if err != nil {
+						return err
+					}
+					if err := account.DeleteUser(user.UserId); err != nil {
+						return err
+					}
+					tokens, err := pat.RevokeUserTokens(int(user.UserId))
+					if err != nil {
+						return fmt.Errorf("user deleted but revoking personal access tokens failed: %w", err)
+					}
+					ctx.Printf("Deleted user %s (%d), %d personal access token(s) revoked\n", user.Username, user.UserId, tokens)
+					return nil
+				},
+			},
+			{
+				Name:        "sessions",
+				Description: "List the active sessions of a user",
+				Usage:       "<user>",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					user, err := findUser(ctx.Args[0])
+					if err != nil {
+						return err
+					}
+					sessions, err := jwts.ListUserSessions(int(user.UserId))
+					if err != nil {
+						return err
+					}
+					if len(sessions) == 0 {
+						ctx.Printf("%s (%d) has no active sessions\n", user.Username, user.UserId)
+						return nil
+					}
+					for _, s := range sessions {
+						ctx.Printf(" - %s created=%s expires=%s ip=%s ua=%q\n", s.ID,
+							s.CreatedAt.Format(time.DateTime), s.ExpiresAt.Format(time.DateTime), s.IP, s.UserAgent)
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "kick",
+				Description: "Log out one session of a user, or all sessions when no id is given",
+				Usage:       "<user> [session id]",
+				MinArgs:     1,
+				Run: func(ctx *Context) error {
+					user, err := findUser(ctx.Args[0])
+					if err != nil {
+						return err
+					}
+					if len(ctx.Args) > 1 {
+						removed, err := jwts.RemoveUserSession(int(user.UserId), ctx.Args[1])
+						if err != nil {
+							return err
+						}
+						if !removed {
+							return fmt.Errorf("session not found: %s", ctx.Args[1])
+						}
+						ctx.Printf("Logged out session %s of %s (%d)\n", ctx.Args[1], user.Username, user.UserId)
+						return nil
+					}
+					jwts.RemoveUserJWTsFromWhitelist(int(user.UserId))
+					ctx.Printf("Logged out all sessions of %s (%d)\n", user.Username, user.UserId)
+					return nil
+				},
+			},
+		},
+	})
+}
+
+// findUser looks up a user by email, numeric id or username
+func findUser(login string) (*account.UserDoc, error) {
+	user, err := account.FindUserByLogin(login)
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %s", login)
+	}
+	return user, nil
+}
+
+// showUser prints the account details of a user
+func showUser(ctx *Context, user *account.UserDoc) error {
+	userID := int(user.UserId)
+	roles, err := rbac.UserRoles(userID)
+	if err != nil {
+		return err
+	}
+	banned, ban, err := account.IsUserBanned(userID)
+	if err != nil {
+		return err
+	}
+	sessions, err := jwts.ListUserSessions(userID)
+	if err != nil {
+		return err
+	}
+	tokens, err := pat.ListTokens(userID)
+	if err != nil {
+		return err
+	}
+	ctx.Println("ID:", user.UserId)
+	ctx.Println("Username:", user.Username)
+	ctx.Println("Email:", user.Email)
+	if user.EmailVerifiedAt != nil {
+		ctx.Println("Email verified:", user.EmailVerifiedAt.Format(time.DateTime))
+	} else {
+		ctx.Println("Email verified:", user.IsEmailVerified())
+	}
+	ctx.Println("Created:", user.CreatedAt.Format(time.DateTime))
+	ctx.Println("TOTP:", user.TOTPEnabled)
+	ctx.Println("Passkeys:", len(user.WebAuthnCredentials))
+	ctx.Println("Roles:", strings.Join(roles, ", "))
+	if banned {
+		ctx.Printf("Banned: %s by %s: %s\n", formatBanEnd(ban.BanEnd), formatActor(ban.BannedBy), ban.BanReason)
+	} else {
+		ctx.Println("Banned: false")
+	}
+	ctx.Println("Sessions:", len(sessions))
+	ctx.Println("Personal access tokens:", len(tokens))
+	return nil
+}
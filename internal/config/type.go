@@ -21,13 +21,110 @@ type SMTPConfig struct {
 	Password string `json:"password"`
 }
 
+type JWTConfig struct {
+	// 签名算法：HS256 / RS256 / ES256 / EdDSA
+	Algorithm string `json:"algorithm"`
+	// 非对称算法使用的 PEM 私钥文件，不存在时首次启动自动生成
+	PrivateKeyFile string `json:"private_key_file"`
+	// Access Token 有效期（分钟）
+	AccessTokenTTLMinutes int `json:"access_token_ttl_minutes"`
+	// Refresh Token 有效期（小时），从登录时开始计算，刷新不会延长
+	RefreshTokenTTLHours int `json:"refresh_token_ttl_hours"`
+	// 自动轮换签名密钥的间隔（小时），0 表示只通过控制台命令轮换
+	RotationIntervalHours int `json:"rotation_interval_hours"`
+	// Token 最长有效期（小时），退役密钥超过该时长后被清理
+	MaxTokenLifetimeHours int `json:"max_token_lifetime_hours"`
+	// 加密保存在 MongoDB 中的签名密钥，为空时使用 jwt_secret；修改后已保存的密钥无法解密
+	KeyEncryptionSecret string `json:"key_encryption_secret"`
+}
+
+type OAuthConfig struct {
+	// OIDC 签发者地址，如 https://auth.example.com，为空时按请求的 Host 推断
+	Issuer string `json:"issuer"`
+	// 托管登录页登录后浏览器会话的有效期（小时），不能超过 jwt.max_token_lifetime_hours
+	LoginSessionHours int `json:"login_session_hours"`
+}
+
+type EmailVerificationConfig struct {
+	// 开启后未验证邮箱的账号不能登录
+	RequireForLogin bool `json:"require_for_login"`
+	// 验证链接的地址前缀，如 https://auth.example.com，为空时使用 oauth.issuer
+	LinkBaseURL string `json:"link_base_url"`
+	// 验证链接有效期（小时）
+	TokenTTLHours int `json:"token_ttl_hours"`
+}
+
+type MagicLinkConfig struct {
+	// 是否开放邮箱链接免密登录
+	Enabled bool `json:"enabled"`
+	// 登录链接的地址前缀，如 https://auth.example.com，为空时使用 oauth.issuer
+	LinkBaseURL string `json:"link_base_url"`
+	// 登录链接有效期（分钟）
+	TTLMinutes int `json:"ttl_minutes"`
+}
+
+type WebAuthnConfig struct {
+	// 依赖方ID，即站点域名，如 auth.example.com，为空时使用 oauth.issuer 的域名
+	RPID string `json:"rp_id"`
+	// 认证器中展示的站点名称，为空时使用 name
+	RPName string `json:"rp_name"`
+	// 允许发起注册与登录的来源，如 https://auth.example.com，为空时使用 oauth.issuer
+	Origins []string `json:"origins"`
+	// 注册与登录仪式的超时时间（秒）
+	TimeoutSeconds int `json:"timeout_seconds"`
+}
+
+type Argon2idConfig struct {
+	// 内存（KiB）
+	MemoryKiB   int `json:"memory_kib"`
+	Iterations  int `json:"iterations"`
+	Parallelism int `json:"parallelism"`
+}
+
+type ScryptConfig struct {
+	// CPU/内存开销 N 的对数，N = 2^log_n
+	LogN int `json:"log_n"`
+	R    int `json:"r"`
+	P    int `json:"p"`
+}
+
+// FirebaseScryptConfig Firebase 控制台 "Password hash parameters" 中的项目参数，用于校验导入的哈希
+type FirebaseScryptConfig struct {
+	SignerKey     string `json:"signer_key"`
+	SaltSeparator string `json:"salt_separator"`
+	Rounds        int    `json:"rounds"`
+	MemCost       int    `json:"mem_cost"`
+}
+
+type PasswordHashConfig struct {
+	// 新密码使用的算法：argon2id、scrypt 或 bcrypt，登录时其他算法或参数的哈希会自动升级
+	Algorithm  string         `json:"algorithm"`
+	Argon2id   Argon2idConfig `json:"argon2id"`
+	Scrypt     ScryptConfig   `json:"scrypt"`
+	BcryptCost int            `json:"bcrypt_cost"`
+	// 从 Firebase 导入的哈希使用的项目参数
+	FirebaseScrypt FirebaseScryptConfig `json:"firebase_scrypt"`
+}
+
+type ConsoleConfig struct {
+	// 远程控制台的 Unix 套接字路径，只有启动服务的用户可以连接，为空时不启用
+	SocketPath string `json:"socket_path"`
+}
+
 type Config struct {
-	MongoDB     MongoDBConfig    `json:"mongodb"`
-	HTTPServer  HTTPServerConfig `json:"http_server"`
-	AdminSecret string           `json:"admin_secret"`
-	Name        string           `json:"name"`
-	SMTP        SMTPConfig       `json:"smtp"`
-	JWTSecret   string           `json:"jwt_secret"`
+	MongoDB           MongoDBConfig           `json:"mongodb"`
+	HTTPServer        HTTPServerConfig        `json:"http_server"`
+	AdminSecret       string                  `json:"admin_secret"`
+	Name              string                  `json:"name"`
+	SMTP              SMTPConfig              `json:"smtp"`
+	JWTSecret         string                  `json:"jwt_secret"`
+	JWT               JWTConfig               `json:"jwt"`
+	OAuth             OAuthConfig             `json:"oauth"`
+	Console           ConsoleConfig           `json:"console"`
+	EmailVerification EmailVerificationConfig `json:"email_verification"`
+	MagicLink         MagicLinkConfig         `json:"magic_link"`
+	WebAuthn          WebAuthnConfig          `json:"webauthn"`
+	PasswordHash      PasswordHashConfig      `json:"password_hash"`
 }
 
 func DefaultConfig() *Config {
@@ -51,6 +148,56 @@ func DefaultConfig() *Config {
 			Password: "your_smtp_password",
 		},
 		JWTSecret: "your_jwt_secret",
+		JWT: JWTConfig{
+			Algorithm:             "HS256",
+			PrivateKeyFile:        "./resources/keys/jwt_private.pem",
+			AccessTokenTTLMinutes: 15,
+			RefreshTokenTTLHours:  720,
+			RotationIntervalHours: 0,
+			MaxTokenLifetimeHours: 72,
+			KeyEncryptionSecret:   "",
+		},
+		OAuth: OAuthConfig{
+			Issuer:            "",
+			LoginSessionHours: 12,
+		},
+		Console: ConsoleConfig{
+			SocketPath: "./goauthx.sock",
+		},
+		EmailVerification: EmailVerificationConfig{
+			RequireForLogin: false,
+			LinkBaseURL:     "",
+			TokenTTLHours:   48,
+		},
+		MagicLink: MagicLinkConfig{
+			Enabled:     false,
+			LinkBaseURL: "",
+			TTLMinutes:  10,
+		},
+		WebAuthn: WebAuthnConfig{
+			RPID:           "",
+			RPName:         "",
+			Origins:        []string{},
+			TimeoutSeconds: 300,
+		},
+		PasswordHash: PasswordHashConfig{
+			Algorithm: "argon2id",
+			Argon2id: Argon2idConfig{
+				MemoryKiB:   19456,
+				Iterations:  2,
+				Parallelism: 1,
+			},
+			Scrypt: ScryptConfig{
+				LogN: 17,
+				R:    8,
+				P:    1,
+			},
+			BcryptCost: 10,
+			FirebaseScrypt: FirebaseScryptConfig{
+				Rounds:  8,
+				MemCost: 14,
+			},
+		},
 	}
 }
 
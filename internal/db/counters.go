@@ -48,3 +48,20 @@ func GetNextSequenceValue(counterID string) (int64, error) {
 	}
 	return counterDoc.SequenceValue, nil
 }
+
+// AdvanceSequenceValue 将计数器推进到不小于 value，之后 GetNextSequenceValue 返回的值都大于 value
+// 导入保留原ID的数据后调用，避免新分配的ID与其冲突
+func AdvanceSequenceValue(counterID string, value int64) error {
+	conn, err := GetMongoConnector()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = conn.DB.Collection("counters").UpdateOne(ctx,
+		bson.M{"_id": counterID},
+		bson.M{"$max": bson.M{"sequence_value": value}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
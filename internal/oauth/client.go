@@ -0,0 +1,217 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"goauthx/internal/db"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+var ErrClientNotFound = errors.New("oauth client not found")
+
+// DefaultScopes 注册客户端时未指定 scope 的默认值
+var DefaultScopes = []string{"openid", "profile", "email"}
+
+// Client 已注册的 OAuth 客户端
+type Client struct {
+	ClientID     string    `bson:"_id"`
+	Name         string    `bson:"name"`
+	SecretHash   string    `bson:"secret_hash,omitempty"`
+	RedirectURIs []string  `bson:"redirect_uris"`
+	Scopes       []string  `bson:"scopes"`
+	Trusted      bool      `bson:"trusted"`
+	CreatedAt    time.Time `bson:"created_at"`
+}
+
+// IsPublic 公开客户端（SPA、移动端）没有密钥，必须使用 PKCE
+func (c *Client) IsPublic() bool {
+	return c.SecretHash == ""
+}
+
+// VerifySecret 校验客户端密钥
+func (c *Client) VerifySecret(secret string) bool {
+	if c.IsPublic() || secret == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(c.SecretHash), []byte(secret)) == nil
+}
+
+// HasRedirectURI 回调地址必须与注册时完全一致
+func (c *Client) HasRedirectURI(uri string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsScopes 判断请求的 scope 是否都在客户端允许的范围内
+func (c *Client) AllowsScopes(scopes []string) bool {
+	return scopesAllowed(c.Scopes, scopes)
+}
+
+func scopesAllowed(allowedScopes, scopes []string) bool {
+	allowed := make(map[string]bool, len(allowedScopes))
+	for _, s := range allowedScopes {
+		allowed[s] = true
+	}
+	for _, s := range scopes {
+		if !allowed[s] {
+			return false
+		}
+	}
+	return true
+}
+
+func getClientCollection() (*mongo.Collection, error) {
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return nil, err
+	}
+	return conn.DB.Collection("oauth_clients"), nil
+}
+
+func randomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashSecret(secret string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
+// CreateClient 注册客户端，机密客户端返回密钥明文（仅此一次），公开客户端返回空字符串
+func CreateClient(name string, redirectURIs, scopes []string, public, trusted bool) (*Client, string, error) {
+	idBytes := make([]byte, 12)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", err
+	}
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+	client := &Client{
+		ClientID:     hex.EncodeToString(idBytes),
+		Name:         name,
+		RedirectURIs: redirectURIs,
+		Scopes:       scopes,
+		Trusted:      trusted,
+		CreatedAt:    time.Now(),
+	}
+	var secret string
+	if !public {
+		var err error
+		if secret, err = randomString(32); err != nil {
+			return nil, "", err
+		}
+		if client.SecretHash, err = hashSecret(secret); err != nil {
+			return nil, "", err
+		}
+	}
+	coll, err := getClientCollection()
+	if err != nil {
+		return nil, "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := coll.InsertOne(ctx, client); err != nil {
+		return nil, "", err
+	}
+	return client, secret, nil
+}
+
+// GetClient 按 client_id 查找客户端
+func GetClient(clientID string) (*Client, error) {
+	coll, err := getClientCollection()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var client Client
+	err = coll.FindOne(ctx, bson.M{"_id": clientID}).Decode(&client)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// ListClients 列出所有客户端
+func ListClients() ([]Client, error) {
+	coll, err := getClientCollection()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	clients := make([]Client, 0)
+	if err := cursor.All(ctx, &clients); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// DeleteClient 删除客户端
+func DeleteClient(clientID string) error {
+	coll, err := getClientCollection()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := coll.DeleteOne(ctx, bson.M{"_id": clientID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrClientNotFound
+	}
+	return nil
+}
+
+// RotateClientSecret 重新生成机密客户端的密钥，返回新密钥明文
+func RotateClientSecret(clientID string) (string, error) {
+	secret, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	hashed, err := hashSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	coll, err := getClientCollection()
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := coll.UpdateOne(ctx, bson.M{"_id": clientID}, bson.M{"$set": bson.M{"secret_hash": hashed}})
+	if err != nil {
+		return "", err
+	}
+	if res.MatchedCount == 0 {
+		return "", ErrClientNotFound
+	}
+	return secret, nil
+}
@@ -0,0 +1,86 @@
+package oauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"github.com/patrickmn/go-cache"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// 授权码有效期很短且只能使用一次，存放在内存中
+	codeCache = cache.New(time.Minute, 5*time.Minute)
+	codeMu    sync.Mutex
+)
+
+// AuthorizationCode 授权码对应的授权信息
+type AuthorizationCode struct {
+	ClientID    string
+	UserID      int
+	RedirectURI string
+	// RedirectURIProvided 授权请求中是否携带了 redirect_uri，携带时换取 Token 必须传相同的值
+	RedirectURIProvided bool
+	Scope               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	AuthTime            time.Time
+	UserAgent           string
+	IP                  string
+}
+
+// NewAuthorizationCode 生成授权码
+func NewAuthorizationCode(ac *AuthorizationCode) (string, error) {
+	code, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	codeCache.Set(code, ac, cache.DefaultExpiration)
+	return code, nil
+}
+
+// ConsumeAuthorizationCode 取出并作废授权码
+func ConsumeAuthorizationCode(code string) (*AuthorizationCode, bool) {
+	codeMu.Lock()
+	defer codeMu.Unlock()
+	val, found := codeCache.Get(code)
+	if !found {
+		return nil, false
+	}
+	codeCache.Delete(code)
+	return val.(*AuthorizationCode), true
+}
+
+// VerifyPKCE 按 RFC 7636 校验 code_verifier，未指定方法时按 S256 校验
+func VerifyPKCE(challenge, method, verifier string) bool {
+	if challenge == "" || verifier == "" {
+		return false
+	}
+	var computed string
+	switch method {
+	case "S256", "":
+		sum := sha256.Sum256([]byte(verifier))
+		computed = base64.RawURLEncoding.EncodeToString(sum[:])
+	case "plain":
+		computed = verifier
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(challenge)) == 1
+}
+
+// ParseScope 将空格分隔的 scope 拆分并去重
+func ParseScope(scope string) []string {
+	seen := make(map[string]bool)
+	scopes := make([]string, 0)
+	for _, s := range strings.Fields(scope) {
+		if !seen[s] {
+			seen[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
@@ -0,0 +1,80 @@
+package oauth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"goauthx/internal/db"
+	"time"
+)
+
+// Consent 用户对客户端的授权记录
+type Consent struct {
+	ID        string    `bson:"_id"`
+	UserID    int       `bson:"user_id"`
+	ClientID  string    `bson:"client_id"`
+	Scopes    []string  `bson:"scopes"`
+	UpdatedAt time.Time `bson:"updated_at"`
+}
+
+func consentID(userID int, clientID string) string {
+	return fmt.Sprintf("%d:%s", userID, clientID)
+}
+
+func getConsentCollection() (*mongo.Collection, error) {
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return nil, err
+	}
+	return conn.DB.Collection("oauth_consents"), nil
+}
+
+// HasConsent 判断用户是否已授权客户端访问全部请求的 scope
+func HasConsent(userID int, clientID string, scopes []string) (bool, error) {
+	coll, err := getConsentCollection()
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var consent Consent
+	err = coll.FindOne(ctx, bson.M{"_id": consentID(userID, clientID)}).Decode(&consent)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	granted := make(map[string]bool, len(consent.Scopes))
+	for _, s := range consent.Scopes {
+		granted[s] = true
+	}
+	for _, s := range scopes {
+		if !granted[s] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// SaveConsent 记录用户授权，与已有授权的 scope 合并
+func SaveConsent(userID int, clientID string, scopes []string) error {
+	coll, err := getConsentCollection()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = coll.UpdateOne(ctx,
+		bson.M{"_id": consentID(userID, clientID)},
+		bson.M{
+			"$set":      bson.M{"user_id": userID, "client_id": clientID, "updated_at": time.Now()},
+			"$addToSet": bson.M{"scopes": bson.M{"$each": scopes}},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
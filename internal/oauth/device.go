@@ -0,0 +1,206 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"errors"
+	"github.com/patrickmn/go-cache"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrAuthorizationPending = errors.New("authorization pending")
+	ErrSlowDown             = errors.New("polling too frequently")
+	ErrAccessDenied         = errors.New("user denied the request")
+	ErrExpiredToken         = errors.New("device code expired")
+	ErrDeviceCodeNotFound   = errors.New("device code not found")
+)
+
+const (
+	DeviceStatusPending  = "pending"
+	DeviceStatusApproved = "approved"
+	DeviceStatusDenied   = "denied"
+
+	// DeviceCodeTTL 设备码有效期
+	DeviceCodeTTL = 10 * time.Minute
+	// DevicePollInterval 客户端轮询的最小间隔，轮询过快时每次增加 5 秒（RFC 8628 3.5）
+	DevicePollInterval = 5 * time.Second
+
+	// 用户码只使用不易混淆的辅音字母，格式为 XXXX-XXXX
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+var (
+	// 过期后多保留一段时间，以便轮询时返回 expired_token 而不是 invalid_grant
+	deviceCache = cache.New(DeviceCodeTTL+5*time.Minute, time.Minute)
+	deviceMu    sync.Mutex
+)
+
+// DeviceAuthorization 设备授权请求
+type DeviceAuthorization struct {
+	DeviceCode string
+	UserCode   string
+	ClientID   string
+	Scope      string
+	ExpiresAt  time.Time
+	Interval   time.Duration
+	Status     string
+	UserID     int
+	AuthTime   time.Time
+	lastPoll   time.Time
+}
+
+func deviceKey(deviceCode string) string { return "device:" + deviceCode }
+func userCodeKey(userCode string) string { return "user:" + userCode }
+
+// newUserCode 生成用户码
+func newUserCode() (string, error) {
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	var sb strings.Builder
+	for i := 0; i < userCodeLength; i++ {
+		if i == userCodeLength/2 {
+			sb.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// NormalizeUserCode 规范化用户输入的用户码：忽略大小写、空格和连字符
+func NormalizeUserCode(input string) string {
+	var sb strings.Builder
+	for _, c := range strings.ToUpper(input) {
+		if strings.ContainsRune(userCodeAlphabet, c) {
+			sb.WriteRune(c)
+		}
+	}
+	code := sb.String()
+	if len(code) != userCodeLength {
+		return ""
+	}
+	return code[:userCodeLength/2] + "-" + code[userCodeLength/2:]
+}
+
+// NewDeviceAuthorization 创建设备授权请求，返回设备码与用户码
+func NewDeviceAuthorization(clientID, scope string) (*DeviceAuthorization, error) {
+	deviceCode, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+	deviceMu.Lock()
+	defer deviceMu.Unlock()
+	var userCode string
+	for {
+		if userCode, err = newUserCode(); err != nil {
+			return nil, err
+		}
+		if _, exists := deviceCache.Get(userCodeKey(userCode)); !exists {
+			break
+		}
+	}
+	da := &DeviceAuthorization{
+		DeviceCode: deviceCode,
+		UserCode:   userCode,
+		ClientID:   clientID,
+		Scope:      scope,
+		ExpiresAt:  time.Now().Add(DeviceCodeTTL),
+		Interval:   DevicePollInterval,
+		Status:     DeviceStatusPending,
+	}
+	deviceCache.Set(deviceKey(deviceCode), da, cache.DefaultExpiration)
+	deviceCache.Set(userCodeKey(userCode), deviceCode, cache.DefaultExpiration)
+	copied := *da
+	return &copied, nil
+}
+
+// pendingByUserCode 按用户码查找待确认的设备授权，调用方需持有 deviceMu
+func pendingByUserCode(userCode string) *DeviceAuthorization {
+	deviceCode, found := deviceCache.Get(userCodeKey(userCode))
+	if !found {
+		return nil
+	}
+	val, found := deviceCache.Get(deviceKey(deviceCode.(string)))
+	if !found {
+		return nil
+	}
+	da := val.(*DeviceAuthorization)
+	if da.Status != DeviceStatusPending || time.Now().After(da.ExpiresAt) {
+		return nil
+	}
+	return da
+}
+
+// LookupUserCode 按用户码查找待确认的设备授权
+func LookupUserCode(userCode string) (*DeviceAuthorization, bool) {
+	deviceMu.Lock()
+	defer deviceMu.Unlock()
+	da := pendingByUserCode(userCode)
+	if da == nil {
+		return nil, false
+	}
+	copied := *da
+	return &copied, true
+}
+
+// CompleteDeviceAuthorization 用户在验证页面批准或拒绝设备授权
+func CompleteDeviceAuthorization(userCode string, userID int, authTime time.Time, approved bool) error {
+	deviceMu.Lock()
+	defer deviceMu.Unlock()
+	da := pendingByUserCode(userCode)
+	if da == nil {
+		return ErrDeviceCodeNotFound
+	}
+	// 用户码只能使用一次
+	deviceCache.Delete(userCodeKey(userCode))
+	if !approved {
+		da.Status = DeviceStatusDenied
+		return nil
+	}
+	da.Status = DeviceStatusApproved
+	da.UserID = userID
+	da.AuthTime = authTime
+	return nil
+}
+
+// PollDeviceAuthorization 设备轮询授权结果，批准后返回授权信息且设备码作废
+func PollDeviceAuthorization(deviceCode, clientID string) (*DeviceAuthorization, error) {
+	deviceMu.Lock()
+	defer deviceMu.Unlock()
+	val, found := deviceCache.Get(deviceKey(deviceCode))
+	if !found {
+		return nil, ErrDeviceCodeNotFound
+	}
+	da := val.(*DeviceAuthorization)
+	if da.ClientID != clientID {
+		return nil, ErrDeviceCodeNotFound
+	}
+	now := time.Now()
+	if now.After(da.ExpiresAt) {
+		deviceCache.Delete(deviceKey(deviceCode))
+		return nil, ErrExpiredToken
+	}
+	if !da.lastPoll.IsZero() && now.Sub(da.lastPoll) < da.Interval {
+		da.Interval += 5 * time.Second
+		da.lastPoll = now
+		return nil, ErrSlowDown
+	}
+	da.lastPoll = now
+
+	switch da.Status {
+	case DeviceStatusApproved:
+		deviceCache.Delete(deviceKey(deviceCode))
+		copied := *da
+		return &copied, nil
+	case DeviceStatusDenied:
+		deviceCache.Delete(deviceKey(deviceCode))
+		return nil, ErrAccessDenied
+	}
+	return nil, ErrAuthorizationPending
+}
@@ -0,0 +1,195 @@
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"goauthx/internal/db"
+	"golang.org/x/crypto/bcrypt"
+	"time"
+)
+
+var ErrServiceAccountNotFound = errors.New("service account not found")
+
+// ServiceAccountIDPrefix 服务账号ID前缀，与 OAuth 客户端ID区分
+const ServiceAccountIDPrefix = "svc_"
+
+// ServiceAccount 服务账号，供后台任务等机器身份通过 client_credentials 模式获取 Token
+type ServiceAccount struct {
+	ID         string     `bson:"_id"`
+	Name       string     `bson:"name"`
+	SecretHash string     `bson:"secret_hash"`
+	Scopes     []string   `bson:"scopes"`
+	Disabled   bool       `bson:"disabled"`
+	CreatedAt  time.Time  `bson:"created_at"`
+	LastUsedAt *time.Time `bson:"last_used_at,omitempty"`
+}
+
+// VerifySecret 校验服务账号密钥
+func (a *ServiceAccount) VerifySecret(secret string) bool {
+	if secret == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(a.SecretHash), []byte(secret)) == nil
+}
+
+// AllowsScopes 判断请求的 scope 是否都在服务账号允许的范围内
+func (a *ServiceAccount) AllowsScopes(scopes []string) bool {
+	return scopesAllowed(a.Scopes, scopes)
+}
+
+func getServiceAccountCollection() (*mongo.Collection, error) {
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return nil, err
+	}
+	return conn.DB.Collection("service_accounts"), nil
+}
+
+// CreateServiceAccount 创建服务账号，返回密钥明文（仅此一次）
+func CreateServiceAccount(name string, scopes []string) (*ServiceAccount, string, error) {
+	idBytes := make([]byte, 12)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", err
+	}
+	secret, err := randomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	hashed, err := hashSecret(secret)
+	if err != nil {
+		return nil, "", err
+	}
+	if scopes == nil {
+		scopes = []string{}
+	}
+	sa := &ServiceAccount{
+		ID:         ServiceAccountIDPrefix + hex.EncodeToString(idBytes),
+		Name:       name,
+		SecretHash: hashed,
+		Scopes:     scopes,
+		CreatedAt:  time.Now(),
+	}
+	coll, err := getServiceAccountCollection()
+	if err != nil {
+		return nil, "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := coll.InsertOne(ctx, sa); err != nil {
+		return nil, "", err
+	}
+	return sa, secret, nil
+}
+
+// GetServiceAccount 按ID查找服务账号
+func GetServiceAccount(id string) (*ServiceAccount, error) {
+	coll, err := getServiceAccountCollection()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var sa ServiceAccount
+	err = coll.FindOne(ctx, bson.M{"_id": id}).Decode(&sa)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrServiceAccountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sa, nil
+}
+
+// ListServiceAccounts 列出所有服务账号
+func ListServiceAccounts() ([]ServiceAccount, error) {
+	coll, err := getServiceAccountCollection()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	accounts := make([]ServiceAccount, 0)
+	if err := cursor.All(ctx, &accounts); err != nil {
+		return nil, err
+	}
+	return accounts, nil
+}
+
+// updateServiceAccount 更新服务账号，账号不存在时返回 ErrServiceAccountNotFound
+func updateServiceAccount(id string, update bson.M) error {
+	coll, err := getServiceAccountCollection()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := coll.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrServiceAccountNotFound
+	}
+	return nil
+}
+
+// DeleteServiceAccount 删除服务账号
+func DeleteServiceAccount(id string) error {
+	coll, err := getServiceAccountCollection()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := coll.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrServiceAccountNotFound
+	}
+	return nil
+}
+
+// RotateServiceAccountSecret 重新生成服务账号密钥，返回新密钥明文
+func RotateServiceAccountSecret(id string) (string, error) {
+	secret, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+	hashed, err := hashSecret(secret)
+	if err != nil {
+		return "", err
+	}
+	if err := updateServiceAccount(id, bson.M{"$set": bson.M{"secret_hash": hashed}}); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// SetServiceAccountScopes 修改服务账号允许的 scope
+func SetServiceAccountScopes(id string, scopes []string) error {
+	if scopes == nil {
+		scopes = []string{}
+	}
+	return updateServiceAccount(id, bson.M{"$set": bson.M{"scopes": scopes}})
+}
+
+// SetServiceAccountDisabled 停用或启用服务账号
+func SetServiceAccountDisabled(id string, disabled bool) error {
+	return updateServiceAccount(id, bson.M{"$set": bson.M{"disabled": disabled}})
+}
+
+// TouchServiceAccount 记录服务账号最近一次获取 Token 的时间
+func TouchServiceAccount(id string) error {
+	return updateServiceAccount(id, bson.M{"$set": bson.M{"last_used_at": time.Now()}})
+}
@@ -0,0 +1,88 @@
+package passhash
+
+import (
+	"crypto/subtle"
+	"goauthx/internal/config"
+	"golang.org/x/crypto/argon2"
+	"strconv"
+)
+
+// 默认参数参考 OWASP 建议：19 MiB 内存，2 次迭代，1 个线程
+const (
+	defaultArgon2Memory      = 19456
+	defaultArgon2Iterations  = 2
+	defaultArgon2Parallelism = 1
+
+	// 校验时允许的参数上限，避免异常的哈希占用过多资源
+	maxArgon2Memory     = 1 << 20
+	maxArgon2Iterations = 100
+
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+type argon2idHasher struct {
+	memory      int
+	iterations  int
+	parallelism int
+}
+
+func newArgon2idHasher(cfg config.Argon2idConfig) *argon2idHasher {
+	h := &argon2idHasher{memory: cfg.MemoryKiB, iterations: cfg.Iterations, parallelism: cfg.Parallelism}
+	if h.memory <= 0 {
+		h.memory = defaultArgon2Memory
+	}
+	if h.iterations <= 0 {
+		h.iterations = defaultArgon2Iterations
+	}
+	if h.parallelism <= 0 || h.parallelism > 255 {
+		h.parallelism = defaultArgon2Parallelism
+	}
+	return h
+}
+
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt, err := randomSalt(argon2SaltLength)
+	if err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, uint32(h.iterations), uint32(h.memory), uint8(h.parallelism), argon2KeyLength)
+	p := &phc{
+		ID:      Argon2id,
+		Version: strconv.Itoa(argon2.Version),
+		Params:  map[string]int{"m": h.memory, "t": h.iterations, "p": h.parallelism},
+		Salt:    salt,
+		Hash:    key,
+	}
+	return p.String("m", "t", "p"), nil
+}
+
+func parseArgon2id(encoded string) (*phc, error) {
+	p, err := parsePHC(encoded)
+	if err != nil || p.ID != Argon2id || p.Version != strconv.Itoa(argon2.Version) {
+		return nil, ErrInvalidHash
+	}
+	m, t, par := p.Params["m"], p.Params["t"], p.Params["p"]
+	if m < 8*par || m > maxArgon2Memory || t < 1 || t > maxArgon2Iterations || par < 1 || par > 255 {
+		return nil, ErrInvalidHash
+	}
+	return p, nil
+}
+
+func (h *argon2idHasher) Verify(password, encoded string) (bool, error) {
+	p, err := parseArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+	key := argon2.IDKey([]byte(password), p.Salt, uint32(p.Params["t"]), uint32(p.Params["m"]), uint8(p.Params["p"]), uint32(len(p.Hash)))
+	return subtle.ConstantTimeCompare(key, p.Hash) == 1, nil
+}
+
+func (h *argon2idHasher) Outdated(encoded string) bool {
+	p, err := parseArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return p.Params["m"] != h.memory || p.Params["t"] != h.iterations || p.Params["p"] != h.parallelism ||
+		len(p.Hash) != argon2KeyLength
+}
@@ -0,0 +1,230 @@
+package passhash
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"goauthx/internal/config"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+	"strings"
+)
+
+// 从其他系统导入的哈希格式，只能校验，登录成功后会重新计算为当前配置的算法
+const (
+	// Phpass WordPress、phpBB 等 PHP 程序使用的 $P$ / $H$ 哈希
+	Phpass = "phpass"
+	// SHA256SaltPassword sha256(盐 + 密码)
+	SHA256SaltPassword = "sha256-salt-pass"
+	// SHA256PasswordSalt sha256(密码 + 盐)
+	SHA256PasswordSalt = "sha256-pass-salt"
+	// FirebaseScrypt Firebase Authentication 导出的修改版 scrypt 哈希，项目参数见 password_hash.firebase_scrypt
+	FirebaseScrypt = "firebase-scrypt"
+)
+
+// ImportFormats 导入时可以使用的哈希格式
+var ImportFormats = []string{Argon2id, Scrypt, Bcrypt, Phpass, SHA256SaltPassword, SHA256PasswordSalt, FirebaseScrypt}
+
+var errVerifyOnly = errors.New("imported password hash formats can only be verified")
+
+// ImportHash 校验其他系统导出的哈希并转换为保存的格式
+// salt 为 sha256 的盐（原始字符串）或 Firebase 的 base64 盐，其他格式的盐已包含在哈希中
+func ImportHash(format, hash, salt string) (string, error) {
+	hash = strings.TrimSpace(hash)
+	switch format {
+	case Argon2id, Scrypt, Bcrypt, Phpass:
+		name, err := Identify(hash)
+		if err != nil || name != format {
+			return "", ErrInvalidHash
+		}
+		var valid bool
+		switch format {
+		case Argon2id:
+			_, err = parseArgon2id(hash)
+			valid = err == nil
+		case Scrypt:
+			_, err = parseScrypt(hash)
+			valid = err == nil
+		case Bcrypt:
+			_, err = bcrypt.Cost([]byte(hash))
+			valid = err == nil
+		case Phpass:
+			_, valid = phpassRounds(hash)
+		}
+		if !valid {
+			return "", ErrInvalidHash
+		}
+		return hash, nil
+	case SHA256SaltPassword, SHA256PasswordSalt:
+		sum, err := hex.DecodeString(hash)
+		if err != nil || len(sum) != sha256.Size {
+			return "", ErrInvalidHash
+		}
+		return encodeTagged(format, []byte(salt), sum), nil
+	case FirebaseScrypt:
+		saltBytes, err1 := decodeBase64(salt)
+		sum, err2 := decodeBase64(hash)
+		if err1 != nil || err2 != nil || len(saltBytes) == 0 || len(sum) == 0 {
+			return "", ErrInvalidHash
+		}
+		return encodeTagged(format, saltBytes, sum), nil
+	default:
+		return "", fmt.Errorf("unknown password hash format %q", format)
+	}
+}
+
+// decodeBase64 兼容带填充与不带填充的标准 base64
+func decodeBase64(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(s), "="))
+}
+
+// encodeTagged 保存导入的哈希：$<格式>$<盐>$<哈希>，盐与哈希使用不带填充的标准 base64
+func encodeTagged(format string, salt, sum []byte) string {
+	return "$" + format + "$" + base64.RawStdEncoding.EncodeToString(salt) + "$" + base64.RawStdEncoding.EncodeToString(sum)
+}
+
+func parseTagged(encoded, format string) (salt, sum []byte, err error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != "" || parts[1] != format {
+		return nil, nil, ErrInvalidHash
+	}
+	if salt, err = base64.RawStdEncoding.DecodeString(parts[2]); err != nil {
+		return nil, nil, ErrInvalidHash
+	}
+	if sum, err = base64.RawStdEncoding.DecodeString(parts[3]); err != nil || len(sum) == 0 {
+		return nil, nil, ErrInvalidHash
+	}
+	return salt, sum, nil
+}
+
+// importedHasher 导入格式的公共部分：不能计算新哈希，校验成功后总是需要升级
+type importedHasher struct{}
+
+func (importedHasher) Hash(string) (string, error) { return "", errVerifyOnly }
+func (importedHasher) Outdated(string) bool        { return true }
+
+type sha256Hasher struct {
+	importedHasher
+	format string
+}
+
+func (h sha256Hasher) Verify(password, encoded string) (bool, error) {
+	salt, sum, err := parseTagged(encoded, h.format)
+	if err != nil {
+		return false, err
+	}
+	var data []byte
+	if h.format == SHA256SaltPassword {
+		data = append(salt, password...)
+	} else {
+		data = append([]byte(password), salt...)
+	}
+	computed := sha256.Sum256(data)
+	return subtle.ConstantTimeCompare(computed[:], sum) == 1, nil
+}
+
+const (
+	phpassItoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	// 校验时允许的轮数上限（2^16 次 MD5），phpass 默认为 2^8
+	maxPhpassLog2 = 16
+)
+
+type phpassHasher struct {
+	importedHasher
+}
+
+// phpassRounds 解析 $P$<轮数><8位盐><22位哈希>，轮数为 2 的幂
+func phpassRounds(encoded string) (int, bool) {
+	if len(encoded) != 34 || (!strings.HasPrefix(encoded, "$P$") && !strings.HasPrefix(encoded, "$H$")) {
+		return 0, false
+	}
+	log2 := strings.IndexByte(phpassItoa64, encoded[3])
+	if log2 < 7 || log2 > maxPhpassLog2 {
+		return 0, false
+	}
+	return 1 << log2, true
+}
+
+// phpassEncode64 phpass 自定义的 base64 编码
+func phpassEncode64(src []byte) string {
+	var out []byte
+	for i := 0; i < len(src); {
+		value := int(src[i])
+		i++
+		out = append(out, phpassItoa64[value&0x3f])
+		if i < len(src) {
+			value |= int(src[i]) << 8
+		}
+		out = append(out, phpassItoa64[(value>>6)&0x3f])
+		if i >= len(src) {
+			break
+		}
+		i++
+		if i < len(src) {
+			value |= int(src[i]) << 16
+		}
+		out = append(out, phpassItoa64[(value>>12)&0x3f])
+		if i >= len(src) {
+			break
+		}
+		i++
+		out = append(out, phpassItoa64[(value>>18)&0x3f])
+	}
+	return string(out)
+}
+
+func (phpassHasher) Verify(password, encoded string) (bool, error) {
+	rounds, ok := phpassRounds(encoded)
+	if !ok {
+		return false, ErrInvalidHash
+	}
+	salt := encoded[4:12]
+	sum := md5.Sum([]byte(salt + password))
+	for i := 0; i < rounds; i++ {
+		sum = md5.Sum(append(sum[:], password...))
+	}
+	computed := encoded[:12] + phpassEncode64(sum[:])
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(encoded)) == 1, nil
+}
+
+type firebaseScryptHasher struct {
+	importedHasher
+	cfg config.FirebaseScryptConfig
+}
+
+// Verify 按 Firebase 的算法校验：以 scrypt(密码, 盐 + 盐分隔符) 为密钥，
+// 使用 AES-256-CTR（IV 全为 0）加密项目的签名密钥，结果应与保存的哈希相同
+func (h firebaseScryptHasher) Verify(password, encoded string) (bool, error) {
+	salt, sum, err := parseTagged(encoded, FirebaseScrypt)
+	if err != nil {
+		return false, err
+	}
+	signerKey, err := decodeBase64(h.cfg.SignerKey)
+	if err != nil || len(signerKey) == 0 {
+		return false, errors.New("password_hash.firebase_scrypt.signer_key is not configured")
+	}
+	separator, err := decodeBase64(h.cfg.SaltSeparator)
+	if err != nil {
+		return false, errors.New("invalid password_hash.firebase_scrypt.salt_separator")
+	}
+	if h.cfg.MemCost < 1 || h.cfg.MemCost > maxScryptLogN || h.cfg.Rounds < 1 || h.cfg.Rounds > maxScryptR {
+		return false, errors.New("invalid password_hash.firebase_scrypt parameters")
+	}
+	key, err := scrypt.Key([]byte(password), append(salt, separator...), 1<<h.cfg.MemCost, h.cfg.Rounds, 1, 32)
+	if err != nil {
+		return false, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return false, err
+	}
+	computed := make([]byte, len(signerKey))
+	cipher.NewCTR(block, make([]byte, aes.BlockSize)).XORKeyStream(computed, signerKey)
+	return subtle.ConstantTimeCompare(computed, sum) == 1, nil
+}
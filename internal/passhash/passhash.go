@@ -0,0 +1,191 @@
+package passhash
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"goauthx/internal/config"
+	"strconv"
+	"strings"
+)
+
+// 哈希以 PHC 字符串格式保存：$<算法>$<参数>$<盐>$<哈希>
+// bcrypt 保留其原有的 $2a$ 格式，兼容已有数据；导入的其他格式见 foreign.go
+const (
+	Argon2id = "argon2id"
+	Scrypt   = "scrypt"
+	Bcrypt   = "bcrypt"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown password hash format")
+	ErrInvalidHash   = errors.New("invalid password hash")
+)
+
+// Hasher 一种密码哈希算法
+type Hasher interface {
+	// Hash 按当前配置的参数计算哈希
+	Hash(password string) (string, error)
+	// Verify 校验密码，哈希格式错误时返回 ErrInvalidHash
+	Verify(password, encoded string) (bool, error)
+	// Outdated 判断哈希的参数是否与当前配置不同
+	Outdated(encoded string) bool
+}
+
+// hasherFor 按配置构造算法，参数为 0 时使用默认值
+func hasherFor(name string) (Hasher, error) {
+	cfg := config.GetConfig().PasswordHash
+	switch name {
+	case Argon2id:
+		return newArgon2idHasher(cfg.Argon2id), nil
+	case Scrypt:
+		return newScryptHasher(cfg.Scrypt), nil
+	case Bcrypt:
+		return newBcryptHasher(cfg.BcryptCost), nil
+	case Phpass:
+		return phpassHasher{}, nil
+	case SHA256SaltPassword, SHA256PasswordSalt:
+		return sha256Hasher{format: name}, nil
+	case FirebaseScrypt:
+		return firebaseScryptHasher{cfg: cfg.FirebaseScrypt}, nil
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", name)
+	}
+}
+
+// Default 新密码使用的算法，由 password_hash.algorithm 配置，默认为 argon2id
+func Default() (Hasher, string, error) {
+	name := config.GetConfig().PasswordHash.Algorithm
+	switch name {
+	case "":
+		name = Argon2id
+	case Argon2id, Scrypt, Bcrypt:
+	default:
+		return nil, "", fmt.Errorf("password_hash.algorithm %q cannot be used for new passwords", name)
+	}
+	h, err := hasherFor(name)
+	return h, name, err
+}
+
+// Identify 识别已保存哈希的算法
+func Identify(encoded string) (string, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		return Argon2id, nil
+	case strings.HasPrefix(encoded, "$scrypt$"):
+		return Scrypt, nil
+	case strings.HasPrefix(encoded, "$2a$"), strings.HasPrefix(encoded, "$2b$"), strings.HasPrefix(encoded, "$2y$"):
+		return Bcrypt, nil
+	case strings.HasPrefix(encoded, "$P$"), strings.HasPrefix(encoded, "$H$"):
+		return Phpass, nil
+	case strings.HasPrefix(encoded, "$"+SHA256SaltPassword+"$"):
+		return SHA256SaltPassword, nil
+	case strings.HasPrefix(encoded, "$"+SHA256PasswordSalt+"$"):
+		return SHA256PasswordSalt, nil
+	case strings.HasPrefix(encoded, "$"+FirebaseScrypt+"$"):
+		return FirebaseScrypt, nil
+	default:
+		return "", ErrUnknownFormat
+	}
+}
+
+// Hash 使用当前配置的算法计算密码哈希
+func Hash(password string) (string, error) {
+	h, _, err := Default()
+	if err != nil {
+		return "", err
+	}
+	return h.Hash(password)
+}
+
+// Verify 校验密码，rehash 表示哈希的算法或参数已过时，应在校验成功后重新计算
+func Verify(password, encoded string) (ok bool, rehash bool, err error) {
+	name, err := Identify(encoded)
+	if err != nil {
+		return false, false, err
+	}
+	h, err := hasherFor(name)
+	if err != nil {
+		return false, false, err
+	}
+	if ok, err = h.Verify(password, encoded); !ok || err != nil {
+		return false, false, err
+	}
+	_, current, err := Default()
+	if err != nil {
+		// 配置的算法无效时保留原哈希
+		return true, false, nil
+	}
+	return true, name != current || h.Outdated(encoded), nil
+}
+
+func randomSalt(n int) ([]byte, error) {
+	salt := make([]byte, n)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// phc PHC 字符串的各部分，盐与哈希使用不带填充的标准 base64
+type phc struct {
+	ID      string
+	Version string
+	Params  map[string]int
+	Salt    []byte
+	Hash    []byte
+}
+
+func (p *phc) String(paramOrder ...string) string {
+	var b strings.Builder
+	b.WriteString("$" + p.ID)
+	if p.Version != "" {
+		b.WriteString("$v=" + p.Version)
+	}
+	params := make([]string, 0, len(paramOrder))
+	for _, k := range paramOrder {
+		params = append(params, k+"="+strconv.Itoa(p.Params[k]))
+	}
+	b.WriteString("$" + strings.Join(params, ","))
+	b.WriteString("$" + base64.RawStdEncoding.EncodeToString(p.Salt))
+	b.WriteString("$" + base64.RawStdEncoding.EncodeToString(p.Hash))
+	return b.String()
+}
+
+// parsePHC 解析 $id[$v=version]$k=v,...$salt$hash
+func parsePHC(encoded string) (*phc, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 5 && len(parts) != 6 || parts[0] != "" {
+		return nil, ErrInvalidHash
+	}
+	p := &phc{ID: parts[1], Params: map[string]int{}}
+	rest := parts[2:]
+	if len(parts) == 6 {
+		version, ok := strings.CutPrefix(parts[2], "v=")
+		if !ok {
+			return nil, ErrInvalidHash
+		}
+		p.Version = version
+		rest = parts[3:]
+	}
+	for _, kv := range strings.Split(rest[0], ",") {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, ErrInvalidHash
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, ErrInvalidHash
+		}
+		p.Params[k] = n
+	}
+	var err error
+	if p.Salt, err = base64.RawStdEncoding.DecodeString(rest[1]); err != nil {
+		return nil, ErrInvalidHash
+	}
+	if p.Hash, err = base64.RawStdEncoding.DecodeString(rest[2]); err != nil || len(p.Hash) == 0 {
+		return nil, ErrInvalidHash
+	}
+	return p, nil
+}
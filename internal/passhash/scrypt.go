@@ -0,0 +1,92 @@
+package passhash
+
+import (
+	"crypto/subtle"
+	"goauthx/internal/config"
+	"golang.org/x/crypto/scrypt"
+)
+
+// 默认参数参考 OWASP 建议：N=2^17，r=8，p=1
+const (
+	defaultScryptLogN = 17
+	defaultScryptR    = 8
+	defaultScryptP    = 1
+
+	// 校验时允许的参数上限，N=2^20、r=8 时约占用 1 GiB 内存
+	maxScryptLogN = 20
+	maxScryptR    = 32
+	maxScryptP    = 16
+
+	scryptSaltLength = 16
+	scryptKeyLength  = 32
+)
+
+type scryptHasher struct {
+	logN int
+	r    int
+	p    int
+}
+
+func newScryptHasher(cfg config.ScryptConfig) *scryptHasher {
+	h := &scryptHasher{logN: cfg.LogN, r: cfg.R, p: cfg.P}
+	if h.logN <= 1 || h.logN > maxScryptLogN {
+		h.logN = defaultScryptLogN
+	}
+	if h.r <= 0 || h.r > maxScryptR {
+		h.r = defaultScryptR
+	}
+	if h.p <= 0 || h.p > maxScryptP {
+		h.p = defaultScryptP
+	}
+	return h
+}
+
+func (h *scryptHasher) Hash(password string) (string, error) {
+	salt, err := randomSalt(scryptSaltLength)
+	if err != nil {
+		return "", err
+	}
+	key, err := scrypt.Key([]byte(password), salt, 1<<h.logN, h.r, h.p, scryptKeyLength)
+	if err != nil {
+		return "", err
+	}
+	p := &phc{
+		ID:     Scrypt,
+		Params: map[string]int{"ln": h.logN, "r": h.r, "p": h.p},
+		Salt:   salt,
+		Hash:   key,
+	}
+	return p.String("ln", "r", "p"), nil
+}
+
+func parseScrypt(encoded string) (*phc, error) {
+	p, err := parsePHC(encoded)
+	if err != nil || p.ID != Scrypt || p.Version != "" {
+		return nil, ErrInvalidHash
+	}
+	ln, r, par := p.Params["ln"], p.Params["r"], p.Params["p"]
+	if ln < 1 || ln > maxScryptLogN || r < 1 || r > maxScryptR || par < 1 || par > maxScryptP {
+		return nil, ErrInvalidHash
+	}
+	return p, nil
+}
+
+func (h *scryptHasher) Verify(password, encoded string) (bool, error) {
+	p, err := parseScrypt(encoded)
+	if err != nil {
+		return false, err
+	}
+	key, err := scrypt.Key([]byte(password), p.Salt, 1<<p.Params["ln"], p.Params["r"], p.Params["p"], len(p.Hash))
+	if err != nil {
+		return false, ErrInvalidHash
+	}
+	return subtle.ConstantTimeCompare(key, p.Hash) == 1, nil
+}
+
+func (h *scryptHasher) Outdated(encoded string) bool {
+	p, err := parseScrypt(encoded)
+	if err != nil {
+		return true
+	}
+	return p.Params["ln"] != h.logN || p.Params["r"] != h.r || p.Params["p"] != h.p || len(p.Hash) != scryptKeyLength
+}
@@ -0,0 +1,505 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"github.com/patrickmn/go-cache"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"goauthx/internal/db"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// AdminRole 内置管理员角色，拥有全部权限
+	AdminRole = "admin"
+	// WildcardPermission 匹配任意权限；"users:*" 形式匹配同一前缀下的所有权限
+	WildcardPermission = "*"
+)
+
+var (
+	ErrRoleNotFound       = errors.New("role not found")
+	ErrRoleExists         = errors.New("role already exists")
+	ErrPermissionNotFound = errors.New("permission not found")
+	ErrPermissionExists   = errors.New("permission already exists")
+	ErrBuiltIn            = errors.New("built-in roles and permissions cannot be deleted")
+	ErrInvalidName        = errors.New("invalid name")
+
+	namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9:._-]{0,63}$`)
+
+	// 角色到权限的映射缓存，多实例部署时其他实例的修改最迟在过期后生效
+	rolePermissionCache = cache.New(30*time.Second, time.Minute)
+
+	builtinMu          sync.Mutex
+	builtinPermissions = map[string]string{}
+)
+
+// Permission 权限，内置权限由代码注册，自定义权限供下游服务使用
+type Permission struct {
+	Name        string    `bson:"_id"`
+	Description string    `bson:"description"`
+	BuiltIn     bool      `bson:"built_in"`
+	CreatedAt   time.Time `bson:"created_at"`
+}
+
+// Role 角色，拥有一组权限
+type Role struct {
+	Name        string    `bson:"_id"`
+	Description string    `bson:"description"`
+	Permissions []string  `bson:"permissions"`
+	BuiltIn     bool      `bson:"built_in"`
+	CreatedAt   time.Time `bson:"created_at"`
+}
+
+// UserRole 用户与角色的关联
+type UserRole struct {
+	UserID    int       `bson:"user_id"`
+	Role      string    `bson:"role"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// RegisterPermission 注册内置权限，在使用该权限的包的 init 中调用，启动时由 EnsureDefaults 写入数据库
+func RegisterPermission(name, description string) {
+	builtinMu.Lock()
+	defer builtinMu.Unlock()
+	builtinPermissions[name] = description
+}
+
+func collection(name string) (*mongo.Collection, error) {
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return nil, err
+	}
+	return conn.DB.Collection(name), nil
+}
+
+// EnsureDefaults 写入内置权限与管理员角色，服务启动时调用
+func EnsureDefaults() error {
+	permColl, err := collection("permissions")
+	if err != nil {
+		return err
+	}
+	roleColl, err := collection("roles")
+	if err != nil {
+		return err
+	}
+	userRoleColl, err := collection("users_roles")
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err = userRoleColl.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "role", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "role", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	builtinMu.Lock()
+	perms := make(map[string]string, len(builtinPermissions))
+	for k, v := range builtinPermissions {
+		perms[k] = v
+	}
+	builtinMu.Unlock()
+	now := time.Now()
+	for name, desc := range perms {
+		_, err := permColl.UpdateOne(ctx,
+			bson.M{"_id": name},
+			bson.M{
+				"$set":         bson.M{"description": desc, "built_in": true},
+				"$setOnInsert": bson.M{"created_at": now},
+			},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = roleColl.UpdateOne(ctx,
+		bson.M{"_id": AdminRole},
+		bson.M{
+			"$set": bson.M{"permissions": []string{WildcardPermission}, "built_in": true},
+			"$setOnInsert": bson.M{
+				"description": "Administrator with all permissions",
+				"created_at":  now,
+			},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// MatchPermission 判断已授予的权限是否覆盖需要的权限
+func MatchPermission(granted, required string) bool {
+	if granted == WildcardPermission || granted == required {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(granted, "*"); ok {
+		return strings.HasPrefix(required, prefix)
+	}
+	return false
+}
+
+// validPermission 权限名允许以 * 结尾表示通配
+func validPermission(name string) bool {
+	if name == WildcardPermission {
+		return true
+	}
+	return namePattern.MatchString(strings.TrimSuffix(name, "*"))
+}
+
+// CreatePermission 创建自定义权限
+func CreatePermission(name, description string) error {
+	if !namePattern.MatchString(name) {
+		return ErrInvalidName
+	}
+	coll, err := collection("permissions")
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = coll.InsertOne(ctx, Permission{Name: name, Description: description, CreatedAt: time.Now()})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrPermissionExists
+	}
+	return err
+}
+
+// ListPermissions 列出所有权限
+func ListPermissions() ([]Permission, error) {
+	coll, err := collection("permissions")
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	perms := make([]Permission, 0)
+	if err := cursor.All(ctx, &perms); err != nil {
+		return nil, err
+	}
+	return perms, nil
+}
+
+// DeletePermission 删除自定义权限，并从所有角色中移除
+func DeletePermission(name string) error {
+	coll, err := collection("permissions")
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var perm Permission
+	err = coll.FindOne(ctx, bson.M{"_id": name}).Decode(&perm)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrPermissionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if perm.BuiltIn {
+		return ErrBuiltIn
+	}
+	if _, err := coll.DeleteOne(ctx, bson.M{"_id": name}); err != nil {
+		return err
+	}
+	roleColl, err := collection("roles")
+	if err != nil {
+		return err
+	}
+	_, err = roleColl.UpdateMany(ctx, bson.M{"permissions": name}, bson.M{"$pull": bson.M{"permissions": name}})
+	rolePermissionCache.Flush()
+	return err
+}
+
+// checkPermissionsExist 授予角色的权限必须已存在（通配权限除外）
+func checkPermissionsExist(ctx context.Context, perms []string) error {
+	coll, err := collection("permissions")
+	if err != nil {
+		return err
+	}
+	for _, p := range perms {
+		if !validPermission(p) {
+			return ErrInvalidName
+		}
+		if strings.HasSuffix(p, "*") {
+			continue
+		}
+		n, err := coll.CountDocuments(ctx, bson.M{"_id": p})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return ErrPermissionNotFound
+		}
+	}
+	return nil
+}
+
+// CreateRole 创建角色
+func CreateRole(name, description string, permissions []string) error {
+	if !namePattern.MatchString(name) {
+		return ErrInvalidName
+	}
+	if permissions == nil {
+		permissions = []string{}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := checkPermissionsExist(ctx, permissions); err != nil {
+		return err
+	}
+	coll, err := collection("roles")
+	if err != nil {
+		return err
+	}
+	_, err = coll.InsertOne(ctx, Role{Name: name, Description: description, Permissions: permissions, CreatedAt: time.Now()})
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrRoleExists
+	}
+	return err
+}
+
+// GetRole 按名称查找角色
+func GetRole(name string) (*Role, error) {
+	coll, err := collection("roles")
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var role Role
+	err = coll.FindOne(ctx, bson.M{"_id": name}).Decode(&role)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrRoleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &role, nil
+}
+
+// ListRoles 列出所有角色
+func ListRoles() ([]Role, error) {
+	coll, err := collection("roles")
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	roles := make([]Role, 0)
+	if err := cursor.All(ctx, &roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// DeleteRole 删除角色及其所有用户关联
+func DeleteRole(name string) error {
+	role, err := GetRole(name)
+	if err != nil {
+		return err
+	}
+	if role.BuiltIn {
+		return ErrBuiltIn
+	}
+	coll, err := collection("roles")
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := coll.DeleteOne(ctx, bson.M{"_id": name}); err != nil {
+		return err
+	}
+	rolePermissionCache.Delete(name)
+	userRoleColl, err := collection("users_roles")
+	if err != nil {
+		return err
+	}
+	_, err = userRoleColl.DeleteMany(ctx, bson.M{"role": name})
+	return err
+}
+
+// updateRolePermissions 修改角色的权限，内置角色的权限不可修改
+func updateRolePermissions(name string, permissions []string, update func([]string) bson.M) error {
+	role, err := GetRole(name)
+	if err != nil {
+		return err
+	}
+	if role.BuiltIn {
+		return ErrBuiltIn
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	coll, err := collection("roles")
+	if err != nil {
+		return err
+	}
+	if _, err := coll.UpdateOne(ctx, bson.M{"_id": name}, update(permissions)); err != nil {
+		return err
+	}
+	rolePermissionCache.Delete(name)
+	return nil
+}
+
+// GrantPermissions 为角色添加权限
+func GrantPermissions(role string, permissions []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := checkPermissionsExist(ctx, permissions); err != nil {
+		return err
+	}
+	return updateRolePermissions(role, permissions, func(p []string) bson.M {
+		return bson.M{"$addToSet": bson.M{"permissions": bson.M{"$each": p}}}
+	})
+}
+
+// RevokePermissions 移除角色的权限
+func RevokePermissions(role string, permissions []string) error {
+	return updateRolePermissions(role, permissions, func(p []string) bson.M {
+		return bson.M{"$pull": bson.M{"permissions": bson.M{"$in": p}}}
+	})
+}
+
+// AssignRole 为用户分配角色，已分配时不报错
+func AssignRole(userID int, role string) error {
+	if _, err := GetRole(role); err != nil {
+		return err
+	}
+	coll, err := collection("users_roles")
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = coll.UpdateOne(ctx,
+		bson.M{"user_id": userID, "role": role},
+		bson.M{"$setOnInsert": bson.M{"created_at": time.Now()}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// UnassignRole 取消用户的角色，返回是否存在该关联
+func UnassignRole(userID int, role string) (bool, error) {
+	coll, err := collection("users_roles")
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := coll.DeleteOne(ctx, bson.M{"user_id": userID, "role": role})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0, nil
+}
+
+// RemoveUserRoles 删除用户的所有角色关联（删除用户时调用）
+func RemoveUserRoles(userID int) error {
+	coll, err := collection("users_roles")
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = coll.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// UserRoles 返回用户的角色名，按名称排序
+func UserRoles(userID int) ([]string, error) {
+	coll, err := collection("users_roles")
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := coll.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	var assignments []UserRole
+	if err := cursor.All(ctx, &assignments); err != nil {
+		return nil, err
+	}
+	roles := make([]string, 0, len(assignments))
+	for _, a := range assignments {
+		roles = append(roles, a.Role)
+	}
+	sort.Strings(roles)
+	return roles, nil
+}
+
+// RoleUsers 返回拥有指定角色的用户ID
+func RoleUsers(role string) ([]int, error) {
+	coll, err := collection("users_roles")
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := coll.Find(ctx, bson.M{"role": role}, options.Find().SetSort(bson.D{{Key: "user_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	var assignments []UserRole
+	if err := cursor.All(ctx, &assignments); err != nil {
+		return nil, err
+	}
+	users := make([]int, 0, len(assignments))
+	for _, a := range assignments {
+		users = append(users, a.UserID)
+	}
+	return users, nil
+}
+
+// rolePermissions 返回角色的权限，角色不存在时返回空
+func rolePermissions(role string) ([]string, error) {
+	if val, found := rolePermissionCache.Get(role); found {
+		return val.([]string), nil
+	}
+	r, err := GetRole(role)
+	if errors.Is(err, ErrRoleNotFound) {
+		rolePermissionCache.Set(role, []string{}, cache.DefaultExpiration)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rolePermissionCache.Set(role, r.Permissions, cache.DefaultExpiration)
+	return r.Permissions, nil
+}
+
+// HasPermission 判断一组角色是否拥有指定权限
+func HasPermission(roles []string, permission string) (bool, error) {
+	for _, role := range roles {
+		perms, err := rolePermissions(role)
+		if err != nil {
+			return false, err
+		}
+		for _, granted := range perms {
+			if MatchPermission(granted, permission) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -1,27 +1,39 @@
 package captcha
 
 import (
+	"crypto/rand"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"github.com/patrickmn/go-cache"
 	"goauthx/internal/config"
 	"goauthx/internal/smtp"
-	"math/rand"
+	"math/big"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
+// 每个验证码最多允许输错的次数，超过后作废
+const captchaMaxFailures = 5
+
 var (
 	// 使用 go-cache 作为内存验证码存储，带TTL
 	captchaCache = cache.New(5*time.Minute, 10*time.Minute)
-	rnd          = rand.New(rand.NewSource(time.Now().UnixNano()))
+	// captchaMu 保护验证码的输错次数
+	captchaMu sync.Mutex
 	// 邮箱和IP限速缓存，TTL为1分钟
 	rateLimitEmailCache = cache.New(1*time.Minute, 2*time.Minute)
 	rateLimitIPCache    = cache.New(1*time.Minute, 2*time.Minute)
 )
 
+type captchaEntry struct {
+	Code     string
+	Failures int
+}
+
 type CaptchaRequest struct {
 	Email string `json:"email"`
 }
@@ -32,8 +44,12 @@ type CaptchaResponse struct {
 }
 
 // 生成6位数字验证码
-func generateCaptchaCode() string {
-	return fmt.Sprintf("%06d", rnd.Intn(1000000))
+func generateCaptchaCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
 }
 
 func HandleCaptcha(w http.ResponseWriter, r *http.Request) {
@@ -52,7 +68,13 @@ func HandleCaptcha(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 限速逻辑
+	resp, status := SendCaptcha(req.Email, ClientIP(r))
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// ClientIP 获取请求方IP，优先使用反向代理传递的头
+func ClientIP(r *http.Request) string {
 	clientIP := r.Header.Get("X-Real-IP")
 	if clientIP == "" {
 		clientIP = r.Header.Get("X-Forwarded-For")
@@ -60,62 +82,86 @@ func HandleCaptcha(w http.ResponseWriter, r *http.Request) {
 	if clientIP == "" {
 		clientIP = strings.Split(r.RemoteAddr, ":")[0]
 	}
-	if _, found := rateLimitEmailCache.Get(req.Email); found {
-		w.WriteHeader(http.StatusTooManyRequests)
-		resp := CaptchaResponse{Code: 3, Message: "Too many requests for this email, please try again later"}
-		_ = json.NewEncoder(w).Encode(resp)
-		return
+	return clientIP
+}
+
+// SendCaptcha 生成验证码并发送到邮箱，带邮箱和IP限速，供各个需要邮箱验证的接口复用
+func SendCaptcha(to string, clientIP string) (CaptchaResponse, int) {
+	if resp, status, limited := CheckRateLimit(to, clientIP); limited {
+		return resp, status
 	}
-	if _, found := rateLimitIPCache.Get(clientIP); found {
-		w.WriteHeader(http.StatusTooManyRequests)
-		resp := CaptchaResponse{Code: 3, Message: "Too many requests from this IP, please try again later"}
-		_ = json.NewEncoder(w).Encode(resp)
-		return
+
+	code, err := generateCaptchaCode()
+	if err != nil {
+		return CaptchaResponse{Code: 2, Message: "Failed to generate captcha"}, http.StatusInternalServerError
+	}
+	captchaCache.Set(to, &captchaEntry{Code: code}, 10*time.Minute)
+
+	htmlBody, err := LoadEmailTemplate("./resources/template/email/captcha.html", map[string]string{"CODE": code})
+	if err != nil {
+		captchaCache.Delete(to)
+		return CaptchaResponse{Code: 2, Message: "Failed to load email template"}, http.StatusInternalServerError
 	}
 
-	code := generateCaptchaCode()
-	captchaCache.Set(req.Email, code, 10*time.Minute)
+	subject := fmt.Sprintf("您的 %s 验证码", config.GetConfig().Name)
+	if err := email.SendEmail([]string{to}, subject, htmlBody); err != nil {
+		captchaCache.Delete(to)
+		return CaptchaResponse{Code: 2, Message: "Failed to send email"}, http.StatusInternalServerError
+	}
 
-	templatePath := "./resources/template/email/captcha.html"
-	htmlBytes, err := os.ReadFile(templatePath)
+	RecordSend(to, clientIP)
+
+	return CaptchaResponse{Code: 0, Message: "Captcha sent"}, http.StatusOK
+}
+
+// LoadEmailTemplate 读取邮件模板并替换 {{KEY}} 占位符，{{NAME}} 默认替换为服务名称
+func LoadEmailTemplate(path string, values map[string]string) (string, error) {
+	htmlBytes, err := os.ReadFile(path)
 	if err != nil {
-		captchaCache.Delete(req.Email)
-		w.WriteHeader(http.StatusInternalServerError)
-		resp := CaptchaResponse{Code: 2, Message: "Failed to load email template"}
-		_ = json.NewEncoder(w).Encode(resp)
-		return
+		return "", err
+	}
+	htmlBody := strings.ReplaceAll(string(htmlBytes), "{{NAME}}", config.GetConfig().Name)
+	for key, value := range values {
+		htmlBody = strings.ReplaceAll(htmlBody, "{{"+key+"}}", value)
 	}
+	return htmlBody, nil
+}
 
-	cfg := config.GetConfig()
-	htmlBody := strings.ReplaceAll(string(htmlBytes), "{{CODE}}", code)
-	htmlBody = strings.ReplaceAll(htmlBody, "{{NAME}}", cfg.Name)
-	subject := fmt.Sprintf("您的 %s 验证码", cfg.Name)
-	if err := email.SendEmail([]string{req.Email}, subject, htmlBody); err != nil {
-		captchaCache.Delete(req.Email)
-		w.WriteHeader(http.StatusInternalServerError)
-		resp := CaptchaResponse{Code: 2, Message: "Failed to send email"}
-		_ = json.NewEncoder(w).Encode(resp)
-		return
+// CheckRateLimit 检查邮箱和IP的发信频率，超出限制时返回对应的错误响应
+// 验证码与其他需要发送邮件的接口共用同一个限速
+func CheckRateLimit(to string, clientIP string) (CaptchaResponse, int, bool) {
+	if _, found := rateLimitEmailCache.Get(to); found {
+		return CaptchaResponse{Code: 3, Message: "Too many requests for this email, please try again later"}, http.StatusTooManyRequests, true
+	}
+	if _, found := rateLimitIPCache.Get(clientIP); found {
+		return CaptchaResponse{Code: 3, Message: "Too many requests from this IP, please try again later"}, http.StatusTooManyRequests, true
 	}
+	return CaptchaResponse{}, http.StatusOK, false
+}
 
-	// 新增：设置邮箱和IP的限速缓存
-	rateLimitEmailCache.Set(req.Email, true, cache.DefaultExpiration)
+// RecordSend 记录一次发信，设置邮箱和IP的限速缓存
+func RecordSend(to string, clientIP string) {
+	rateLimitEmailCache.Set(to, true, cache.DefaultExpiration)
 	rateLimitIPCache.Set(clientIP, true, cache.DefaultExpiration)
-
-	resp := CaptchaResponse{Code: 0, Message: "Captcha sent"}
-	_ = json.NewEncoder(w).Encode(resp)
 }
 
 // 验证验证码是否正确，并在成功后删除
+// 输错 captchaMaxFailures 次后验证码作废，需要重新获取
 func VerifyCaptcha(email, code string) bool {
+	captchaMu.Lock()
+	defer captchaMu.Unlock()
 	val, found := captchaCache.Get(email)
 	if !found {
 		return false
 	}
-	stored, ok := val.(string)
-	if ok && stored == code {
+	entry := val.(*captchaEntry)
+	if subtle.ConstantTimeCompare([]byte(entry.Code), []byte(code)) == 1 {
 		captchaCache.Delete(email) // 验证成功后删除
 		return true
 	}
+	entry.Failures++
+	if entry.Failures >= captchaMaxFailures {
+		captchaCache.Delete(email)
+	}
 	return false
 }
@@ -0,0 +1,19 @@
+package jwts
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// HandleJWKS 公开 JWT 校验公钥（/.well-known/jwks.json），供下游服务离线校验 Token
+func HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	data, err := marshalJWKS(publicKeys())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "server_error"})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	_, _ = w.Write(data)
+}
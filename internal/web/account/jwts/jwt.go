@@ -2,6 +2,8 @@ package jwts
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson"
@@ -9,22 +11,69 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"goauthx/internal/config"
 	"goauthx/internal/db"
+	"goauthx/internal/rbac"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 )
 
-var jwtSecret = []byte(config.GetConfig().JWTSecret)
+const (
+	SubjectTypeUser    = "user"
+	SubjectTypeService = "service"
+
+	// RolesScope OAuth 客户端获取用户角色所需的 scope
+	RolesScope = "roles"
+)
 
 type Claims struct {
 	UserID int    `json:"user_id"`
 	JTI    string `json:"jti"`
+	// SubjectType 区分用户与服务账号，服务账号的 Token 中 user_id 为 0，sub 为服务账号ID
+	SubjectType string `json:"sub_type,omitempty"`
+	// SessionID 会话ID，刷新 Token 后保持不变
+	SessionID string `json:"sid,omitempty"`
+	// ClientID、Scope 仅 OAuth 客户端获取的 Token 携带
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// Roles 签发时用户拥有的角色，OAuth 客户端需要授权 roles scope 才会携带
+	Roles []string `json:"roles,omitempty"`
+	// EmailVerified 签发时用户邮箱是否已验证，OAuth 客户端需要授权 email scope 才会携带
+	EmailVerified *bool `json:"email_verified,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// JWTRecord 用于MongoDB存储
+// JWTRecord 用于MongoDB存储，同时记录会话信息
 type JWTRecord struct {
-	UserID    int       `bson:"user_id"`
-	JTI       string    `bson:"jti"`
-	ExpiresAt time.Time `bson:"expires_at"`
+	UserID      int       `bson:"user_id"`
+	JTI         string    `bson:"jti"`
+	SessionID   string    `bson:"session_id,omitempty"`
+	ClientID    string    `bson:"client_id,omitempty"`
+	SubjectType string    `bson:"subject_type,omitempty"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+	CreatedAt   time.Time `bson:"created_at,omitempty"`
+	UserAgent   string    `bson:"user_agent,omitempty"`
+	IP          string    `bson:"ip,omitempty"`
+}
+
+// SessionInfo 签发JWT时记录的客户端信息
+type SessionInfo struct {
+	UserAgent string
+	IP        string
+}
+
+// Grant OAuth 授权信息，第一方登录时为空
+type Grant struct {
+	ClientID string
+	Scope    string
+	// SubjectType 为 service 时 ClientID 即服务账号ID
+	SubjectType string
+}
+
+// IsService 判断 Token 是否属于服务账号
+func (c *Claims) IsService() bool {
+	return c.SubjectType == SubjectTypeService
 }
 
 // getJWTCollection 获取 users_jwts 集合
@@ -43,46 +92,141 @@ func getJWTCollection() (*mongo.Collection, error) {
 	return coll, nil
 }
 
-// GenerateJWT 签发JWT并存入MongoDB
-func GenerateJWT(userID int, duration time.Duration) (string, error) {
+// GenerateJWT 签发JWT并存入MongoDB，每次调用开启一个新会话
+func GenerateJWT(userID int, duration time.Duration, session SessionInfo) (string, error) {
+	signed, _, err := generateJWT(userID, duration, session, "", Grant{})
+	return signed, err
+}
+
+// generateJWT 签发JWT，sessionID 为空时以 jti 作为新会话的ID
+func generateJWT(userID int, duration time.Duration, session SessionInfo, sessionID string, grant Grant) (string, *Claims, error) {
+	// 有效期不能超过最长有效期，否则退役密钥被清理后 Token 将无法校验
+	if duration > maxTokenLifetime() {
+		return "", nil, fmt.Errorf("token lifetime %s exceeds max_token_lifetime_hours", duration)
+	}
 	jti := uuid.NewString()
-	expireAt := time.Now().Add(duration)
+	if sessionID == "" {
+		sessionID = jti
+	}
+	subjectType, subject := SubjectTypeUser, strconv.Itoa(userID)
+	if grant.SubjectType == SubjectTypeService {
+		subjectType, subject = SubjectTypeService, grant.ClientID
+	}
+	var roles []string
+	if subjectType == SubjectTypeUser && (grant.ClientID == "" || slices.Contains(strings.Fields(grant.Scope), RolesScope)) {
+		var err error
+		if roles, err = rbac.UserRoles(userID); err != nil {
+			return "", nil, err
+		}
+	}
+	var emailVerified *bool
+	if subjectType == SubjectTypeUser && (grant.ClientID == "" || slices.Contains(strings.Fields(grant.Scope), "email")) {
+		verified, err := userEmailVerified(userID)
+		if err != nil {
+			return "", nil, err
+		}
+		emailVerified = &verified
+	}
+	now := time.Now()
+	expireAt := now.Add(duration)
 	claims := Claims{
-		UserID: userID,
-		JTI:    jti,
+		UserID:        userID,
+		JTI:           jti,
+		SubjectType:   subjectType,
+		SessionID:     sessionID,
+		ClientID:      grant.ClientID,
+		Scope:         grant.Scope,
+		Roles:         roles,
+		EmailVerified: emailVerified,
 		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
 			ExpiresAt: jwt.NewNumericDate(expireAt),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			IssuedAt:  jwt.NewNumericDate(now),
 			ID:        jti,
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString(jwtSecret)
+	key, err := signingKeyForIssue()
 	if err != nil {
-		return "", err
+		return "", nil, err
+	}
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.KID
+	signed, err := token.SignedString(key.signKey)
+	if err != nil {
+		return "", nil, err
 	}
 	coll, err := getJWTCollection()
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
 	_, err = coll.InsertOne(context.Background(), JWTRecord{
-		UserID:    userID,
-		JTI:       jti,
-		ExpiresAt: expireAt,
+		UserID:      userID,
+		JTI:         jti,
+		SessionID:   sessionID,
+		ClientID:    grant.ClientID,
+		SubjectType: grant.SubjectType,
+		ExpiresAt:   expireAt,
+		CreatedAt:   now,
+		UserAgent:   session.UserAgent,
+		IP:          session.IP,
 	})
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, &claims, nil
+}
+
+// userEmailVerified 查询用户邮箱是否已验证，没有记录验证状态的旧账号视为已验证
+func userEmailVerified(userID int) (bool, error) {
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return false, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	count, err := conn.DB.Collection("users").CountDocuments(ctx, bson.M{
+		"_id":            int64(userID),
+		"email_verified": bson.M{"$ne": false},
+	})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// SignClaims 使用当前签发密钥签名任意声明（如 OIDC id_token），不写入白名单
+func SignClaims(claims jwt.Claims) (string, error) {
+	key, err := signingKeyForIssue()
 	if err != nil {
 		return "", err
 	}
-	return signed, nil
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.KID
+	return token.SignedString(key.signKey)
+}
+
+// SigningAlgorithm 返回当前签发密钥的算法
+func SigningAlgorithm() string {
+	key, err := signingKeyForIssue()
+	if err != nil {
+		return config.GetConfig().JWT.Algorithm
+	}
+	return key.Algorithm
 }
 
-// ParseJWT 验证JWT，校验MongoDB白名单并滑动续期
+// ParseJWT 验证JWT并校验MongoDB白名单
 func ParseJWT(tokenString string) (bool, *Claims) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return false, nil
+		kid, _ := token.Header["kid"].(string)
+		key := verificationKey(kid)
+		if key == nil {
+			return nil, errors.New("unknown signing key")
 		}
-		return jwtSecret, nil
+		// 签名算法必须与密钥一致，防止算法混淆攻击
+		if token.Method.Alg() != key.Algorithm {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key.verifyKey, nil
 	})
 	if err != nil {
 		return false, nil
@@ -105,33 +249,18 @@ func ParseJWT(tokenString string) (bool, *Claims) {
 		// 已过期，自动由TTL清理
 		return false, nil
 	}
-	// 滑动续期：如果距离过期小于一半，则延长
-	ttl := record.ExpiresAt.Sub(time.Now())
-	origTTL := claims.ExpiresAt.Time.Sub(claims.IssuedAt.Time)
-	if ttl < origTTL/2 {
-		newExpire := time.Now().Add(origTTL)
-		_, _ = coll.UpdateOne(context.Background(),
-			bson.M{"jti": claims.JTI, "user_id": claims.UserID},
-			bson.M{"$set": bson.M{"expires_at": newExpire}},
-		)
+	// 旧版 Token 没有 sid，以 jti 作为会话ID
+	if claims.SessionID == "" {
+		claims.SessionID = claims.JTI
 	}
 	return true, claims
 }
 
-// RemoveJWTFromWhitelist 移除指定 jti（强制下线单个会话）
-func RemoveJWTFromWhitelist(jti string) {
-	coll, err := getJWTCollection()
-	if err != nil {
-		return
-	}
-	_, _ = coll.DeleteOne(context.Background(), bson.M{"jti": jti})
-}
-
-// RemoveUserJWTsFromWhitelist 移除指定用户的所有jti（强制下线该用户所有会话）
-func RemoveUserJWTsFromWhitelist(userID int) {
-	coll, err := getJWTCollection()
-	if err != nil {
-		return
+// BearerToken 从 Authorization 请求头中取出 Bearer Token，不存在时返回空字符串
+func BearerToken(r *http.Request) string {
+	auth := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return ""
 	}
-	_, _ = coll.DeleteMany(context.Background(), bson.M{"user_id": userID})
+	return strings.TrimSpace(auth[7:])
 }
@@ -0,0 +1,74 @@
+package jwts
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"goauthx/internal/config"
+	"strings"
+)
+
+// 加密保存的密钥以该前缀开头，升级前保存的明文密钥在加载时自动加密
+const encryptedKeyPrefix = "enc:v1:"
+
+var errKeyCiphertext = errors.New("malformed encrypted signing key")
+
+// keyAEAD 由 jwt.key_encryption_secret（为空时使用 jwt_secret）派生 AES-256-GCM 密钥
+func keyAEAD() (cipher.AEAD, error) {
+	cfg := config.GetConfig()
+	secret := cfg.JWT.KeyEncryptionSecret
+	if secret == "" {
+		secret = cfg.JWTSecret
+	}
+	kek, err := hkdf.Key(sha256.New, []byte(secret), nil, "goauthx jwt signing key encryption", 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealKeyMaterial 加密序列化后的密钥，kid 作为附加数据，密文不能挪用到其他记录
+func sealKeyMaterial(kid, material string) (string, error) {
+	aead, err := keyAEAD()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(material), []byte(kid))
+	return encryptedKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openKeyMaterial 解密保存的密钥，encrypted 为 false 表示记录仍是明文
+func openKeyMaterial(kid, stored string) (material string, encrypted bool, err error) {
+	if !strings.HasPrefix(stored, encryptedKeyPrefix) {
+		return stored, false, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedKeyPrefix))
+	if err != nil {
+		return "", true, err
+	}
+	aead, err := keyAEAD()
+	if err != nil {
+		return "", true, err
+	}
+	if len(data) < aead.NonceSize() {
+		return "", true, errKeyCiphertext
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, []byte(kid))
+	if err != nil {
+		return "", true, err
+	}
+	return string(plain), true, nil
+}
@@ -0,0 +1,416 @@
+package jwts
+
+import (
+	"context"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"goauthx/internal/config"
+	"goauthx/internal/db"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	KeyStatusActive  = "active"
+	KeyStatusRetired = "retired"
+
+	// 多实例部署时，其他实例轮换的密钥最迟在该间隔后生效
+	keyringReloadInterval = time.Minute
+	// 遇到未知 kid 时强制重新加载的最小间隔
+	keyringMissReloadInterval = 10 * time.Second
+)
+
+// KeyRecord 签名密钥在 MongoDB 中的存储格式
+// PrivateKey 为加密后的密钥；jwt_secret 对应的密钥由配置派生，不保存密钥本身
+type KeyRecord struct {
+	KID        string     `bson:"_id"`
+	Algorithm  string     `bson:"algorithm"`
+	PrivateKey string     `bson:"private_key,omitempty"`
+	Status     string     `bson:"status"`
+	CreatedAt  time.Time  `bson:"created_at"`
+	RetiredAt  *time.Time `bson:"retired_at,omitempty"`
+}
+
+// keyring 持有当前签发密钥和仅用于校验的退役密钥
+type keyring struct {
+	mu       sync.RWMutex
+	active   *signingKey
+	keys     map[string]*signingKey
+	loadedAt time.Time
+	missAt   time.Time
+}
+
+var (
+	ring     = &keyring{keys: map[string]*signingKey{}}
+	ringOnce sync.Once
+	ringErr  error
+	// legacyKey 为 jwt_secret 对应的 HS256 密钥，用于校验不带 kid 的旧 Token
+	// 只有它仍在密钥环中（作为签发密钥，或退役后尚未清理）时才可用
+	legacyKey *signingKey
+)
+
+func getKeyCollection() (*mongo.Collection, error) {
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return nil, err
+	}
+	return conn.DB.Collection("jwt_keys"), nil
+}
+
+// maxTokenLifetime 签发 Token 允许的最长有效期
+func maxTokenLifetime() time.Duration {
+	hours := config.GetConfig().JWT.MaxTokenLifetimeHours
+	if hours <= 0 {
+		hours = 72
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// bootstrapKey 密钥环为空时，由配置（jwt_secret 或 PEM 私钥文件）生成第一把签发密钥
+func bootstrapKey() (*signingKey, error) {
+	cfg := config.GetConfig()
+	method, err := signingMethod(cfg.JWT.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if method == jwt.SigningMethodHS256 {
+		return legacyKey, nil
+	}
+	return loadPrivateKeyFile(cfg.JWT.PrivateKeyFile, method)
+}
+
+// saveKey 加密保存密钥记录，kid 已存在时覆盖状态
+func saveKey(ctx context.Context, coll *mongo.Collection, key *signingKey, status string) error {
+	set := bson.M{"algorithm": key.Algorithm, "status": status}
+	unset := bson.M{"retired_at": ""}
+	if key.KID == legacyKey.KID {
+		unset["private_key"] = ""
+	} else {
+		material, err := encodeKeyMaterial(key)
+		if err != nil {
+			return err
+		}
+		if set["private_key"], err = sealKeyMaterial(key.KID, material); err != nil {
+			return err
+		}
+	}
+	_, err := coll.UpdateOne(ctx,
+		bson.M{"_id": key.KID},
+		bson.M{
+			"$set":         set,
+			"$unset":       unset,
+			"$setOnInsert": bson.M{"created_at": time.Now()},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// retireLegacyKey 以非对称密钥初始化密钥环时，把 jwt_secret 记录为退役密钥，
+// 升级前签发的不带 kid 的 Token 在其被清理前仍可校验
+func retireLegacyKey(ctx context.Context, coll *mongo.Collection) error {
+	now := time.Now()
+	_, err := coll.UpdateOne(ctx,
+		bson.M{"_id": legacyKey.KID},
+		bson.M{
+			"$set":         bson.M{"algorithm": legacyKey.Algorithm, "status": KeyStatusRetired},
+			"$setOnInsert": bson.M{"created_at": now, "retired_at": now},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// loadKey 还原密钥记录，jwt_secret 对应的密钥使用配置派生的 legacyKey
+// 升级前保存的明文密钥在加载时加密，jwt_secret 不再保存在数据库中
+func loadKey(ctx context.Context, coll *mongo.Collection, rec KeyRecord) (*signingKey, error) {
+	if rec.KID == legacyKey.KID {
+		if rec.PrivateKey != "" {
+			_, _ = coll.UpdateOne(ctx, bson.M{"_id": rec.KID}, bson.M{"$unset": bson.M{"private_key": ""}})
+		}
+		return legacyKey, nil
+	}
+	material, encrypted, err := openKeyMaterial(rec.KID, rec.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := decodeKeyMaterial(rec.Algorithm, material)
+	if err != nil {
+		return nil, err
+	}
+	if !encrypted {
+		if sealed, err := sealKeyMaterial(rec.KID, material); err == nil {
+			_, _ = coll.UpdateOne(ctx,
+				bson.M{"_id": rec.KID, "private_key": rec.PrivateKey},
+				bson.M{"$set": bson.M{"private_key": sealed}},
+			)
+		}
+	}
+	return key, nil
+}
+
+// reload 从 MongoDB 重新加载密钥环，没有签发密钥时自动初始化
+func (kr *keyring) reload() error {
+	coll, err := getKeyCollection()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cursor, err := coll.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	var records []KeyRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*signingKey, len(records))
+	var active *signingKey
+	for _, rec := range records {
+		key, err := loadKey(ctx, coll, rec)
+		if err != nil {
+			log.Printf("跳过无法解析的签名密钥 %s: %v", rec.KID, err)
+			continue
+		}
+		keys[rec.KID] = key
+		if rec.Status == KeyStatusActive {
+			active = key
+		}
+	}
+	if active == nil {
+		kr.mu.RLock()
+		active = kr.active
+		kr.mu.RUnlock()
+	}
+	if active == nil {
+		active, err = bootstrapKey()
+		if err != nil {
+			return err
+		}
+		if err := saveKey(ctx, coll, active, KeyStatusActive); err != nil {
+			return err
+		}
+		keys[active.KID] = active
+		if active.KID != legacyKey.KID {
+			if err := retireLegacyKey(ctx, coll); err != nil {
+				return err
+			}
+			keys[legacyKey.KID] = legacyKey
+		}
+	}
+
+	kr.mu.Lock()
+	kr.active = active
+	kr.keys = keys
+	kr.loadedAt = time.Now()
+	kr.mu.Unlock()
+	return nil
+}
+
+// refreshIfStale 距离上次加载超过间隔时重新加载，失败时继续使用内存中的密钥
+func (kr *keyring) refreshIfStale() {
+	kr.mu.RLock()
+	stale := time.Since(kr.loadedAt) > keyringReloadInterval
+	kr.mu.RUnlock()
+	if stale {
+		if err := kr.reload(); err != nil {
+			log.Printf("重新加载签名密钥失败: %v", err)
+		}
+	}
+}
+
+// lookup 按 kid 查找密钥，未找到时在限频内重新加载一次
+func (kr *keyring) lookup(kid string) *signingKey {
+	kr.mu.RLock()
+	key := kr.keys[kid]
+	retry := key == nil && time.Since(kr.missAt) > keyringMissReloadInterval
+	kr.mu.RUnlock()
+	if !retry {
+		return key
+	}
+	kr.mu.Lock()
+	kr.missAt = time.Now()
+	kr.mu.Unlock()
+	if err := kr.reload(); err != nil {
+		return nil
+	}
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	return kr.keys[kid]
+}
+
+// InitKeys 加载签名密钥环（必要时生成），建议在服务启动时调用以便尽早发现配置错误
+func InitKeys() error {
+	ringOnce.Do(func() {
+		legacyKey = newHMACKey([]byte(config.GetConfig().JWTSecret))
+		ringErr = ring.reload()
+	})
+	return ringErr
+}
+
+// signingKeyForIssue 返回当前用于签发的密钥
+func signingKeyForIssue() (*signingKey, error) {
+	if err := InitKeys(); err != nil {
+		return nil, err
+	}
+	ring.refreshIfStale()
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+	return ring.active, nil
+}
+
+// verificationKey 按 kid 查找校验密钥，kid 为空时使用旧版共享密钥
+// 共享密钥被轮换并清理后，不带 kid 的 Token 一律无效
+func verificationKey(kid string) *signingKey {
+	if InitKeys() != nil {
+		return nil
+	}
+	if kid == "" {
+		kid = legacyKey.KID
+	}
+	return ring.lookup(kid)
+}
+
+// publicKeys 返回需要公开的校验密钥（签发密钥和未清理的退役密钥）
+func publicKeys() []*signingKey {
+	if InitKeys() != nil {
+		return nil
+	}
+	ring.refreshIfStale()
+	ring.mu.RLock()
+	defer ring.mu.RUnlock()
+	keys := make([]*signingKey, 0, len(ring.keys))
+	for _, k := range ring.keys {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// RotateKeys 生成新的签发密钥，原签发密钥转为仅校验的退役密钥
+func RotateKeys() (string, error) {
+	if err := InitKeys(); err != nil {
+		return "", err
+	}
+	method, err := signingMethod(config.GetConfig().JWT.Algorithm)
+	if err != nil {
+		return "", err
+	}
+	key, err := generateKey(method)
+	if err != nil {
+		return "", err
+	}
+	coll, err := getKeyCollection()
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := saveKey(ctx, coll, key, KeyStatusActive); err != nil {
+		return "", err
+	}
+	_, err = coll.UpdateMany(ctx,
+		bson.M{"_id": bson.M{"$ne": key.KID}, "status": KeyStatusActive},
+		bson.M{"$set": bson.M{"status": KeyStatusRetired, "retired_at": time.Now()}},
+	)
+	if err != nil {
+		return "", err
+	}
+	return key.KID, ring.reload()
+}
+
+// PruneKeys 删除退役时间超过 Token 最长有效期的密钥，返回删除数量
+func PruneKeys() (int64, error) {
+	coll, err := getKeyCollection()
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := coll.DeleteMany(ctx, bson.M{
+		"status":     KeyStatusRetired,
+		"retired_at": bson.M{"$lt": time.Now().Add(-maxTokenLifetime())},
+	})
+	if err != nil {
+		return 0, err
+	}
+	if res.DeletedCount > 0 {
+		if err := ring.reload(); err != nil {
+			return res.DeletedCount, err
+		}
+	}
+	return res.DeletedCount, nil
+}
+
+// ListKeys 列出密钥环中的所有密钥（不含私钥）
+func ListKeys() ([]KeyRecord, error) {
+	coll, err := getKeyCollection()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	findOpts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetProjection(bson.M{"private_key": 0})
+	cursor, err := coll.Find(ctx, bson.M{}, findOpts)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]KeyRecord, 0)
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// StartKeyRotation 按配置的间隔自动轮换签发密钥，并定期清理过期的退役密钥
+func StartKeyRotation() {
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+		for {
+			rotateIfDue()
+			if _, err := PruneKeys(); err != nil {
+				log.Printf("清理退役签名密钥失败: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// rotateIfDue 签发密钥的创建时间超过轮换间隔时执行轮换
+func rotateIfDue() {
+	hours := config.GetConfig().JWT.RotationIntervalHours
+	if hours <= 0 {
+		return
+	}
+	coll, err := getKeyCollection()
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var rec KeyRecord
+	err = coll.FindOne(ctx, bson.M{"status": KeyStatusActive},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}})).Decode(&rec)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("检查签名密钥轮换失败: %v", err)
+		return
+	}
+	if err == nil && time.Since(rec.CreatedAt) < time.Duration(hours)*time.Hour {
+		return
+	}
+	kid, err := RotateKeys()
+	if err != nil {
+		log.Printf("自动轮换签名密钥失败: %v", err)
+		return
+	}
+	log.Printf("已自动轮换签名密钥，新 kid: %s", kid)
+}
@@ -0,0 +1,277 @@
+package jwts
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// signingKey 一把签名密钥，kid 写入 JWT 头部用于校验时选择密钥
+type signingKey struct {
+	KID       string
+	Algorithm string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	jwk       *JWK
+}
+
+// JWK RFC 7517 公钥格式，仅非对称密钥会公开
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+var b64 = base64.RawURLEncoding
+
+// signingMethod 将配置中的算法名转换为签名方法
+func signingMethod(alg string) (jwt.SigningMethod, error) {
+	switch strings.ToUpper(alg) {
+	case "HS256":
+		return jwt.SigningMethodHS256, nil
+	case "RS256":
+		return jwt.SigningMethodRS256, nil
+	case "ES256":
+		return jwt.SigningMethodES256, nil
+	case "EDDSA", "ED25519":
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported jwt algorithm: %s", alg)
+}
+
+// newHMACKey 由共享密钥构造 HS256 密钥，kid 取密钥摘要前缀
+func newHMACKey(secret []byte) *signingKey {
+	sum := sha256.Sum256(secret)
+	return &signingKey{
+		KID:       "hs-" + hex.EncodeToString(sum[:8]),
+		Algorithm: jwt.SigningMethodHS256.Alg(),
+		Method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+// newAsymmetricKey 由私钥构造非对称密钥，私钥类型必须与算法匹配
+func newAsymmetricKey(method jwt.SigningMethod, priv crypto.Signer) (*signingKey, error) {
+	jwk := &JWK{Use: "sig", Alg: method.Alg()}
+	switch k := priv.(type) {
+	case *rsa.PrivateKey:
+		if method != jwt.SigningMethodRS256 {
+			return nil, errors.New("rsa key requires RS256")
+		}
+		jwk.Kty = "RSA"
+		jwk.N = b64.EncodeToString(k.N.Bytes())
+		jwk.E = b64.EncodeToString(big.NewInt(int64(k.E)).Bytes())
+	case *ecdsa.PrivateKey:
+		if method != jwt.SigningMethodES256 || k.Curve != elliptic.P256() {
+			return nil, errors.New("ecdsa key requires ES256 with P-256 curve")
+		}
+		pub, err := k.PublicKey.ECDH()
+		if err != nil {
+			return nil, err
+		}
+		// 非压缩格式：0x04 || X || Y
+		raw := pub.Bytes()
+		size := (len(raw) - 1) / 2
+		jwk.Kty = "EC"
+		jwk.Crv = "P-256"
+		jwk.X = b64.EncodeToString(raw[1 : 1+size])
+		jwk.Y = b64.EncodeToString(raw[1+size:])
+	case ed25519.PrivateKey:
+		if method != jwt.SigningMethodEdDSA {
+			return nil, errors.New("ed25519 key requires EdDSA")
+		}
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = b64.EncodeToString(k.Public().(ed25519.PublicKey))
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", priv)
+	}
+	jwk.Kid = jwkThumbprint(jwk)
+	return &signingKey{
+		KID:       jwk.Kid,
+		Algorithm: method.Alg(),
+		Method:    method,
+		signKey:   priv,
+		verifyKey: priv.Public(),
+		jwk:       jwk,
+	}, nil
+}
+
+// jwkThumbprint 按 RFC 7638 计算公钥指纹，作为 kid
+func jwkThumbprint(k *JWK) string {
+	var members string
+	switch k.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, k.E, k.N)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, k.Crv, k.X, k.Y)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, k.Crv, k.X)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return b64.EncodeToString(sum[:])
+}
+
+// generatePrivateKey 按算法生成新的私钥
+func generatePrivateKey(method jwt.SigningMethod) (crypto.Signer, error) {
+	switch method {
+	case jwt.SigningMethodRS256:
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case jwt.SigningMethodES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwt.SigningMethodEdDSA:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	}
+	return nil, fmt.Errorf("cannot generate key for %s", method.Alg())
+}
+
+// parsePrivateKeyPEM 解析 PEM 私钥，支持 PKCS#8、PKCS#1（RSA）和 SEC1（EC）
+func parsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// encodeKeyMaterial 将密钥序列化以便存储：HS256 为 base64 密钥，非对称为 PKCS#8 PEM
+func encodeKeyMaterial(k *signingKey) (string, error) {
+	switch key := k.signKey.(type) {
+	case []byte:
+		return base64.StdEncoding.EncodeToString(key), nil
+	case crypto.Signer:
+		data, err := encodePrivateKeyPEM(key)
+		return string(data), err
+	}
+	return "", fmt.Errorf("unsupported key type %T", k.signKey)
+}
+
+// decodeKeyMaterial 由存储的算法和密钥还原签名密钥
+func decodeKeyMaterial(alg, material string) (*signingKey, error) {
+	method, err := signingMethod(alg)
+	if err != nil {
+		return nil, err
+	}
+	if method == jwt.SigningMethodHS256 {
+		secret, err := base64.StdEncoding.DecodeString(material)
+		if err != nil {
+			return nil, err
+		}
+		return newHMACKey(secret), nil
+	}
+	priv, err := parsePrivateKeyPEM([]byte(material))
+	if err != nil {
+		return nil, err
+	}
+	return newAsymmetricKey(method, priv)
+}
+
+// generateKey 按算法生成新的签名密钥
+func generateKey(method jwt.SigningMethod) (*signingKey, error) {
+	if method == jwt.SigningMethodHS256 {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return newHMACKey(secret), nil
+	}
+	priv, err := generatePrivateKey(method)
+	if err != nil {
+		return nil, err
+	}
+	return newAsymmetricKey(method, priv)
+}
+
+// encodePrivateKeyPEM 将私钥编码为 PKCS#8 PEM
+func encodePrivateKeyPEM(priv crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// loadPrivateKeyFile 读取 PEM 私钥文件，文件不存在时生成新私钥并写入
+func loadPrivateKeyFile(path string, method jwt.SigningMethod) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		priv, err := generatePrivateKey(method)
+		if err != nil {
+			return nil, err
+		}
+		data, err = encodePrivateKeyPEM(priv)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return nil, err
+		}
+		return newAsymmetricKey(method, priv)
+	}
+	if err != nil {
+		return nil, err
+	}
+	priv, err := parsePrivateKeyPEM(data)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return newAsymmetricKey(method, priv)
+}
+
+// JWKSet RFC 7517 JWK Set
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// marshalJWKS 序列化公钥集合
+func marshalJWKS(keys []*signingKey) ([]byte, error) {
+	set := JWKSet{Keys: make([]JWK, 0, len(keys))}
+	for _, k := range keys {
+		if k.jwk != nil {
+			set.Keys = append(set.Keys, *k.jwk)
+		}
+	}
+	return json.Marshal(set)
+}
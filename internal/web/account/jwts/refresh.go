@@ -0,0 +1,289 @@
+package jwts
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"goauthx/internal/config"
+	"goauthx/internal/db"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrClientMismatch      = errors.New("refresh token was issued to another client")
+	// ErrRefreshDenied 用户已不允许登录（被删除、封禁等），会话同时被注销
+	ErrRefreshDenied = errors.New("user is not allowed to refresh tokens")
+
+	// refreshCheck 刷新前对用户的检查，由 account 包通过 RegisterRefreshCheck 注册
+	refreshCheck func(userID int) error
+)
+
+// RegisterRefreshCheck 注册刷新 Token 前对用户的检查
+// 用户不允许登录时 check 应返回包装 ErrRefreshDenied 的错误
+func RegisterRefreshCheck(check func(userID int) error) {
+	refreshCheck = check
+}
+
+// RefreshTokenRecord Refresh Token 在 MongoDB 中的存储格式，只保存哈希
+type RefreshTokenRecord struct {
+	Hash             string     `bson:"_id"`
+	UserID           int        `bson:"user_id"`
+	SessionID        string     `bson:"session_id"`
+	ClientID         string     `bson:"client_id,omitempty"`
+	Scope            string     `bson:"scope,omitempty"`
+	ExpiresAt        time.Time  `bson:"expires_at"`
+	CreatedAt        time.Time  `bson:"created_at"`
+	SessionCreatedAt time.Time  `bson:"session_created_at"`
+	UsedAt           *time.Time `bson:"used_at,omitempty"`
+	Revoked          bool       `bson:"revoked"`
+	UserAgent        string     `bson:"user_agent,omitempty"`
+	IP               string     `bson:"ip,omitempty"`
+}
+
+// TokenPair 登录或刷新后返回给客户端的 Token
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	// ExpiresIn Access Token 剩余有效秒数
+	ExpiresIn int64
+	UserID    int
+	SessionID string
+	Scope     string
+}
+
+// AccessTokenTTL Access Token 有效期
+func AccessTokenTTL() time.Duration {
+	minutes := config.GetConfig().JWT.AccessTokenTTLMinutes
+	if minutes <= 0 {
+		minutes = 15
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// RefreshTokenTTL Refresh Token 有效期，从登录时开始计算，刷新不会延长
+func RefreshTokenTTL() time.Duration {
+	hours := config.GetConfig().JWT.RefreshTokenTTLHours
+	if hours <= 0 {
+		hours = 720
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+// getRefreshTokenCollection 获取 users_refresh_tokens 集合
+func getRefreshTokenCollection() (*mongo.Collection, error) {
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return nil, err
+	}
+	coll := conn.DB.Collection("users_refresh_tokens")
+	indexModel := mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	}
+	_, _ = coll.Indexes().CreateOne(context.Background(), indexModel)
+	return coll, nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// IssueTokenPair 登录成功后开启新会话，签发 Access Token 和 Refresh Token
+// 第一方登录时 grant 为空，OAuth 授权时携带 client_id 和 scope
+func IssueTokenPair(userID int, session SessionInfo, grant Grant) (*TokenPair, error) {
+	now := time.Now()
+	return issueTokenPair(userID, session, "", grant, now, now.Add(RefreshTokenTTL()))
+}
+
+func issueTokenPair(userID int, session SessionInfo, sessionID string, grant Grant, sessionCreatedAt, refreshExpiresAt time.Time) (*TokenPair, error) {
+	ttl := AccessTokenTTL()
+	accessToken, claims, err := generateJWT(userID, ttl, session, sessionID, grant)
+	if err != nil {
+		return nil, err
+	}
+	sessionID = claims.SessionID
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	coll, err := getRefreshTokenCollection()
+	if err != nil {
+		return nil, err
+	}
+	_, err = coll.InsertOne(context.Background(), RefreshTokenRecord{
+		Hash:             hashRefreshToken(refreshToken),
+		UserID:           userID,
+		SessionID:        sessionID,
+		ClientID:         grant.ClientID,
+		Scope:            grant.Scope,
+		ExpiresAt:        refreshExpiresAt,
+		CreatedAt:        time.Now(),
+		SessionCreatedAt: sessionCreatedAt,
+		UserAgent:        session.UserAgent,
+		IP:               session.IP,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(ttl.Seconds()),
+		UserID:       userID,
+		SessionID:    sessionID,
+		Scope:        grant.Scope,
+	}, nil
+}
+
+// RefreshTokenPair 使用 Refresh Token 换取新的 Token，每次使用后 Refresh Token 都会轮换
+// 已使用过的 Refresh Token 再次出现时视为被盗用，整个会话会被注销
+// clientID 为换取 Token 的 OAuth 客户端，必须与签发时一致，第一方刷新时为空
+func RefreshTokenPair(refreshToken string, clientID string, session SessionInfo) (*TokenPair, error) {
+	refreshToken = strings.TrimSpace(refreshToken)
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	coll, err := getRefreshTokenCollection()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	hash := hashRefreshToken(refreshToken)
+	now := time.Now()
+	var record RefreshTokenRecord
+	// 原子地标记为已使用，保证同一个 Refresh Token 只能成功使用一次
+	filter := bson.M{
+		"_id":        hash,
+		"revoked":    false,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": now},
+	}
+	if clientID == "" {
+		filter["client_id"] = bson.M{"$exists": false}
+	} else {
+		filter["client_id"] = clientID
+	}
+	err = coll.FindOneAndUpdate(ctx,
+		filter,
+		bson.M{"$set": bson.M{"used_at": now}},
+	).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		var existing RefreshTokenRecord
+		if coll.FindOne(ctx, bson.M{"_id": hash}).Decode(&existing) != nil {
+			return nil, ErrInvalidRefreshToken
+		}
+		if existing.ClientID != clientID {
+			return nil, ErrClientMismatch
+		}
+		if existing.UsedAt != nil && !existing.Revoked && existing.ExpiresAt.After(now) {
+			_, _ = RemoveUserSession(existing.UserID, existing.SessionID)
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if refreshCheck != nil {
+		if err := refreshCheck(record.UserID); err != nil {
+			if errors.Is(err, ErrRefreshDenied) {
+				_, _ = RemoveUserSession(record.UserID, record.SessionID)
+			} else {
+				// 检查本身失败时恢复 Refresh Token，客户端可以重试
+				_, _ = coll.UpdateOne(ctx, bson.M{"_id": hash, "used_at": now}, bson.M{"$unset": bson.M{"used_at": ""}})
+			}
+			return nil, err
+		}
+	}
+
+	// 轮换后旧的 Access Token 同时失效
+	if jwtColl, err := getJWTCollection(); err == nil {
+		_, _ = jwtColl.DeleteMany(ctx, bson.M{"user_id": record.UserID, "session_id": record.SessionID})
+	}
+	grant := Grant{ClientID: record.ClientID, Scope: record.Scope}
+	return issueTokenPair(record.UserID, session, record.SessionID, grant, record.SessionCreatedAt, record.ExpiresAt)
+}
+
+// LookupRefreshToken 查找仍然有效（未使用、未注销、未过期）的 Refresh Token，用于内省与吊销
+func LookupRefreshToken(refreshToken string) (*RefreshTokenRecord, error) {
+	refreshToken = strings.TrimSpace(refreshToken)
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	coll, err := getRefreshTokenCollection()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var record RefreshTokenRecord
+	err = coll.FindOne(ctx, bson.M{
+		"_id":        hashRefreshToken(refreshToken),
+		"revoked":    false,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&record)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// revokeRefreshTokens 注销符合条件的 Refresh Token，返回注销数量
+func revokeRefreshTokens(filter bson.M) (int64, error) {
+	coll, err := getRefreshTokenCollection()
+	if err != nil {
+		return 0, err
+	}
+	filter["revoked"] = false
+	res, err := coll.UpdateMany(context.Background(), filter, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return 0, err
+	}
+	return res.ModifiedCount, nil
+}
+
+// listActiveRefreshTokens 列出用户所有未使用、未注销且未过期的 Refresh Token
+func listActiveRefreshTokens(ctx context.Context, userID int) ([]RefreshTokenRecord, error) {
+	coll, err := getRefreshTokenCollection()
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := coll.Find(ctx, bson.M{
+		"user_id":    userID,
+		"revoked":    false,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var records []RefreshTokenRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
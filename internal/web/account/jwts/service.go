@@ -0,0 +1,28 @@
+package jwts
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"time"
+)
+
+// GenerateServiceJWT 为服务账号签发 Access Token（client_credentials 模式），不签发 Refresh Token
+func GenerateServiceJWT(accountID string, scope string, session SessionInfo) (string, *Claims, error) {
+	grant := Grant{ClientID: accountID, Scope: scope, SubjectType: SubjectTypeService}
+	return generateJWT(0, AccessTokenTTL(), session, "", grant)
+}
+
+// RemoveServiceJWTs 吊销服务账号的所有 Token
+func RemoveServiceJWTs(accountID string) (int64, error) {
+	coll, err := getJWTCollection()
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := coll.DeleteMany(ctx, bson.M{"client_id": accountID, "subject_type": SubjectTypeService})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
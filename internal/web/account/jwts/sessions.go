@@ -0,0 +1,153 @@
+package jwts
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"sort"
+	"time"
+)
+
+// Session 一个登录会话：首次签发的 Token 与之后通过刷新得到的 Token 属于同一会话
+type Session struct {
+	ID        string
+	JTI       string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UserAgent string
+	IP        string
+}
+
+// sessionFilter 匹配会话下的所有 Token，兼容没有 session_id 的旧记录
+func sessionFilter(sessionID string) bson.M {
+	return bson.M{"$or": []bson.M{
+		{"session_id": sessionID},
+		{"jti": sessionID},
+	}}
+}
+
+// ListUserSessions 列出指定用户当前有效的所有会话，按创建时间倒序
+// Access Token 已过期但 Refresh Token 仍有效的会话同样会列出
+func ListUserSessions(userID int) ([]Session, error) {
+	coll, err := getJWTCollection()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	now := time.Now()
+
+	cursor, err := coll.Find(ctx, bson.M{"user_id": userID, "expires_at": bson.M{"$gt": now}})
+	if err != nil {
+		return nil, err
+	}
+	var records []JWTRecord
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	sessions := make(map[string]*Session)
+	for _, rec := range records {
+		id := rec.SessionID
+		if id == "" {
+			id = rec.JTI
+		}
+		sessions[id] = &Session{
+			ID:        id,
+			JTI:       rec.JTI,
+			CreatedAt: rec.CreatedAt,
+			ExpiresAt: rec.ExpiresAt,
+			UserAgent: rec.UserAgent,
+			IP:        rec.IP,
+		}
+	}
+
+	refreshTokens, err := listActiveRefreshTokens(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, rt := range refreshTokens {
+		s, ok := sessions[rt.SessionID]
+		if !ok {
+			s = &Session{ID: rt.SessionID, UserAgent: rt.UserAgent, IP: rt.IP}
+			sessions[rt.SessionID] = s
+		}
+		s.CreatedAt = rt.SessionCreatedAt
+		if rt.ExpiresAt.After(s.ExpiresAt) {
+			s.ExpiresAt = rt.ExpiresAt
+		}
+	}
+
+	result := make([]Session, 0, len(sessions))
+	for _, s := range sessions {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	return result, nil
+}
+
+// RemoveUserSession 注销指定用户的某个会话，会话不属于该用户时返回 false
+func RemoveUserSession(userID int, sessionID string) (bool, error) {
+	coll, err := getJWTCollection()
+	if err != nil {
+		return false, err
+	}
+	// 传入的是刷新后签发的 jti 时，换成它所属的会话ID
+	var record JWTRecord
+	if coll.FindOne(context.Background(), bson.M{"user_id": userID, "jti": sessionID}).Decode(&record) == nil && record.SessionID != "" {
+		sessionID = record.SessionID
+	}
+	filter := sessionFilter(sessionID)
+	filter["user_id"] = userID
+	res, err := coll.DeleteMany(context.Background(), filter)
+	if err != nil {
+		return false, err
+	}
+	revoked, err := revokeRefreshTokens(bson.M{"user_id": userID, "session_id": sessionID})
+	if err != nil {
+		return false, err
+	}
+	return res.DeletedCount > 0 || revoked > 0, nil
+}
+
+// RemoveJWTFromWhitelist 移除指定 jti 及其所在会话（强制下线单个会话）
+func RemoveJWTFromWhitelist(jti string) {
+	coll, err := getJWTCollection()
+	if err != nil {
+		return
+	}
+	var record JWTRecord
+	if err := coll.FindOne(context.Background(), bson.M{"jti": jti}).Decode(&record); err != nil {
+		return
+	}
+	sessionID := record.SessionID
+	if sessionID == "" {
+		sessionID = record.JTI
+	}
+	_, _ = coll.DeleteMany(context.Background(), sessionFilter(sessionID))
+	_, _ = revokeRefreshTokens(bson.M{"session_id": sessionID})
+}
+
+// RemoveUserJWTsFromWhitelist 移除指定用户的所有jti（强制下线该用户所有会话）
+func RemoveUserJWTsFromWhitelist(userID int) {
+	coll, err := getJWTCollection()
+	if err != nil {
+		return
+	}
+	_, _ = coll.DeleteMany(context.Background(), bson.M{"user_id": userID})
+	_, _ = revokeRefreshTokens(bson.M{"user_id": userID})
+}
+
+// RemoveUserSessionsExcept 下线指定用户除 keepSessionID 以外的所有会话
+func RemoveUserSessionsExcept(userID int, keepSessionID string) {
+	coll, err := getJWTCollection()
+	if err != nil {
+		return
+	}
+	_, _ = coll.DeleteMany(context.Background(), bson.M{
+		"user_id":    userID,
+		"jti":        bson.M{"$ne": keepSessionID},
+		"session_id": bson.M{"$ne": keepSessionID},
+	})
+	_, _ = revokeRefreshTokens(bson.M{"user_id": userID, "session_id": bson.M{"$ne": keepSessionID}})
+}
@@ -0,0 +1,256 @@
+package pat
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"goauthx/internal/db"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// TokenPrefix 个人访问令牌的固定前缀，便于识别与密钥扫描
+	TokenPrefix = "gax_"
+	// 列表中展示的令牌前缀长度（含 TokenPrefix）
+	displayPrefixLength = 12
+	// 每个用户最多持有的令牌数量
+	MaxTokensPerUser = 50
+	// 最近使用时间的更新间隔，避免每次请求都写库
+	lastUsedUpdateInterval = time.Minute
+)
+
+var (
+	ErrTokenNotFound  = errors.New("personal access token not found")
+	ErrInvalidToken   = errors.New("invalid or expired personal access token")
+	ErrTooManyTokens  = errors.New("too many personal access tokens")
+	ErrInvalidScope   = errors.New("invalid scope")
+	ErrInvalidName    = errors.New("invalid token name")
+	ErrInvalidExpires = errors.New("expiry must be in the future")
+
+	scopePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9:._-]{0,63}$`)
+)
+
+// Token 个人访问令牌，只保存哈希与用于展示的前缀
+type Token struct {
+	ID         string     `bson:"_id"`
+	UserID     int        `bson:"user_id"`
+	Name       string     `bson:"name"`
+	Hash       string     `bson:"hash"`
+	Prefix     string     `bson:"prefix"`
+	Scopes     []string   `bson:"scopes"`
+	CreatedAt  time.Time  `bson:"created_at"`
+	ExpiresAt  *time.Time `bson:"expires_at,omitempty"`
+	LastUsedAt *time.Time `bson:"last_used_at,omitempty"`
+	LastUsedIP string     `bson:"last_used_ip,omitempty"`
+}
+
+// Expired 判断令牌是否已过期，没有过期时间的令牌永不过期
+func (t *Token) Expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+// getTokenCollection 获取 users_pats 集合
+func getTokenCollection() (*mongo.Collection, error) {
+	conn, err := db.GetMongoConnector()
+	if err != nil {
+		return nil, err
+	}
+	coll := conn.DB.Collection("users_pats")
+	_, _ = coll.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+	})
+	return coll, nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsPersonalAccessToken 按前缀判断是否为个人访问令牌
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, TokenPrefix)
+}
+
+// normalizeScopes 校验并去重 scope
+func normalizeScopes(scopes []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(scopes))
+	for _, s := range scopes {
+		s = strings.TrimSpace(s)
+		if !scopePattern.MatchString(s) {
+			return nil, ErrInvalidScope
+		}
+		if !seen[s] {
+			seen[s] = true
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+// CreateToken 为用户创建个人访问令牌，返回令牌明文（仅此一次）
+// expiresAt 为 nil 表示永不过期
+func CreateToken(userID int, name string, scopes []string, expiresAt *time.Time) (*Token, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return nil, "", ErrInvalidName
+	}
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now()
+	if expiresAt != nil && !expiresAt.After(now) {
+		return nil, "", ErrInvalidExpires
+	}
+	coll, err := getTokenCollection()
+	if err != nil {
+		return nil, "", err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	count, err := coll.CountDocuments(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return nil, "", err
+	}
+	if count >= MaxTokensPerUser {
+		return nil, "", ErrTooManyTokens
+	}
+
+	secret := make([]byte, 30)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+	plain := TokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	idBytes := make([]byte, 8)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", err
+	}
+	token := &Token{
+		ID:        hex.EncodeToString(idBytes),
+		UserID:    userID,
+		Name:      name,
+		Hash:      hashToken(plain),
+		Prefix:    plain[:displayPrefixLength],
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: expiresAt,
+	}
+	if _, err := coll.InsertOne(ctx, token); err != nil {
+		return nil, "", err
+	}
+	return token, plain, nil
+}
+
+// ListTokens 列出用户的个人访问令牌（包括已过期的），按创建时间倒序
+func ListTokens(userID int) ([]Token, error) {
+	coll, err := getTokenCollection()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cursor, err := coll.Find(ctx, bson.M{"user_id": userID}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	tokens := make([]Token, 0)
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RevokeToken 删除用户的某个令牌，令牌不属于该用户时返回 ErrTokenNotFound
+func RevokeToken(userID int, id string) error {
+	coll, err := getTokenCollection()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := coll.DeleteOne(ctx, bson.M{"_id": id, "user_id": userID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// RevokeUserTokens 删除用户的所有令牌，返回删除数量
+func RevokeUserTokens(userID int) (int64, error) {
+	coll, err := getTokenCollection()
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	res, err := coll.DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, err
+	}
+	return res.DeletedCount, nil
+}
+
+// findToken 按明文查找未过期的令牌
+func findToken(plain string) (*Token, error) {
+	if !IsPersonalAccessToken(plain) {
+		return nil, ErrInvalidToken
+	}
+	coll, err := getTokenCollection()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var token Token
+	err = coll.FindOne(ctx, bson.M{"hash": hashToken(plain)}).Decode(&token)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token.Expired(time.Now()) {
+		return nil, ErrInvalidToken
+	}
+	return &token, nil
+}
+
+// PeekToken 校验令牌明文但不记录使用，供令牌内省等代替持有者的检查使用
+func PeekToken(plain string) (*Token, error) {
+	return findToken(plain)
+}
+
+// LookupToken 校验令牌明文并记录最近使用时间，令牌不存在或已过期时返回 ErrInvalidToken
+func LookupToken(plain string, ip string) (*Token, error) {
+	token, err := findToken(plain)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= lastUsedUpdateInterval {
+		coll, err := getTokenCollection()
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_, _ = coll.UpdateOne(ctx, bson.M{"_id": token.ID}, bson.M{"$set": bson.M{"last_used_at": now, "last_used_ip": ip}})
+		token.LastUsedAt = &now
+		token.LastUsedIP = ip
+	}
+	return token, nil
+}
@@ -0,0 +1,102 @@
+package pat
+
+import (
+	"goauthx/internal/account"
+	"goauthx/internal/web/account/captcha"
+	"goauthx/internal/web/account/jwts"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Principal 通过认证的调用方，凭据可能是 JWT 或个人访问令牌
+type Principal struct {
+	UserID      int
+	SubjectType string
+	Subject     string
+	// Scopes 为 nil 表示第一方登录签发的 JWT，不受 scope 限制
+	Scopes []string
+	// Claims 凭据为 JWT 时非空
+	Claims *jwts.Claims
+	// Token 凭据为个人访问令牌时非空
+	Token *Token
+}
+
+// HasScope 判断调用方是否拥有指定 scope
+func (p *Principal) HasScope(scope string) bool {
+	return p.Scopes == nil || slices.Contains(p.Scopes, scope)
+}
+
+// IsPersonalAccessToken 判断凭据是否为个人访问令牌
+func (p *Principal) IsPersonalAccessToken() bool {
+	return p.Token != nil
+}
+
+// ValidateToken 校验 JWT 或个人访问令牌，ip 用于记录令牌最近使用的地址
+func ValidateToken(token string, ip string) (*Principal, bool) {
+	return validateToken(token, func(plain string) (*Token, error) {
+		return LookupToken(plain, ip)
+	})
+}
+
+// PeekPrincipal 与 ValidateToken 相同，但不记录个人访问令牌的使用，供令牌内省使用
+func PeekPrincipal(token string) (*Principal, bool) {
+	return validateToken(token, PeekToken)
+}
+
+func validateToken(token string, lookup func(string) (*Token, error)) (*Principal, bool) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, false
+	}
+	if IsPersonalAccessToken(token) {
+		t, err := lookup(token)
+		if err != nil {
+			return nil, false
+		}
+		// 封禁期间个人访问令牌不可用
+		banned, _, err := account.IsUserBanned(t.UserID)
+		if err != nil || banned {
+			return nil, false
+		}
+		// 没有 scope 的令牌不能拥有第一方 JWT 的全部权限
+		scopes := t.Scopes
+		if scopes == nil {
+			scopes = []string{}
+		}
+		return &Principal{
+			UserID:      t.UserID,
+			SubjectType: jwts.SubjectTypeUser,
+			Subject:     strconv.Itoa(t.UserID),
+			Scopes:      scopes,
+			Token:       t,
+		}, true
+	}
+
+	ok, claims := jwts.ParseJWT(token)
+	if !ok {
+		return nil, false
+	}
+	p := &Principal{
+		UserID:      claims.UserID,
+		SubjectType: claims.SubjectType,
+		Subject:     claims.Subject,
+		Claims:      claims,
+	}
+	if p.SubjectType == "" {
+		p.SubjectType = jwts.SubjectTypeUser
+	}
+	if p.Subject == "" {
+		p.Subject = strconv.Itoa(claims.UserID)
+	}
+	if claims.ClientID != "" {
+		p.Scopes = append([]string{}, strings.Fields(claims.Scope)...)
+	}
+	return p, true
+}
+
+// Authenticate 校验请求中的 Bearer 凭据（JWT 或个人访问令牌）
+func Authenticate(r *http.Request) (*Principal, bool) {
+	return ValidateToken(jwts.BearerToken(r), captcha.ClientIP(r))
+}
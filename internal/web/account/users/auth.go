@@ -0,0 +1,30 @@
+package users
+
+import (
+	"goauthx/internal/web/account/captcha"
+	"goauthx/internal/web/account/jwts"
+	"net/http"
+)
+
+// authenticate 校验请求中的 Bearer Token，返回对应的 Claims
+func authenticate(r *http.Request) (*jwts.Claims, bool) {
+	token := jwts.BearerToken(r)
+	if token == "" {
+		return nil, false
+	}
+	ok, claims := jwts.ParseJWT(token)
+	// 服务账号与第三方 OAuth 客户端的 Token 不能访问用户自身的接口，
+	// OAuth 客户端只能使用 /userinfo 等按 scope 授权的资源接口
+	if !ok || claims.IsService() || claims.ClientID != "" {
+		return nil, false
+	}
+	return claims, true
+}
+
+// sessionInfo 从请求中提取会话的客户端信息
+func sessionInfo(r *http.Request) jwts.SessionInfo {
+	return jwts.SessionInfo{
+		UserAgent: r.UserAgent(),
+		IP:        captcha.ClientIP(r),
+	}
+}
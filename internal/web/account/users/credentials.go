@@ -0,0 +1,96 @@
+package users
+
+import (
+	"encoding/json"
+	"goauthx/internal/account"
+	"goauthx/internal/web/account/captcha"
+	"goauthx/internal/web/account/pat"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type ChangePasswordRequest struct {
+	OldPassword         string `json:"old_password"`
+	NewPassword         string `json:"new_password"`
+	RevokeOtherSessions bool   `json:"revoke_other_sessions"`
+}
+
+type ChangeEmailRequest struct {
+	Email               string `json:"email"`
+	Captcha             string `json:"captcha"`
+	RevokeOtherSessions bool   `json:"revoke_other_sessions"`
+}
+
+// HandleChangePassword 已登录用户修改密码
+func HandleChangePassword(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	claims, ok := authenticate(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(account.PasswordResponse{Code: 6, Message: "Unauthorized"})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(account.PasswordResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+
+	resp, status := account.ChangePassword(int64(claims.UserID), req.OldPassword, req.NewPassword, req.RevokeOtherSessions, claims.SessionID)
+	if resp.Code == 0 {
+		revokeTokensAfterPasswordChange(claims.UserID)
+	}
+	w.WriteHeader(status)
+	_ = encoder.Encode(resp)
+}
+
+// revokeTokensAfterPasswordChange 密码变更后删除用户的所有个人访问令牌
+func revokeTokensAfterPasswordChange(userID int) {
+	if _, err := pat.RevokeUserTokens(userID); err != nil {
+		log.Printf("删除用户 %d 的个人访问令牌失败: %v", userID, err)
+	}
+}
+
+// HandleChangeEmail 已登录用户修改邮箱，验证码需先通过 /captcha 发送到新邮箱
+func HandleChangeEmail(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	claims, ok := authenticate(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(account.EmailResponse{Code: 6, Message: "Unauthorized"})
+		return
+	}
+
+	var req ChangeEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(account.EmailResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	req.Captcha = strings.TrimSpace(req.Captcha)
+	if req.Email == "" || req.Captcha == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(account.EmailResponse{Code: 1, Message: "Missing fields"})
+		return
+	}
+	if !account.IsEmail(req.Email) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(account.EmailResponse{Code: 1, Message: "Invalid email"})
+		return
+	}
+	if !captcha.VerifyCaptcha(req.Email, req.Captcha) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(account.EmailResponse{Code: 4, Message: "Invalid or expired captcha"})
+		return
+	}
+
+	resp, status := account.ChangeEmail(int64(claims.UserID), req.Email, req.RevokeOtherSessions, claims.SessionID)
+	w.WriteHeader(status)
+	_ = encoder.Encode(resp)
+}
@@ -1,18 +1,13 @@
 package users
 
 import (
-	"context"
 	"encoding/json"
-	"go.mongodb.org/mongo-driver/bson"
+	"errors"
 	"go.mongodb.org/mongo-driver/mongo"
 	"goauthx/internal/account"
-	"goauthx/internal/db"
 	"goauthx/internal/web/account/jwts"
-	"golang.org/x/crypto/bcrypt"
 	"net/http"
-	"regexp"
 	"strings"
-	"time"
 )
 
 type LoginRequest struct {
@@ -21,9 +16,13 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	Token   string `json:"token,omitempty"`
+	Code         int    `json:"code"`
+	Message      string `json:"message"`
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in,omitempty"`
+	Challenge    string `json:"challenge,omitempty"`
+	MFAToken     string `json:"mfa_token,omitempty"`
 }
 
 func HandleLogin(w http.ResponseWriter, r *http.Request) {
@@ -43,30 +42,9 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	conn, err := db.GetMongoConnector()
+	user, err := account.FindUserByLogin(req.Username)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		_ = encoder.Encode(LoginResponse{Code: 1, Message: "Database connection error"})
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	filter := bson.M{}
-	switch {
-	case isEmail(req.Username):
-		filter["email"] = req.Username
-	case isNumeric(req.Username):
-		filter["userId"] = toInt64(req.Username)
-	default:
-		filter["username"] = req.Username
-	}
-
-	var user account.UserDoc
-	err = conn.DB.Collection("users").FindOne(ctx, filter).Decode(&user)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if errors.Is(err, mongo.ErrNoDocuments) {
 			w.WriteHeader(http.StatusUnauthorized)
 			_ = encoder.Encode(LoginResponse{Code: 1, Message: "User not found"})
 		} else {
@@ -100,46 +78,49 @@ func HandleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)) != nil {
+	// 哈希的算法或参数已过时时会自动升级
+	if !account.CheckPassword(user, req.Password) {
 		w.WriteHeader(http.StatusUnauthorized)
 		_ = encoder.Encode(LoginResponse{Code: 2, Message: "Incorrect password"})
 		return
 	}
 
-	token, err := jwts.GenerateJWT(userID, 72*time.Hour)
+	// 开启 email_verification.require_for_login 后未验证邮箱的账号不能登录
+	if account.EmailVerificationRequired(user) {
+		w.WriteHeader(http.StatusForbidden)
+		_ = encoder.Encode(LoginResponse{Code: 9, Message: "Email not verified"})
+		return
+	}
+
+	// 开启两步验证的用户需要通过 /login/mfa 完成登录
+	if user.TOTPEnabled {
+		mfaToken, err := newMFAChallenge(userID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = encoder.Encode(LoginResponse{Code: 3, Message: "Token generation failed"})
+			return
+		}
+		_ = encoder.Encode(LoginResponse{Code: 7, Message: "MFA required", Challenge: "mfa_required", MFAToken: mfaToken})
+		return
+	}
+
+	pair, err := jwts.IssueTokenPair(userID, sessionInfo(r), jwts.Grant{})
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		_ = encoder.Encode(LoginResponse{Code: 3, Message: "Token generation failed"})
 		return
 	}
 
-	_ = encoder.Encode(LoginResponse{Code: 0, Message: "Login success", Token: token})
-}
-
-// 判断是否为邮箱（与 register.go 保持一致，使用正则）
-func isEmail(s string) bool {
-	emailRegexp := regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
-	return emailRegexp.MatchString(s)
-}
-
-// 判断是否为纯数字
-func isNumeric(s string) bool {
-	if s == "" {
-		return false
-	}
-	for i := 0; i < len(s); i++ {
-		if s[i] < '0' || s[i] > '9' {
-			return false
-		}
-	}
-	return true
+	_ = encoder.Encode(loginSuccess(pair))
 }
 
-// 字符串转 int64
-func toInt64(s string) int64 {
-	var n int64
-	for i := 0; i < len(s); i++ {
-		n = n*10 + int64(s[i]-'0')
+// loginSuccess 构造登录成功的响应
+func loginSuccess(pair *jwts.TokenPair) LoginResponse {
+	return LoginResponse{
+		Code:         0,
+		Message:      "Login success",
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    pair.ExpiresIn,
 	}
-	return n
 }
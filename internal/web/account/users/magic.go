@@ -0,0 +1,370 @@
+package users
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/patrickmn/go-cache"
+	"go.mongodb.org/mongo-driver/mongo"
+	"goauthx/internal/account"
+	"goauthx/internal/config"
+	"goauthx/internal/smtp"
+	"goauthx/internal/web/account/captcha"
+	"goauthx/internal/web/account/jwts"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	magicNonceCookieName = "goauthx_magic_nonce"
+	magicCookiePath      = "/login/magic"
+	magicTemplatePath    = "./resources/template/email/magic_link.html"
+	// 打开登录链接时展示的确认页面，提交后才消费令牌，避免邮件安全扫描预取链接时被使用
+	magicConfirmPagePath = "./static/magic_link.html"
+	// 在其他浏览器中打开链接的次数上限，超过后链接作废
+	magicMaxAttempts = 5
+)
+
+var (
+	// 登录链接只保存在内存中，重启后失效
+	magicLinkCache = cache.New(10*time.Minute, 10*time.Minute)
+	magicLinkMu    sync.Mutex
+	// 登录链接的签名密钥，每次启动随机生成
+	magicSigningKey = randomBytes(32)
+
+	// 错误信息直接作为响应的 message
+	errInvalidMagicLink = errors.New("Invalid or expired link")
+	errMagicLinkBrowser = errors.New("Link must be opened in the browser that requested it")
+)
+
+// magicLink 登录链接对应的用户与发起请求的浏览器
+type magicLink struct {
+	UserID    int
+	NonceHash string
+	Attempts  int
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+type MagicLinkVerifyRequest struct {
+	Token string `json:"token"`
+}
+
+func randomBytes(n int) []byte {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return buf
+}
+
+func hashNonce(nonce string) string {
+	sum := sha256.Sum256([]byte(nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+func magicSignature(id string, expires int64) string {
+	mac := hmac.New(sha256.New, magicSigningKey)
+	mac.Write([]byte(id + "." + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newMagicLink 生成签名的登录令牌：<id>.<过期时间>.<签名>
+func newMagicLink(userID int, nonce string, ttl time.Duration) string {
+	id := base64.RawURLEncoding.EncodeToString(randomBytes(24))
+	expires := time.Now().Add(ttl).Unix()
+	magicLinkCache.Set(id, &magicLink{UserID: userID, NonceHash: hashNonce(nonce)}, ttl)
+	return id + "." + strconv.FormatInt(expires, 10) + "." + magicSignature(id, expires)
+}
+
+// consumeMagicLink 校验签名、有效期与发起请求的浏览器，成功后作废链接
+func consumeMagicLink(token, nonce string) (int, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, errInvalidMagicLink
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return 0, errInvalidMagicLink
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(magicSignature(parts[0], expires))) {
+		return 0, errInvalidMagicLink
+	}
+
+	magicLinkMu.Lock()
+	defer magicLinkMu.Unlock()
+	val, found := magicLinkCache.Get(parts[0])
+	if !found {
+		return 0, errInvalidMagicLink
+	}
+	link := val.(*magicLink)
+	// 邮件客户端的链接扫描不带 Cookie，校验失败时不作废链接，只计数
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(hashNonce(nonce)), []byte(link.NonceHash)) != 1 {
+		link.Attempts++
+		if link.Attempts >= magicMaxAttempts {
+			magicLinkCache.Delete(parts[0])
+		}
+		return 0, errMagicLinkBrowser
+	}
+	magicLinkCache.Delete(parts[0])
+	return link.UserID, nil
+}
+
+// magicLinkBase 登录链接的地址前缀，不按请求的 Host 推断，避免链接被指向其他域名
+func magicLinkBase() string {
+	cfg := config.GetConfig()
+	base := cfg.MagicLink.LinkBaseURL
+	if base == "" {
+		base = cfg.OAuth.Issuer
+	}
+	return strings.TrimRight(base, "/")
+}
+
+func magicLinkTTL() time.Duration {
+	if minutes := config.GetConfig().MagicLink.TTLMinutes; minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+	return 10 * time.Minute
+}
+
+// HandleMagicLink 向邮箱发送一次性登录链接，并在当前浏览器写入绑定链接的 nonce Cookie
+func HandleMagicLink(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	if !config.GetConfig().MagicLink.Enabled {
+		w.WriteHeader(http.StatusNotFound)
+		_ = encoder.Encode(captcha.CaptchaResponse{Code: 1, Message: "Magic link login is disabled"})
+		return
+	}
+	var req MagicLinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(captcha.CaptchaResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if !account.IsEmail(req.Email) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(captcha.CaptchaResponse{Code: 1, Message: "Invalid email"})
+		return
+	}
+	base := magicLinkBase()
+	if base == "" {
+		log.Printf("邮箱链接登录需要配置 magic_link.link_base_url 或 oauth.issuer")
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(captcha.CaptchaResponse{Code: 2, Message: "Magic link login is not configured"})
+		return
+	}
+	clientIP := captcha.ClientIP(r)
+	if resp, status, limited := captcha.CheckRateLimit(req.Email, clientIP); limited {
+		w.WriteHeader(status)
+		_ = encoder.Encode(resp)
+		return
+	}
+	captcha.RecordSend(req.Email, clientIP)
+
+	ttl := magicLinkTTL()
+	// 沿用浏览器已有的 nonce，同一浏览器多次请求时之前发送的链接仍然有效
+	var nonce string
+	if c, err := r.Cookie(magicNonceCookieName); err == nil && validMagicNonce(c.Value) {
+		nonce = c.Value
+	} else {
+		nonce = hex.EncodeToString(randomBytes(32))
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     magicNonceCookieName,
+		Value:    nonce,
+		Path:     magicCookiePath,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   config.GetConfig().HTTPServer.EnableSSL,
+		// 从邮件中点击链接属于顶级导航，Lax 模式下会携带 Cookie
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	// 邮箱未注册时同样返回成功，避免被用来探测账号是否存在
+	sent := captcha.CaptchaResponse{Code: 0, Message: "Magic link sent"}
+	user, err := account.FindUserByEmail(req.Email)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			_ = encoder.Encode(sent)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(captcha.CaptchaResponse{Code: 2, Message: "Database error"})
+		return
+	}
+
+	token := newMagicLink(int(user.UserId), nonce, ttl)
+	link := base + "/login/magic/verify?token=" + url.QueryEscape(token)
+	// 在后台发送邮件，响应时间不随邮箱是否注册而变化
+	go sendMagicLink(user, link, ttl)
+	_ = encoder.Encode(sent)
+}
+
+// validMagicNonce 判断 Cookie 中的 nonce 是否为本服务生成的格式
+func validMagicNonce(nonce string) bool {
+	b, err := hex.DecodeString(nonce)
+	return err == nil && len(b) == 32
+}
+
+// sendMagicLink 发送登录链接邮件，失败时只记录日志
+func sendMagicLink(user *account.UserDoc, link string, ttl time.Duration) {
+	htmlBody, err := captcha.LoadEmailTemplate(magicTemplatePath, map[string]string{
+		"LINK":     link,
+		"USERNAME": user.Username,
+		"MINUTES":  strconv.Itoa(int(ttl.Minutes())),
+	})
+	if err != nil {
+		log.Printf("加载登录链接邮件模板失败: %v", err)
+		return
+	}
+	subject := fmt.Sprintf("登录 %s", config.GetConfig().Name)
+	if err := email.SendEmail([]string{user.Email}, subject, htmlBody); err != nil {
+		log.Printf("向用户 %d 发送登录链接失败: %v", user.UserId, err)
+	}
+}
+
+// HandleMagicLinkVerify 使用登录链接换取 Token，必须在发起请求的浏览器中打开
+// 邮件中的链接为 GET /login/magic/verify?token=...，只展示确认页面；令牌由确认页面的表单或 POST JSON 提交
+func HandleMagicLinkVerify(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	w.Header().Set("Cache-Control", "no-store")
+	if !config.GetConfig().MagicLink.Enabled {
+		w.WriteHeader(http.StatusNotFound)
+		_ = encoder.Encode(LoginResponse{Code: 1, Message: "Magic link login is disabled"})
+		return
+	}
+	var token string
+	switch {
+	case r.Method != http.MethodPost:
+		token = strings.TrimSpace(r.URL.Query().Get("token"))
+		if token != "" {
+			renderMagicConfirmPage(w, r, token)
+			return
+		}
+	case strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded"):
+		// 确认页面提交的表单
+		token = r.PostFormValue("token")
+	default:
+		var req MagicLinkVerifyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = encoder.Encode(LoginResponse{Code: 1, Message: "Invalid request"})
+			return
+		}
+		token = req.Token
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(LoginResponse{Code: 1, Message: "Missing token"})
+		return
+	}
+
+	var nonce string
+	if c, err := r.Cookie(magicNonceCookieName); err == nil {
+		nonce = c.Value
+	}
+	userID, err := consumeMagicLink(token, nonce)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(LoginResponse{Code: 6, Message: err.Error()})
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     magicNonceCookieName,
+		Value:    "",
+		Path:     magicCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   config.GetConfig().HTTPServer.EnableSSL,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	user, err := account.FindUserByID(int64(userID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(LoginResponse{Code: 1, Message: "Database error"})
+		return
+	}
+	banned, banInfo, err := account.IsUserBanned(userID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(LoginResponse{Code: 4, Message: "Ban check failed"})
+		return
+	}
+	if banned {
+		msg := "User is banned"
+		if banInfo != nil && banInfo.BanReason != "" {
+			msg += ": " + banInfo.BanReason
+		}
+		w.WriteHeader(http.StatusForbidden)
+		_ = encoder.Encode(LoginResponse{Code: 5, Message: msg})
+		return
+	}
+	// 打开邮件中的链接即证明拥有该邮箱
+	if !user.IsEmailVerified() {
+		if err := account.SetEmailVerified(user.UserId, true); err != nil {
+			log.Printf("标记用户 %d 邮箱已验证失败: %v", userID, err)
+		}
+	}
+
+	// 登录链接代替密码，开启两步验证的用户仍需通过 /login/mfa 完成登录
+	if user.TOTPEnabled {
+		mfaToken, err := newMFAChallenge(userID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = encoder.Encode(LoginResponse{Code: 3, Message: "Token generation failed"})
+			return
+		}
+		_ = encoder.Encode(LoginResponse{Code: 7, Message: "MFA required", Challenge: "mfa_required", MFAToken: mfaToken})
+		return
+	}
+
+	pair, err := jwts.IssueTokenPair(userID, sessionInfo(r), jwts.Grant{})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(LoginResponse{Code: 3, Message: "Token generation failed"})
+		return
+	}
+	_ = encoder.Encode(loginSuccess(pair))
+}
+
+// renderMagicConfirmPage 渲染登录确认页面，页面以表单 POST 提交令牌
+func renderMagicConfirmPage(w http.ResponseWriter, r *http.Request, token string) {
+	tmpl, err := template.ParseFiles(magicConfirmPagePath)
+	if err != nil {
+		log.Printf("加载登录确认页面模板失败: %v", err)
+		http.Error(w, "Failed to load page template", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	// 令牌出现在页面中，不能被 Referer 带到其他站点
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	data := struct {
+		AppName string
+		Action  string
+		Token   string
+	}{config.GetConfig().Name, r.URL.Path, token}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("渲染登录确认页面失败: %v", err)
+	}
+}
@@ -0,0 +1,291 @@
+package users
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/patrickmn/go-cache"
+	"goauthx/internal/account"
+	"goauthx/internal/web/account/jwts"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 登录第二步的挑战令牌，5分钟有效，最多允许尝试5次
+var (
+	mfaChallengeCache = cache.New(5*time.Minute, 10*time.Minute)
+	// mfaChallengeMu 保护挑战令牌的尝试次数与完成状态
+	mfaChallengeMu sync.Mutex
+)
+
+const mfaMaxAttempts = 5
+
+type mfaChallenge struct {
+	UserID   int
+	Attempts int
+	Done     bool
+}
+
+type LoginMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type MFARequest struct {
+	Code     string `json:"code"`
+	Password string `json:"password"`
+}
+
+type MFAResponse struct {
+	Code          int      `json:"code"`
+	Message       string   `json:"message"`
+	Secret        string   `json:"secret,omitempty"`
+	URI           string   `json:"uri,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// newMFAChallenge 为已通过密码校验的用户生成登录挑战令牌
+func newMFAChallenge(userID int) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	mfaChallengeCache.Set(token, &mfaChallenge{UserID: userID}, cache.DefaultExpiration)
+	return token, nil
+}
+
+// beginMFAAttempt 取出挑战令牌并在校验前占用一次尝试次数，并发请求也不会超过上限
+// 令牌不存在、已完成或次数用尽时返回 false
+func beginMFAAttempt(token string) (*mfaChallenge, bool) {
+	mfaChallengeMu.Lock()
+	defer mfaChallengeMu.Unlock()
+	val, found := mfaChallengeCache.Get(token)
+	if !found {
+		return nil, false
+	}
+	challenge := val.(*mfaChallenge)
+	if challenge.Done || challenge.Attempts >= mfaMaxAttempts {
+		mfaChallengeCache.Delete(token)
+		return nil, false
+	}
+	challenge.Attempts++
+	return challenge, true
+}
+
+// finishMFAChallenge 校验成功后作废挑战令牌，同一令牌只有一个请求能完成登录
+func finishMFAChallenge(token string, challenge *mfaChallenge) bool {
+	mfaChallengeMu.Lock()
+	defer mfaChallengeMu.Unlock()
+	if challenge.Done {
+		return false
+	}
+	challenge.Done = true
+	mfaChallengeCache.Delete(token)
+	return true
+}
+
+// HandleLoginMFA 登录第二步：校验动态码或恢复码后签发 Token
+func HandleLoginMFA(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var req LoginMFARequest
+	encoder := json.NewEncoder(w)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(LoginResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	req.MFAToken = strings.TrimSpace(req.MFAToken)
+	req.Code = strings.TrimSpace(req.Code)
+	if req.MFAToken == "" || req.Code == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(LoginResponse{Code: 1, Message: "Missing fields"})
+		return
+	}
+
+	challenge, ok := beginMFAAttempt(req.MFAToken)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(LoginResponse{Code: 6, Message: "Invalid or expired MFA token"})
+		return
+	}
+
+	user, err := account.FindUserByID(int64(challenge.UserID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(LoginResponse{Code: 1, Message: "Database error"})
+		return
+	}
+	if err := account.VerifyMFA(user, req.Code); err != nil {
+		if errors.Is(err, account.ErrMFALocked) {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_ = encoder.Encode(LoginResponse{Code: 2, Message: "Too many failed attempts, please try again later"})
+			return
+		}
+		if !errors.Is(err, account.ErrInvalidMFACode) {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = encoder.Encode(LoginResponse{Code: 1, Message: "Database error"})
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(LoginResponse{Code: 2, Message: "Incorrect code"})
+		return
+	}
+	if !finishMFAChallenge(req.MFAToken, challenge) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(LoginResponse{Code: 6, Message: "Invalid or expired MFA token"})
+		return
+	}
+
+	pair, err := jwts.IssueTokenPair(challenge.UserID, sessionInfo(r), jwts.Grant{})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(LoginResponse{Code: 3, Message: "Token generation failed"})
+		return
+	}
+
+	_ = encoder.Encode(loginSuccess(pair))
+}
+
+// HandleTOTPSetup 生成待确认的 TOTP 密钥
+func HandleTOTPSetup(w http.ResponseWriter, r *http.Request) {
+	encoder := json.NewEncoder(w)
+	claims, ok := authenticate(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(MFAResponse{Code: 6, Message: "Unauthorized"})
+		return
+	}
+	secret, uri, err := account.BeginTOTPEnrollment(int64(claims.UserID))
+	if err != nil {
+		writeMFAError(w, encoder, err)
+		return
+	}
+	_ = encoder.Encode(MFAResponse{Code: 0, Message: "TOTP secret generated", Secret: secret, URI: uri})
+}
+
+// HandleTOTPConfirm 校验动态码后启用两步验证，返回恢复码（仅此一次）
+func HandleTOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	claims, ok := authenticate(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(MFAResponse{Code: 6, Message: "Unauthorized"})
+		return
+	}
+	var req MFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Code) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(MFAResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	codes, err := account.ConfirmTOTPEnrollment(int64(claims.UserID), req.Code)
+	if err != nil {
+		writeMFAError(w, encoder, err)
+		return
+	}
+	_ = encoder.Encode(MFAResponse{Code: 0, Message: "Two-factor authentication enabled", RecoveryCodes: codes})
+}
+
+// HandleTOTPDisable 关闭两步验证，需要当前密码和动态码（或恢复码）
+func HandleTOTPDisable(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	claims, ok := authenticate(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(MFAResponse{Code: 6, Message: "Unauthorized"})
+		return
+	}
+	var req MFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(MFAResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	if strings.TrimSpace(req.Password) == "" || strings.TrimSpace(req.Code) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(MFAResponse{Code: 1, Message: "Missing fields"})
+		return
+	}
+	user, err := account.FindUserByID(int64(claims.UserID))
+	if err != nil {
+		writeMFAError(w, encoder, err)
+		return
+	}
+	if !account.CheckPassword(user, strings.TrimSpace(req.Password)) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(MFAResponse{Code: 3, Message: "Incorrect password"})
+		return
+	}
+	if err := account.VerifyMFA(user, req.Code); err != nil {
+		writeMFAError(w, encoder, err)
+		return
+	}
+	if err := account.DisableTOTP(user.UserId); err != nil {
+		writeMFAError(w, encoder, err)
+		return
+	}
+	_ = encoder.Encode(MFAResponse{Code: 0, Message: "Two-factor authentication disabled"})
+}
+
+// HandleRecoveryCodesRegenerate 重新生成恢复码，需要当前动态码（或恢复码）
+func HandleRecoveryCodesRegenerate(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	claims, ok := authenticate(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(MFAResponse{Code: 6, Message: "Unauthorized"})
+		return
+	}
+	var req MFARequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Code) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(MFAResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	user, err := account.FindUserByID(int64(claims.UserID))
+	if err != nil {
+		writeMFAError(w, encoder, err)
+		return
+	}
+	if err := account.VerifyMFA(user, req.Code); err != nil {
+		writeMFAError(w, encoder, err)
+		return
+	}
+	codes, err := account.RegenerateRecoveryCodes(user.UserId)
+	if err != nil {
+		writeMFAError(w, encoder, err)
+		return
+	}
+	_ = encoder.Encode(MFAResponse{Code: 0, Message: "Recovery codes regenerated", RecoveryCodes: codes})
+}
+
+// writeMFAError 将两步验证相关错误转换为响应
+func writeMFAError(w http.ResponseWriter, encoder *json.Encoder, err error) {
+	switch {
+	case errors.Is(err, account.ErrInvalidMFACode):
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(MFAResponse{Code: 4, Message: "Invalid two-factor code"})
+	case errors.Is(err, account.ErrMFALocked):
+		w.WriteHeader(http.StatusTooManyRequests)
+		_ = encoder.Encode(MFAResponse{Code: 4, Message: "Too many failed attempts, please try again later"})
+	case errors.Is(err, account.ErrMFAAlreadyEnabled):
+		w.WriteHeader(http.StatusConflict)
+		_ = encoder.Encode(MFAResponse{Code: 1, Message: "Two-factor authentication already enabled"})
+	case errors.Is(err, account.ErrMFANotEnabled):
+		w.WriteHeader(http.StatusConflict)
+		_ = encoder.Encode(MFAResponse{Code: 1, Message: "Two-factor authentication not enabled"})
+	case errors.Is(err, account.ErrNoPendingTOTP):
+		w.WriteHeader(http.StatusConflict)
+		_ = encoder.Encode(MFAResponse{Code: 1, Message: "No pending TOTP enrollment"})
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(MFAResponse{Code: 2, Message: "Database error"})
+	}
+}
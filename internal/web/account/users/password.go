@@ -0,0 +1,87 @@
+package users
+
+import (
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"goauthx/internal/account"
+	"goauthx/internal/web/account/captcha"
+	"net/http"
+	"strings"
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Email    string `json:"email"`
+	Captcha  string `json:"captcha"`
+	Password string `json:"password"`
+}
+
+// HandleForgotPassword 向账号邮箱发送重置密码验证码
+func HandleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var req ForgotPasswordRequest
+	encoder := json.NewEncoder(w)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(captcha.CaptchaResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(captcha.CaptchaResponse{Code: 1, Message: "Missing email"})
+		return
+	}
+
+	if _, err := account.FindUserByEmail(req.Email); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// 邮箱未注册时同样返回成功，避免被用来探测账号是否存在
+			_ = encoder.Encode(captcha.CaptchaResponse{Code: 0, Message: "Captcha sent"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(captcha.CaptchaResponse{Code: 2, Message: "Database error"})
+		return
+	}
+
+	resp, status := captcha.SendCaptcha(req.Email, captcha.ClientIP(r))
+	w.WriteHeader(status)
+	_ = encoder.Encode(resp)
+}
+
+// HandleResetPassword 校验邮箱验证码后重置密码，并强制下线所有会话
+func HandleResetPassword(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var req ResetPasswordRequest
+	encoder := json.NewEncoder(w)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(account.PasswordResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	req.Captcha = strings.TrimSpace(req.Captcha)
+	if req.Email == "" || req.Captcha == "" || strings.TrimSpace(req.Password) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(account.PasswordResponse{Code: 1, Message: "Missing fields"})
+		return
+	}
+	if !captcha.VerifyCaptcha(req.Email, req.Captcha) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(account.PasswordResponse{Code: 4, Message: "Invalid or expired captcha"})
+		return
+	}
+
+	resp, status := account.ResetPassword(req.Email, req.Password)
+	if resp.Code == 0 {
+		if user, err := account.FindUserByEmail(req.Email); err == nil {
+			revokeTokensAfterPasswordChange(int(user.UserId))
+		}
+	}
+	w.WriteHeader(status)
+	_ = encoder.Encode(resp)
+}
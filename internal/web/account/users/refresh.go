@@ -0,0 +1,54 @@
+package users
+
+import (
+	"encoding/json"
+	"errors"
+	"goauthx/internal/web/account/jwts"
+	"net/http"
+	"strings"
+)
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// HandleRefreshToken 使用 Refresh Token 换取新的 Access Token 和 Refresh Token
+func HandleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var req RefreshRequest
+	encoder := json.NewEncoder(w)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(LoginResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	req.RefreshToken = strings.TrimSpace(req.RefreshToken)
+	if req.RefreshToken == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(LoginResponse{Code: 1, Message: "Missing fields"})
+		return
+	}
+
+	pair, err := jwts.RefreshTokenPair(req.RefreshToken, "", sessionInfo(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, jwts.ErrRefreshTokenReused):
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = encoder.Encode(LoginResponse{Code: 2, Message: "Refresh token reused, session revoked"})
+		case errors.Is(err, jwts.ErrInvalidRefreshToken), errors.Is(err, jwts.ErrClientMismatch):
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = encoder.Encode(LoginResponse{Code: 2, Message: "Invalid or expired refresh token"})
+		case errors.Is(err, jwts.ErrRefreshDenied):
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = encoder.Encode(LoginResponse{Code: 2, Message: "User is not allowed to log in, session revoked"})
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = encoder.Encode(LoginResponse{Code: 3, Message: "Token generation failed"})
+		}
+		return
+	}
+
+	pairResp := loginSuccess(pair)
+	pairResp.Message = "Token refreshed"
+	_ = encoder.Encode(pairResp)
+}
@@ -28,6 +28,7 @@ func HandleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	req.EmailVerified = true
 	resp, status := account.RegisterUser(&req)
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(resp)
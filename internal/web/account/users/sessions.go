@@ -0,0 +1,114 @@
+package users
+
+import (
+	"encoding/json"
+	"goauthx/internal/web/account/jwts"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type SessionView struct {
+	ID        string    `json:"id"`
+	JTI       string    `json:"jti,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+	Current   bool      `json:"current"`
+}
+
+type SessionResponse struct {
+	Code     int           `json:"code"`
+	Message  string        `json:"message"`
+	Sessions []SessionView `json:"sessions,omitempty"`
+}
+
+// HandleLogout 注销当前会话（包括该会话的 Refresh Token）
+func HandleLogout(w http.ResponseWriter, r *http.Request) {
+	encoder := json.NewEncoder(w)
+	claims, ok := authenticate(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(SessionResponse{Code: 6, Message: "Unauthorized"})
+		return
+	}
+	if _, err := jwts.RemoveUserSession(claims.UserID, claims.SessionID); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(SessionResponse{Code: 2, Message: "Database error"})
+		return
+	}
+	_ = encoder.Encode(SessionResponse{Code: 0, Message: "Logout success"})
+}
+
+// HandleLogoutAll 注销当前用户的所有会话
+func HandleLogoutAll(w http.ResponseWriter, r *http.Request) {
+	encoder := json.NewEncoder(w)
+	claims, ok := authenticate(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(SessionResponse{Code: 6, Message: "Unauthorized"})
+		return
+	}
+	jwts.RemoveUserJWTsFromWhitelist(claims.UserID)
+	_ = encoder.Encode(SessionResponse{Code: 0, Message: "Logout success"})
+}
+
+// HandleListSessions 列出当前用户的所有有效会话
+func HandleListSessions(w http.ResponseWriter, r *http.Request) {
+	encoder := json.NewEncoder(w)
+	claims, ok := authenticate(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(SessionResponse{Code: 6, Message: "Unauthorized"})
+		return
+	}
+	list, err := jwts.ListUserSessions(claims.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(SessionResponse{Code: 2, Message: "Database error"})
+		return
+	}
+	sessions := make([]SessionView, 0, len(list))
+	for _, s := range list {
+		sessions = append(sessions, SessionView{
+			ID:        s.ID,
+			JTI:       s.JTI,
+			CreatedAt: s.CreatedAt,
+			ExpiresAt: s.ExpiresAt,
+			UserAgent: s.UserAgent,
+			IP:        s.IP,
+			Current:   s.ID == claims.SessionID,
+		})
+	}
+	_ = encoder.Encode(SessionResponse{Code: 0, Message: "OK", Sessions: sessions})
+}
+
+// HandleRevokeSession 注销当前用户的指定会话，路径参数可以是会话ID或其中任一 Token 的 jti
+func HandleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	encoder := json.NewEncoder(w)
+	claims, ok := authenticate(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(SessionResponse{Code: 6, Message: "Unauthorized"})
+		return
+	}
+	jti := strings.TrimSpace(r.PathValue("jti"))
+	if jti == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(SessionResponse{Code: 1, Message: "Missing jti"})
+		return
+	}
+	removed, err := jwts.RemoveUserSession(claims.UserID, jti)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(SessionResponse{Code: 2, Message: "Database error"})
+		return
+	}
+	if !removed {
+		w.WriteHeader(http.StatusNotFound)
+		_ = encoder.Encode(SessionResponse{Code: 1, Message: "Session not found"})
+		return
+	}
+	_ = encoder.Encode(SessionResponse{Code: 0, Message: "Session revoked"})
+}
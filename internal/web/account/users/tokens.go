@@ -0,0 +1,182 @@
+package users
+
+import (
+	"encoding/json"
+	"errors"
+	"goauthx/internal/rbac"
+	"goauthx/internal/web/account/pat"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type CreateTokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays 有效天数，0 表示永不过期
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+type TokenView struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	Expired    bool       `json:"expired"`
+}
+
+type TokenListResponse struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Token   string      `json:"token,omitempty"`
+	Tokens  []TokenView `json:"tokens,omitempty"`
+}
+
+func tokenView(t *pat.Token, now time.Time) TokenView {
+	return TokenView{
+		ID:         t.ID,
+		Name:       t.Name,
+		Prefix:     t.Prefix,
+		Scopes:     t.Scopes,
+		CreatedAt:  t.CreatedAt,
+		ExpiresAt:  t.ExpiresAt,
+		LastUsedAt: t.LastUsedAt,
+		LastUsedIP: t.LastUsedIP,
+		Expired:    t.Expired(now),
+	}
+}
+
+// HandleCreateToken 创建个人访问令牌，令牌明文只在响应中出现一次
+// 只能使用第一方登录获得的 JWT 调用，个人访问令牌、OAuth 客户端与服务账号的 Token 不能创建新的令牌
+// 令牌的 scope 不能超出用户当前角色拥有的权限
+func HandleCreateToken(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	claims, ok := authenticate(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(TokenListResponse{Code: 6, Message: "Unauthorized"})
+		return
+	}
+	var req CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ExpiresInDays < 0 || req.ExpiresInDays > 3650 {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(TokenListResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	held, err := holdsScopes(claims.UserID, req.Scopes)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(TokenListResponse{Code: 2, Message: "Database error"})
+		return
+	}
+	if !held {
+		w.WriteHeader(http.StatusForbidden)
+		_ = encoder.Encode(TokenListResponse{Code: 8, Message: "Scope exceeds your permissions"})
+		return
+	}
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	token, plain, err := pat.CreateToken(claims.UserID, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, pat.ErrInvalidName):
+			w.WriteHeader(http.StatusBadRequest)
+			_ = encoder.Encode(TokenListResponse{Code: 1, Message: "Invalid token name"})
+		case errors.Is(err, pat.ErrInvalidScope):
+			w.WriteHeader(http.StatusBadRequest)
+			_ = encoder.Encode(TokenListResponse{Code: 1, Message: "Invalid scope"})
+		case errors.Is(err, pat.ErrTooManyTokens):
+			w.WriteHeader(http.StatusBadRequest)
+			_ = encoder.Encode(TokenListResponse{Code: 1, Message: "Too many tokens"})
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = encoder.Encode(TokenListResponse{Code: 2, Message: "Database error"})
+		}
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	_ = encoder.Encode(TokenListResponse{
+		Code:    0,
+		Message: "Token created",
+		Token:   plain,
+		Tokens:  []TokenView{tokenView(token, time.Now())},
+	})
+}
+
+// holdsScopes 判断用户当前的角色是否拥有全部 scope
+func holdsScopes(userID int, scopes []string) (bool, error) {
+	if len(scopes) == 0 {
+		return true, nil
+	}
+	roles, err := rbac.UserRoles(userID)
+	if err != nil {
+		return false, err
+	}
+	for _, scope := range scopes {
+		ok, err := rbac.HasPermission(roles, strings.TrimSpace(scope))
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// HandleListTokens 列出当前用户的个人访问令牌
+func HandleListTokens(w http.ResponseWriter, r *http.Request) {
+	encoder := json.NewEncoder(w)
+	claims, ok := authenticate(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(TokenListResponse{Code: 6, Message: "Unauthorized"})
+		return
+	}
+	list, err := pat.ListTokens(claims.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(TokenListResponse{Code: 2, Message: "Database error"})
+		return
+	}
+	now := time.Now()
+	tokens := make([]TokenView, 0, len(list))
+	for i := range list {
+		tokens = append(tokens, tokenView(&list[i], now))
+	}
+	_ = encoder.Encode(TokenListResponse{Code: 0, Message: "OK", Tokens: tokens})
+}
+
+// HandleRevokeToken 吊销当前用户的某个个人访问令牌
+func HandleRevokeToken(w http.ResponseWriter, r *http.Request) {
+	encoder := json.NewEncoder(w)
+	claims, ok := authenticate(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(TokenListResponse{Code: 6, Message: "Unauthorized"})
+		return
+	}
+	id := strings.TrimSpace(r.PathValue("id"))
+	if id == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(TokenListResponse{Code: 1, Message: "Missing token id"})
+		return
+	}
+	if err := pat.RevokeToken(claims.UserID, id); err != nil {
+		if errors.Is(err, pat.ErrTokenNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			_ = encoder.Encode(TokenListResponse{Code: 1, Message: "Token not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(TokenListResponse{Code: 2, Message: "Database error"})
+		return
+	}
+	_ = encoder.Encode(TokenListResponse{Code: 0, Message: "Token revoked"})
+}
@@ -0,0 +1,103 @@
+package users
+
+import (
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"goauthx/internal/account"
+	"goauthx/internal/web/account/captcha"
+	"log"
+	"net/http"
+	"strings"
+)
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+// HandleVerifyEmail 使用验证邮件中的令牌完成邮箱验证
+// 验证链接为 GET /email/verify?token=...，也可以 POST JSON 提交令牌
+func HandleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	token := r.URL.Query().Get("token")
+	if r.Method == http.MethodPost {
+		var req VerifyEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = encoder.Encode(account.EmailResponse{Code: 1, Message: "Invalid request"})
+			return
+		}
+		token = req.Token
+	}
+	if strings.TrimSpace(token) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(account.EmailResponse{Code: 1, Message: "Missing token"})
+		return
+	}
+
+	if _, err := account.VerifyEmail(token); err != nil {
+		if errors.Is(err, account.ErrInvalidVerificationToken) {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = encoder.Encode(account.EmailResponse{Code: 4, Message: "Invalid or expired verification token"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(account.EmailResponse{Code: 2, Message: "Database error"})
+		return
+	}
+	_ = encoder.Encode(account.EmailResponse{Code: 0, Message: "Email verified"})
+}
+
+// HandleResendVerification 重新发送验证邮件，与验证码共用邮箱和IP限速
+func HandleResendVerification(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var req ResendVerificationRequest
+	encoder := json.NewEncoder(w)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(captcha.CaptchaResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Email == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(captcha.CaptchaResponse{Code: 1, Message: "Missing email"})
+		return
+	}
+	clientIP := captcha.ClientIP(r)
+	if resp, status, limited := captcha.CheckRateLimit(req.Email, clientIP); limited {
+		w.WriteHeader(status)
+		_ = encoder.Encode(resp)
+		return
+	}
+	captcha.RecordSend(req.Email, clientIP)
+
+	// 邮箱未注册或已验证时同样返回成功并计入限速，避免被用来探测账号是否存在
+	sent := captcha.CaptchaResponse{Code: 0, Message: "Verification email sent"}
+	user, err := account.FindUserByEmail(req.Email)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			_ = encoder.Encode(sent)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(captcha.CaptchaResponse{Code: 2, Message: "Database error"})
+		return
+	}
+	if user.IsEmailVerified() {
+		_ = encoder.Encode(sent)
+		return
+	}
+	if err := account.SendVerificationEmail(user); err != nil {
+		log.Printf("发送用户 %d 的验证邮件失败: %v", user.UserId, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(captcha.CaptchaResponse{Code: 2, Message: "Failed to send email"})
+		return
+	}
+	_ = encoder.Encode(sent)
+}
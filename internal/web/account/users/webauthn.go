@@ -0,0 +1,523 @@
+package users
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/patrickmn/go-cache"
+	"go.mongodb.org/mongo-driver/mongo"
+	"goauthx/internal/account"
+	"goauthx/internal/config"
+	"goauthx/internal/web/account/jwts"
+	"goauthx/internal/webauthn"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	webauthnRegister = "register"
+	webauthnLogin    = "login"
+)
+
+var (
+	// 注册与登录仪式的挑战只保存在内存中，每个挑战只能使用一次
+	webauthnSessionCache = cache.New(5*time.Minute, 10*time.Minute)
+	webauthnSessionMu    sync.Mutex
+
+	errWebAuthnNotConfigured = errors.New("webauthn.rp_id/webauthn.origins or oauth.issuer must be set to use passkeys")
+)
+
+// webauthnSession 进行中的注册或登录仪式
+type webauthnSession struct {
+	Kind      string
+	Challenge []byte
+	// UserID 注册的用户，或第二步验证的用户；免密登录时为 0
+	UserID int
+	// MFAToken 第二步验证时 /login 返回的挑战令牌
+	MFAToken string
+	Name     string
+}
+
+type WebAuthnRegisterBeginRequest struct {
+	Password string `json:"password"`
+	// Name 凭据名称，如 "MacBook"
+	Name string `json:"name"`
+}
+
+type WebAuthnLoginBeginRequest struct {
+	// MFAToken 使用通行密钥代替动态码完成 /login 的第二步，为空时为免密登录
+	MFAToken string `json:"mfa_token"`
+}
+
+type WebAuthnRegisterFinishRequest struct {
+	Session    string                       `json:"session"`
+	Credential webauthn.AttestationResponse `json:"credential"`
+}
+
+type WebAuthnLoginFinishRequest struct {
+	Session    string                     `json:"session"`
+	Credential webauthn.AssertionResponse `json:"credential"`
+}
+
+type WebAuthnBeginResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Session string `json:"session,omitempty"`
+	// PublicKey 传给 navigator.credentials.create() 或 get() 的参数
+	PublicKey any `json:"publicKey,omitempty"`
+}
+
+type WebAuthnCredentialView struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Algorithm  int64      `json:"algorithm"`
+	Transports []string   `json:"transports,omitempty"`
+	Synced     bool       `json:"synced"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type WebAuthnCredentialResponse struct {
+	Code        int                      `json:"code"`
+	Message     string                   `json:"message"`
+	Credential  *WebAuthnCredentialView  `json:"credential,omitempty"`
+	Credentials []WebAuthnCredentialView `json:"credentials,omitempty"`
+}
+
+func webauthnCredentialView(c *account.WebAuthnCredential) WebAuthnCredentialView {
+	return WebAuthnCredentialView{
+		ID:         base64.RawURLEncoding.EncodeToString(c.ID),
+		Name:       c.Name,
+		Algorithm:  c.Algorithm,
+		Transports: c.Transports,
+		Synced:     c.BackupEligible,
+		CreatedAt:  c.CreatedAt,
+		LastUsedAt: c.LastUsedAt,
+	}
+}
+
+// relyingParty 按配置构造依赖方，未配置时使用 oauth.issuer 的域名与来源
+// 与邮件链接一样不按请求的 Host 推断
+func relyingParty() (*webauthn.RelyingParty, error) {
+	cfg := config.GetConfig()
+	rp := &webauthn.RelyingParty{ID: cfg.WebAuthn.RPID, Name: cfg.WebAuthn.RPName, Origins: cfg.WebAuthn.Origins}
+	if u, err := url.Parse(cfg.OAuth.Issuer); err == nil && u.Host != "" {
+		if rp.ID == "" {
+			rp.ID = u.Hostname()
+		}
+		if len(rp.Origins) == 0 {
+			rp.Origins = []string{u.Scheme + "://" + u.Host}
+		}
+	}
+	if rp.Name == "" {
+		rp.Name = cfg.Name
+	}
+	if rp.ID == "" || len(rp.Origins) == 0 {
+		return nil, errWebAuthnNotConfigured
+	}
+	return rp, nil
+}
+
+func webauthnTimeout() time.Duration {
+	if seconds := config.GetConfig().WebAuthn.TimeoutSeconds; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 5 * time.Minute
+}
+
+// newWebAuthnSession 保存仪式的挑战，返回会话ID
+func newWebAuthnSession(s *webauthnSession) string {
+	id := hex.EncodeToString(randomBytes(32))
+	webauthnSessionCache.Set(id, s, webauthnTimeout())
+	return id
+}
+
+// takeWebAuthnSession 取出并作废仪式，无论校验是否成功都不能再次使用
+func takeWebAuthnSession(id, kind string) *webauthnSession {
+	webauthnSessionMu.Lock()
+	defer webauthnSessionMu.Unlock()
+	val, found := webauthnSessionCache.Get(id)
+	if !found {
+		return nil
+	}
+	webauthnSessionCache.Delete(id)
+	s := val.(*webauthnSession)
+	if s.Kind != kind {
+		return nil
+	}
+	return s
+}
+
+// credentialDescriptors 用户已注册的凭据，用于排除重复注册或限定登录使用的凭据
+func credentialDescriptors(user *account.UserDoc) []webauthn.CredentialDescriptor {
+	list := make([]webauthn.CredentialDescriptor, 0, len(user.WebAuthnCredentials))
+	for _, c := range user.WebAuthnCredentials {
+		list = append(list, webauthn.CredentialDescriptor{
+			Type:       webauthn.PublicKeyCredentialType,
+			ID:         c.ID,
+			Transports: c.Transports,
+		})
+	}
+	return list
+}
+
+// HandleWebAuthnRegisterBegin 开始注册通行密钥，需要当前密码
+func HandleWebAuthnRegisterBegin(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	claims, ok := authenticate(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(WebAuthnBeginResponse{Code: 6, Message: "Unauthorized"})
+		return
+	}
+	var req WebAuthnRegisterBeginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(WebAuthnBeginResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if strings.TrimSpace(req.Password) == "" || len(req.Name) > 100 {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(WebAuthnBeginResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	rp, err := relyingParty()
+	if err != nil {
+		log.Printf("通行密钥: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(WebAuthnBeginResponse{Code: 2, Message: "Passkeys are not configured"})
+		return
+	}
+	user, err := account.FindUserByID(int64(claims.UserID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(WebAuthnBeginResponse{Code: 2, Message: "Database error"})
+		return
+	}
+	if !account.CheckPassword(user, strings.TrimSpace(req.Password)) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(WebAuthnBeginResponse{Code: 3, Message: "Incorrect password"})
+		return
+	}
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(WebAuthnBeginResponse{Code: 2, Message: "Challenge generation failed"})
+		return
+	}
+	options := rp.CreationOptions(challenge, webauthn.UserEntity{
+		ID:          account.WebAuthnUserHandle(user.UserId),
+		Name:        user.Username,
+		DisplayName: user.Username,
+	}, credentialDescriptors(user), webauthnTimeout().Milliseconds())
+	session := newWebAuthnSession(&webauthnSession{
+		Kind:      webauthnRegister,
+		Challenge: challenge,
+		UserID:    claims.UserID,
+		Name:      req.Name,
+	})
+	_ = encoder.Encode(WebAuthnBeginResponse{Code: 0, Message: "Registration started", Session: session, PublicKey: options})
+}
+
+// HandleWebAuthnRegisterFinish 校验认证器的响应并保存通行密钥
+func HandleWebAuthnRegisterFinish(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	claims, ok := authenticate(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(WebAuthnCredentialResponse{Code: 6, Message: "Unauthorized"})
+		return
+	}
+	var req WebAuthnRegisterFinishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(WebAuthnCredentialResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	session := takeWebAuthnSession(req.Session, webauthnRegister)
+	if session == nil || session.UserID != claims.UserID {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(WebAuthnCredentialResponse{Code: 6, Message: "Invalid or expired session"})
+		return
+	}
+	rp, err := relyingParty()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(WebAuthnCredentialResponse{Code: 2, Message: "Passkeys are not configured"})
+		return
+	}
+	cred, err := rp.VerifyRegistration(&req.Credential, session.Challenge, false)
+	if err != nil {
+		log.Printf("用户 %d 注册通行密钥失败: %v", claims.UserID, err)
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(WebAuthnCredentialResponse{Code: 4, Message: "Passkey verification failed"})
+		return
+	}
+
+	stored := account.WebAuthnCredential{
+		ID:             cred.ID,
+		Name:           session.Name,
+		PublicKey:      cred.PublicKey,
+		Algorithm:      cred.Algorithm,
+		SignCount:      cred.SignCount,
+		AAGUID:         cred.AAGUID,
+		Transports:     cred.Transports,
+		BackupEligible: cred.BackupEligible,
+		CreatedAt:      time.Now(),
+	}
+	if err := account.AddWebAuthnCredential(int64(claims.UserID), stored); err != nil {
+		switch {
+		case errors.Is(err, account.ErrWebAuthnCredentialExists):
+			w.WriteHeader(http.StatusConflict)
+			_ = encoder.Encode(WebAuthnCredentialResponse{Code: 1, Message: "Passkey already registered"})
+		case errors.Is(err, account.ErrWebAuthnCredentialLimit):
+			w.WriteHeader(http.StatusConflict)
+			_ = encoder.Encode(WebAuthnCredentialResponse{Code: 1, Message: "Too many passkeys"})
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = encoder.Encode(WebAuthnCredentialResponse{Code: 2, Message: "Database error"})
+		}
+		return
+	}
+	view := webauthnCredentialView(&stored)
+	_ = encoder.Encode(WebAuthnCredentialResponse{Code: 0, Message: "Passkey registered", Credential: &view})
+}
+
+// HandleWebAuthnLoginBegin 开始使用通行密钥登录
+// 不带 mfa_token 时为免密登录，由认证器选择可发现凭据并要求用户验证；
+// 带 mfa_token 时代替动态码完成第二步验证，只允许使用该用户的凭据
+func HandleWebAuthnLoginBegin(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	var req WebAuthnLoginBeginRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = encoder.Encode(WebAuthnBeginResponse{Code: 1, Message: "Invalid request"})
+			return
+		}
+	}
+	rp, err := relyingParty()
+	if err != nil {
+		log.Printf("通行密钥: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(WebAuthnBeginResponse{Code: 2, Message: "Passkeys are not configured"})
+		return
+	}
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(WebAuthnBeginResponse{Code: 2, Message: "Challenge generation failed"})
+		return
+	}
+
+	session := &webauthnSession{Kind: webauthnLogin, Challenge: challenge}
+	var allowed []webauthn.CredentialDescriptor
+	userVerification := "required"
+	if req.MFAToken = strings.TrimSpace(req.MFAToken); req.MFAToken != "" {
+		val, found := mfaChallengeCache.Get(req.MFAToken)
+		if !found {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = encoder.Encode(WebAuthnBeginResponse{Code: 6, Message: "Invalid or expired MFA token"})
+			return
+		}
+		userID := val.(*mfaChallenge).UserID
+		user, err := account.FindUserByID(int64(userID))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = encoder.Encode(WebAuthnBeginResponse{Code: 2, Message: "Database error"})
+			return
+		}
+		if len(user.WebAuthnCredentials) == 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = encoder.Encode(WebAuthnBeginResponse{Code: 1, Message: "No passkeys registered"})
+			return
+		}
+		allowed = credentialDescriptors(user)
+		userVerification = "discouraged"
+		session.UserID = userID
+		session.MFAToken = req.MFAToken
+	}
+
+	options := rp.RequestOptions(challenge, allowed, userVerification, webauthnTimeout().Milliseconds())
+	_ = encoder.Encode(WebAuthnBeginResponse{Code: 0, Message: "Login started", Session: newWebAuthnSession(session), PublicKey: options})
+}
+
+// HandleWebAuthnLoginFinish 校验认证器的签名后签发 Token
+func HandleWebAuthnLoginFinish(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	var req WebAuthnLoginFinishRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(LoginResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	session := takeWebAuthnSession(req.Session, webauthnLogin)
+	if session == nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(LoginResponse{Code: 6, Message: "Invalid or expired session"})
+		return
+	}
+	rp, err := relyingParty()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(LoginResponse{Code: 2, Message: "Passkeys are not configured"})
+		return
+	}
+
+	// 第二步验证时 /login 的挑战令牌必须仍然有效，与动态码共用尝试次数
+	var challenge *mfaChallenge
+	if session.MFAToken != "" {
+		var ok bool
+		if challenge, ok = beginMFAAttempt(session.MFAToken); !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = encoder.Encode(LoginResponse{Code: 6, Message: "Invalid or expired MFA token"})
+			return
+		}
+	}
+
+	credentialID := []byte(req.Credential.RawID)
+	if len(credentialID) == 0 {
+		credentialID, _ = base64.RawURLEncoding.DecodeString(req.Credential.ID)
+	}
+	user, cred, err := account.FindUserByWebAuthnCredential(credentialID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = encoder.Encode(LoginResponse{Code: 1, Message: "Unknown passkey"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(LoginResponse{Code: 1, Message: "Database error"})
+		return
+	}
+	userID := int(user.UserId)
+	if challenge != nil && challenge.UserID != userID {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(LoginResponse{Code: 1, Message: "Unknown passkey"})
+		return
+	}
+	// 免密登录时认证器返回的用户标识必须与凭据所属用户一致
+	if challenge == nil {
+		handleID, ok := account.ParseWebAuthnUserHandle(req.Credential.Response.UserHandle)
+		if !ok || handleID != user.UserId {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = encoder.Encode(LoginResponse{Code: 1, Message: "Unknown passkey"})
+			return
+		}
+	}
+
+	ad, err := rp.VerifyAssertion(&req.Credential, session.Challenge, cred.PublicKey, cred.SignCount, challenge == nil)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCount) {
+			log.Printf("用户 %d 的通行密钥签名计数回退，认证器可能被克隆", userID)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(LoginResponse{Code: 2, Message: "Passkey verification failed"})
+		return
+	}
+	if err := account.UpdateWebAuthnSignCount(user.UserId, cred.ID, ad.SignCount); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(LoginResponse{Code: 1, Message: "Database error"})
+		return
+	}
+
+	if challenge != nil {
+		if !finishMFAChallenge(session.MFAToken, challenge) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = encoder.Encode(LoginResponse{Code: 6, Message: "Invalid or expired MFA token"})
+			return
+		}
+	} else {
+		// 免密登录不经过 /login，需要在这里检查封禁与邮箱验证
+		banned, banInfo, err := account.IsUserBanned(userID)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = encoder.Encode(LoginResponse{Code: 4, Message: "Ban check failed"})
+			return
+		}
+		if banned {
+			msg := "User is banned"
+			if banInfo != nil && banInfo.BanReason != "" {
+				msg += ": " + banInfo.BanReason
+			}
+			w.WriteHeader(http.StatusForbidden)
+			_ = encoder.Encode(LoginResponse{Code: 5, Message: msg})
+			return
+		}
+		if account.EmailVerificationRequired(user) {
+			w.WriteHeader(http.StatusForbidden)
+			_ = encoder.Encode(LoginResponse{Code: 9, Message: "Email not verified"})
+			return
+		}
+		// 经过用户验证的通行密钥本身就是两个因素，不再要求动态码
+	}
+
+	pair, err := jwts.IssueTokenPair(userID, sessionInfo(r), jwts.Grant{})
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(LoginResponse{Code: 3, Message: "Token generation failed"})
+		return
+	}
+	_ = encoder.Encode(loginSuccess(pair))
+}
+
+// HandleListWebAuthnCredentials 列出当前用户的通行密钥
+func HandleListWebAuthnCredentials(w http.ResponseWriter, r *http.Request) {
+	encoder := json.NewEncoder(w)
+	claims, ok := authenticate(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(WebAuthnCredentialResponse{Code: 6, Message: "Unauthorized"})
+		return
+	}
+	user, err := account.FindUserByID(int64(claims.UserID))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(WebAuthnCredentialResponse{Code: 2, Message: "Database error"})
+		return
+	}
+	views := make([]WebAuthnCredentialView, 0, len(user.WebAuthnCredentials))
+	for i := range user.WebAuthnCredentials {
+		views = append(views, webauthnCredentialView(&user.WebAuthnCredentials[i]))
+	}
+	_ = encoder.Encode(WebAuthnCredentialResponse{Code: 0, Message: "Success", Credentials: views})
+}
+
+// HandleDeleteWebAuthnCredential 删除当前用户的通行密钥，{id} 为 base64url 编码的凭据ID
+func HandleDeleteWebAuthnCredential(w http.ResponseWriter, r *http.Request) {
+	encoder := json.NewEncoder(w)
+	claims, ok := authenticate(r)
+	if !ok {
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = encoder.Encode(WebAuthnCredentialResponse{Code: 6, Message: "Unauthorized"})
+		return
+	}
+	id, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(r.PathValue("id"), "="))
+	if err != nil || len(id) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(WebAuthnCredentialResponse{Code: 1, Message: "Invalid credential id"})
+		return
+	}
+	if err := account.RemoveWebAuthnCredential(int64(claims.UserID), id); err != nil {
+		if errors.Is(err, account.ErrWebAuthnCredentialNotFound) {
+			w.WriteHeader(http.StatusNotFound)
+			_ = encoder.Encode(WebAuthnCredentialResponse{Code: 1, Message: "Passkey not found"})
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(WebAuthnCredentialResponse{Code: 2, Message: "Database error"})
+		return
+	}
+	_ = encoder.Encode(WebAuthnCredentialResponse{Code: 0, Message: "Passkey deleted"})
+}
@@ -0,0 +1,196 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"goauthx/internal/account"
+	"goauthx/internal/web/authz"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// BanView 封禁记录，status 为 active、expired 或 lifted
+type BanView struct {
+	ID          string     `json:"id,omitempty"`
+	UserID      int        `json:"user_id"`
+	Status      string     `json:"status"`
+	Reason      string     `json:"reason,omitempty"`
+	BannedBy    *int       `json:"banned_by,omitempty"`
+	Start       time.Time  `json:"start"`
+	End         *time.Time `json:"end"`
+	UnbannedBy  *int       `json:"unbanned_by,omitempty"`
+	UnbanReason string     `json:"unban_reason,omitempty"`
+	UnbannedAt  *time.Time `json:"unbanned_at,omitempty"`
+}
+
+type BanListResponse struct {
+	Code    int       `json:"code"`
+	Message string    `json:"message"`
+	Bans    []BanView `json:"bans"`
+}
+
+type BanResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Lifted  int64  `json:"lifted,omitempty"`
+}
+
+// BanRequest 封禁用户，duration 如 12h、7d、2w 或 permanent，也可以用 until 指定结束时间
+type BanRequest struct {
+	Duration string     `json:"duration"`
+	Until    *time.Time `json:"until"`
+	Reason   string     `json:"reason"`
+}
+
+// UnbanRequest 解封用户，reason 记录在封禁日志中
+type UnbanRequest struct {
+	Reason string `json:"reason"`
+}
+
+func banView(b *account.UserBan, now time.Time) BanView {
+	view := BanView{
+		UserID:      b.UserID,
+		Status:      b.Status(now),
+		Reason:      b.BanReason,
+		BannedBy:    b.BannedBy,
+		Start:       b.BanStart,
+		End:         b.BanEnd,
+		UnbannedBy:  b.UnbannedBy,
+		UnbanReason: b.UnbanReason,
+		UnbannedAt:  b.UnbannedAt,
+	}
+	if !b.BanID.IsZero() {
+		view.ID = b.BanID.Hex()
+	}
+	return view
+}
+
+func writeBans(w http.ResponseWriter, bans []account.UserBan, err error) {
+	encoder := json.NewEncoder(w)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(BanListResponse{Code: 2, Message: "Database error"})
+		return
+	}
+	now := time.Now()
+	views := make([]BanView, len(bans))
+	for i := range bans {
+		views[i] = banView(&bans[i], now)
+	}
+	w.WriteHeader(http.StatusOK)
+	_ = encoder.Encode(BanListResponse{Code: 0, Message: "OK", Bans: views})
+}
+
+// HandleListActiveBans 列出当前生效的所有封禁
+func HandleListActiveBans(w http.ResponseWriter, r *http.Request) {
+	bans, err := account.ListActiveBans()
+	writeBans(w, bans, err)
+}
+
+// HandleListUserBans 用户的完整封禁记录，包括已过期与已解除的
+func HandleListUserBans(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	if _, err := account.FindUserByID(userID); err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	bans, err := account.ListUserBans(int(userID))
+	writeBans(w, bans, err)
+}
+
+// HandleBanUser 封禁用户并注销其所有会话，操作者记录为 banned_by
+func HandleBanUser(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	var req BanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(BanResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(BanResponse{Code: 1, Message: "Missing ban reason"})
+		return
+	}
+	now := time.Now()
+	var end time.Time
+	switch {
+	case req.Until != nil && req.Duration != "":
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(BanResponse{Code: 1, Message: "Specify either duration or until"})
+		return
+	case req.Until != nil:
+		if !req.Until.After(now) {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = encoder.Encode(BanResponse{Code: 1, Message: "until must be in the future"})
+			return
+		}
+		end = *req.Until
+	default:
+		var err error
+		if end, err = account.ParseBanEnd(req.Duration, now); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = encoder.Encode(BanResponse{Code: 1, Message: "Invalid duration"})
+			return
+		}
+	}
+
+	if _, err := account.FindUserByID(userID); err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	if err := account.BanUser(int(userID), authz.ActorID(r), req.Reason, end); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(BanResponse{Code: 2, Message: "Database error"})
+		return
+	}
+	log.Printf("管理员 %s 封禁了用户 %d: %s", actorName(r), userID, req.Reason)
+	writeUser(w, http.StatusCreated, "User banned", userID)
+}
+
+// HandleUnbanUser 解除用户当前生效的封禁，操作者与原因记录在封禁日志中
+func HandleUnbanUser(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	var req UnbanRequest
+	// 请求体可以为空
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(BanResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	if _, err := account.FindUserByID(userID); err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	lifted, err := account.UnbanUser(int(userID), authz.ActorID(r), strings.TrimSpace(req.Reason))
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(BanResponse{Code: 2, Message: "Database error"})
+		return
+	}
+	if lifted == 0 {
+		w.WriteHeader(http.StatusConflict)
+		_ = encoder.Encode(BanResponse{Code: 1, Message: "User is not banned"})
+		return
+	}
+	log.Printf("管理员 %s 解封了用户 %d", actorName(r), userID)
+	w.WriteHeader(http.StatusOK)
+	_ = encoder.Encode(BanResponse{Code: 0, Message: "User unbanned", Lifted: lifted})
+}
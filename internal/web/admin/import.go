@@ -0,0 +1,76 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"goauthx/internal/account"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 导入请求体的大小上限
+const maxImportBodySize = 256 << 20
+
+type ImportResponse struct {
+	Code    int                   `json:"code"`
+	Message string                `json:"message"`
+	Result  *account.ImportResult `json:"result,omitempty"`
+}
+
+// HandleImportUsers 批量导入用户，请求体为 JSONL 或 CSV 文件内容
+// 查询参数：format（默认按 Content-Type 判断）、password_format、keep_ids、dry_run
+func HandleImportUsers(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	q := r.URL.Query()
+	opts := account.ImportOptions{
+		Format:         strings.ToLower(strings.TrimSpace(q.Get("format"))),
+		PasswordFormat: strings.TrimSpace(q.Get("password_format")),
+	}
+	if opts.Format == "" {
+		opts.Format = account.ImportJSONL
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/csv" {
+			opts.Format = account.ImportCSV
+		}
+	}
+	var err error
+	if v := q.Get("keep_ids"); v != "" {
+		opts.KeepIDs, err = strconv.ParseBool(v)
+	}
+	if v := q.Get("dry_run"); err == nil && v != "" {
+		opts.DryRun, err = strconv.ParseBool(v)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(ImportResponse{Code: 1, Message: "Invalid query parameters"})
+		return
+	}
+
+	result, err := account.ImportUsers(http.MaxBytesReader(w, r.Body, maxImportBodySize), opts)
+	if err != nil {
+		status, code := http.StatusBadRequest, 1
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			status = http.StatusRequestEntityTooLarge
+		case errors.Is(err, account.ErrImportDatabase):
+			status, code = http.StatusInternalServerError, 2
+		}
+		// 中止前已导入的记录不会回滚，结果中包含已处理的部分
+		w.WriteHeader(status)
+		_ = encoder.Encode(ImportResponse{Code: code, Message: err.Error(), Result: result})
+		return
+	}
+	if !opts.DryRun {
+		log.Printf("管理员 %s 导入了 %d 个用户（共 %d 条，跳过 %d 条，失败 %d 条）",
+			actorName(r), result.Imported, result.Total, result.Skipped, result.Failed)
+	}
+	message := "Users imported"
+	if opts.DryRun {
+		message = "Dry run finished"
+	}
+	_ = encoder.Encode(ImportResponse{Code: 0, Message: message, Result: result})
+}
@@ -0,0 +1,426 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"go.mongodb.org/mongo-driver/mongo"
+	"goauthx/internal/account"
+	"goauthx/internal/rbac"
+	"goauthx/internal/web/account/jwts"
+	"goauthx/internal/web/account/pat"
+	"goauthx/internal/web/authz"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	PermissionUsersRead  = "users:read"
+	PermissionUsersWrite = "users:write"
+
+	defaultPageSize = 20
+)
+
+func init() {
+	rbac.RegisterPermission(PermissionUsersRead, "查看用户")
+	rbac.RegisterPermission(PermissionUsersWrite, "创建、修改、删除、封禁用户并强制下线")
+}
+
+type UserView struct {
+	ID              int64      `json:"id"`
+	Username        string     `json:"username"`
+	Email           string     `json:"email"`
+	EmailVerified   bool       `json:"email_verified"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	TOTPEnabled     bool       `json:"totp_enabled"`
+	Roles           []string   `json:"roles,omitempty"`
+	Banned          bool       `json:"banned"`
+	Ban             *BanView   `json:"ban,omitempty"`
+}
+
+type UserResponse struct {
+	Code    int       `json:"code"`
+	Message string    `json:"message"`
+	User    *UserView `json:"user,omitempty"`
+}
+
+type UserListResponse struct {
+	Code     int        `json:"code"`
+	Message  string     `json:"message"`
+	Total    int64      `json:"total"`
+	Page     int        `json:"page"`
+	PageSize int        `json:"page_size"`
+	Users    []UserView `json:"users"`
+}
+
+// CreateUserRequest 创建用户，email_verified 为 true 时视为邮箱已验证，不发送验证邮件
+type CreateUserRequest struct {
+	account.RegisterRequest
+	EmailVerified bool `json:"email_verified"`
+}
+
+// UpdateUserRequest 修改用户资料，同时可以封禁或解封用户
+// banned 为 true 时封禁到 ban_until，ban_until 为空表示永久封禁；为 false 时 ban_reason 记录为解封原因
+type UpdateUserRequest struct {
+	account.UpdateUserRequest
+	Banned    *bool      `json:"banned"`
+	BanReason string     `json:"ban_reason"`
+	BanUntil  *time.Time `json:"ban_until"`
+}
+
+type LogoutResponse struct {
+	Code          int    `json:"code"`
+	Message       string `json:"message"`
+	RevokedTokens int64  `json:"revoked_tokens,omitempty"`
+}
+
+func userView(user *account.UserDoc, ban *account.UserBan) UserView {
+	view := UserView{
+		ID:              user.UserId,
+		Username:        user.Username,
+		Email:           user.Email,
+		EmailVerified:   user.IsEmailVerified(),
+		EmailVerifiedAt: user.EmailVerifiedAt,
+		CreatedAt:       user.CreatedAt,
+		TOTPEnabled:     user.TOTPEnabled,
+	}
+	if ban != nil {
+		view.Banned = true
+		bv := banView(ban, time.Now())
+		view.Ban = &bv
+	}
+	return view
+}
+
+// loadUserView 查询用户详情，包括角色与封禁状态
+func loadUserView(userID int64) (*UserView, error) {
+	user, err := account.FindUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	_, ban, err := account.IsUserBanned(int(userID))
+	if err != nil {
+		return nil, err
+	}
+	view := userView(user, ban)
+	if view.Roles, err = rbac.UserRoles(int(userID)); err != nil {
+		return nil, err
+	}
+	return &view, nil
+}
+
+// pathUserID 解析路径中的用户ID，失败时已写入错误响应
+func pathUserID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(UserResponse{Code: 1, Message: "Invalid user id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// writeLookupError 查询用户失败时的响应
+func writeLookupError(w http.ResponseWriter, err error) {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		w.WriteHeader(http.StatusNotFound)
+		_ = json.NewEncoder(w).Encode(UserResponse{Code: 1, Message: "User not found"})
+		return
+	}
+	w.WriteHeader(http.StatusInternalServerError)
+	_ = json.NewEncoder(w).Encode(UserResponse{Code: 2, Message: "Database error"})
+}
+
+// writeUser 查询并返回用户详情
+func writeUser(w http.ResponseWriter, status int, message string, userID int64) {
+	view, err := loadUserView(userID)
+	if err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(UserResponse{Code: 0, Message: message, User: view})
+}
+
+// parseTime 解析 RFC 3339 时间或 YYYY-MM-DD 日期
+func parseTime(s string) (*time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, s, time.Local)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// HandleListUsers 分页查询用户
+// 查询参数：page、page_size、username、email、created_after、created_before
+func HandleListUsers(w http.ResponseWriter, r *http.Request) {
+	encoder := json.NewEncoder(w)
+	q := r.URL.Query()
+	filter := account.UserFilter{
+		Username: strings.TrimSpace(q.Get("username")),
+		Email:    strings.TrimSpace(q.Get("email")),
+		Page:     1,
+		PageSize: defaultPageSize,
+	}
+	var err error
+	if v := q.Get("page"); v != "" {
+		if filter.Page, err = strconv.Atoi(v); err != nil || filter.Page < 1 {
+			err = errors.New("invalid page")
+		}
+	}
+	if v := q.Get("page_size"); err == nil && v != "" {
+		if filter.PageSize, err = strconv.Atoi(v); err != nil || filter.PageSize < 1 || filter.PageSize > account.MaxPageSize {
+			err = errors.New("invalid page_size")
+		}
+	}
+	if v := q.Get("created_after"); err == nil && v != "" {
+		filter.CreatedAfter, err = parseTime(v)
+	}
+	if v := q.Get("created_before"); err == nil && v != "" {
+		filter.CreatedBefore, err = parseTime(v)
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(UserListResponse{Code: 1, Message: "Invalid query parameters"})
+		return
+	}
+
+	users, total, err := account.ListUsers(filter)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(UserListResponse{Code: 2, Message: "Database error"})
+		return
+	}
+	ids := make([]int, len(users))
+	for i := range users {
+		ids[i] = int(users[i].UserId)
+	}
+	bans, err := account.ActiveBans(ids)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(UserListResponse{Code: 2, Message: "Database error"})
+		return
+	}
+	views := make([]UserView, len(users))
+	for i := range users {
+		views[i] = userView(&users[i], bans[ids[i]])
+	}
+	w.WriteHeader(http.StatusOK)
+	_ = encoder.Encode(UserListResponse{
+		Code:     0,
+		Message:  "OK",
+		Total:    total,
+		Page:     filter.Page,
+		PageSize: filter.PageSize,
+		Users:    views,
+	})
+}
+
+// HandleGetUser 查询单个用户
+func HandleGetUser(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	writeUser(w, http.StatusOK, "OK", userID)
+}
+
+// sendVerification 向未验证邮箱的用户发送验证邮件，返回附加在响应消息中的发送结果
+func sendVerification(userID int64) string {
+	user, err := account.FindUserByID(userID)
+	if err == nil {
+		err = account.SendVerificationEmail(user)
+	}
+	if err != nil {
+		log.Printf("发送用户 %d 的验证邮件失败: %v", userID, err)
+		return ", failed to send verification email"
+	}
+	return ", verification email sent"
+}
+
+// HandleCreateUser 创建用户，不需要邮箱验证码
+// email_verified 为 false 时向用户邮箱发送验证链接
+func HandleCreateUser(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	var req CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(UserResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	if !account.IsEmail(strings.TrimSpace(req.Email)) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(UserResponse{Code: 1, Message: "Invalid email"})
+		return
+	}
+	req.RegisterRequest.EmailVerified = req.EmailVerified
+	resp, status := account.RegisterUser(&req.RegisterRequest)
+	if resp.Code != 0 {
+		w.WriteHeader(status)
+		_ = encoder.Encode(UserResponse{Code: resp.Code, Message: resp.Message})
+		return
+	}
+	log.Printf("管理员 %s 创建了用户 %d (%s)", actorName(r), resp.UserID, req.Username)
+	message := "User created"
+	if !req.EmailVerified {
+		message += sendVerification(resp.UserID)
+	}
+	writeUser(w, http.StatusCreated, message, resp.UserID)
+}
+
+// HandleUpdateUser 修改用户资料或封禁状态，只修改请求中出现的字段
+func HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	encoder := json.NewEncoder(w)
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	var req UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(UserResponse{Code: 1, Message: "Invalid request"})
+		return
+	}
+	profile := req.Username != nil || req.Email != nil || req.Password != nil || req.EmailVerified != nil
+	if !profile && req.Banned == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(UserResponse{Code: 1, Message: "Nothing to update"})
+		return
+	}
+	if req.Banned != nil && *req.Banned && req.BanUntil != nil && !req.BanUntil.After(time.Now()) {
+		w.WriteHeader(http.StatusBadRequest)
+		_ = encoder.Encode(UserResponse{Code: 1, Message: "ban_until must be in the future"})
+		return
+	}
+
+	message := "User updated"
+	if profile {
+		resp, status := account.UpdateUser(userID, &req.UpdateUserRequest)
+		if resp.Code != 0 {
+			w.WriteHeader(status)
+			_ = encoder.Encode(UserResponse{Code: resp.Code, Message: resp.Message})
+			return
+		}
+		if resp.EmailChanged {
+			message += sendVerification(userID)
+		}
+		if req.Password != nil {
+			if _, err := pat.RevokeUserTokens(int(userID)); err != nil {
+				log.Printf("删除用户 %d 的个人访问令牌失败: %v", userID, err)
+			}
+		}
+	} else if _, err := account.FindUserByID(userID); err != nil {
+		writeLookupError(w, err)
+		return
+	}
+
+	if req.Banned != nil {
+		var err error
+		if *req.Banned {
+			var until time.Time
+			if req.BanUntil != nil {
+				until = *req.BanUntil
+			}
+			err = account.BanUser(int(userID), authz.ActorID(r), strings.TrimSpace(req.BanReason), until)
+		} else {
+			_, err = account.UnbanUser(int(userID), authz.ActorID(r), strings.TrimSpace(req.BanReason))
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = encoder.Encode(UserResponse{Code: 2, Message: "Database error"})
+			return
+		}
+	}
+	log.Printf("管理员 %s 修改了用户 %d", actorName(r), userID)
+	writeUser(w, http.StatusOK, message, userID)
+}
+
+// HandleSendVerification 向用户当前邮箱重新发送验证邮件
+func HandleSendVerification(w http.ResponseWriter, r *http.Request) {
+	encoder := json.NewEncoder(w)
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	user, err := account.FindUserByID(userID)
+	if err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	if user.IsEmailVerified() {
+		w.WriteHeader(http.StatusConflict)
+		_ = encoder.Encode(UserResponse{Code: 1, Message: "Email already verified"})
+		return
+	}
+	if err := account.SendVerificationEmail(user); err != nil {
+		log.Printf("发送用户 %d 的验证邮件失败: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		_ = encoder.Encode(UserResponse{Code: 2, Message: "Failed to send verification email"})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	_ = encoder.Encode(UserResponse{Code: 0, Message: "Verification email sent"})
+}
+
+// HandleDeleteUser 删除用户，同时注销其所有会话并删除个人访问令牌与角色
+func HandleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	encoder := json.NewEncoder(w)
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	if err := account.DeleteUser(userID); err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	if _, err := pat.RevokeUserTokens(int(userID)); err != nil {
+		log.Printf("删除用户 %d 的个人访问令牌失败: %v", userID, err)
+	}
+	log.Printf("管理员 %s 删除了用户 %d", actorName(r), userID)
+	w.WriteHeader(http.StatusOK)
+	_ = encoder.Encode(UserResponse{Code: 0, Message: "User deleted"})
+}
+
+// HandleLogoutUser 强制用户下线，注销其所有会话
+// 查询参数 revoke_tokens=true 时同时删除其个人访问令牌
+func HandleLogoutUser(w http.ResponseWriter, r *http.Request) {
+	encoder := json.NewEncoder(w)
+	userID, ok := pathUserID(w, r)
+	if !ok {
+		return
+	}
+	if _, err := account.FindUserByID(userID); err != nil {
+		writeLookupError(w, err)
+		return
+	}
+	jwts.RemoveUserJWTsFromWhitelist(int(userID))
+	resp := LogoutResponse{Code: 0, Message: "User logged out"}
+	if revoke, _ := strconv.ParseBool(r.URL.Query().Get("revoke_tokens")); revoke {
+		n, err := pat.RevokeUserTokens(int(userID))
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = encoder.Encode(LogoutResponse{Code: 2, Message: "Database error"})
+			return
+		}
+		resp.RevokedTokens = n
+	}
+	log.Printf("管理员 %s 强制用户 %d 下线", actorName(r), userID)
+	w.WriteHeader(http.StatusOK)
+	_ = encoder.Encode(resp)
+}
+
+// actorName 日志中展示的操作者
+func actorName(r *http.Request) string {
+	if id := authz.ActorID(r); id != nil {
+		return "user:" + strconv.Itoa(*id)
+	}
+	return authz.SubjectTypeAdminSecret
+}
@@ -0,0 +1,122 @@
+package authz
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"goauthx/internal/config"
+	"goauthx/internal/rbac"
+	"goauthx/internal/web/account/jwts"
+	"goauthx/internal/web/account/pat"
+	"net/http"
+)
+
+const (
+	// AdminSecretHeader 使用配置中的 admin_secret 调用管理接口时携带的请求头
+	AdminSecretHeader = "X-Admin-Secret"
+	// SubjectTypeAdminSecret 通过 admin_secret 认证的调用方，拥有全部管理权限
+	SubjectTypeAdminSecret = "admin_secret"
+)
+
+type Response struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type principalKey struct{}
+
+// rolesOf 返回调用方在 GoAuthX 中生效的角色
+// 第一方登录的 JWT 与个人访问令牌都实时查询用户角色，JWT 中的 roles 声明仅供展示；
+// OAuth 客户端与服务账号的 Token 不具备管理权限
+func rolesOf(p *pat.Principal) ([]string, error) {
+	switch {
+	case p.IsPersonalAccessToken():
+		return rbac.UserRoles(p.UserID)
+	case p.Claims != nil && p.Claims.ClientID == "" && !p.Claims.IsService():
+		return rbac.UserRoles(p.Claims.UserID)
+	}
+	return nil, nil
+}
+
+// Allowed 判断调用方是否拥有指定权限，个人访问令牌还需要在 scope 中包含该权限
+func Allowed(p *pat.Principal, permission string) (bool, error) {
+	if p.IsPersonalAccessToken() && !p.HasScope(permission) {
+		return false, nil
+	}
+	roles, err := rolesOf(p)
+	if err != nil {
+		return false, err
+	}
+	return rbac.HasPermission(roles, permission)
+}
+
+// RequirePermission 包装需要指定权限的处理函数，凭据可以是 JWT 或个人访问令牌
+// 认证失败返回 401，权限不足返回 403
+func RequirePermission(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		encoder := json.NewEncoder(w)
+		p, ok := pat.Authenticate(r)
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = encoder.Encode(Response{Code: 6, Message: "Unauthorized"})
+			return
+		}
+		allowed, err := Allowed(p, permission)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			_ = encoder.Encode(Response{Code: 2, Message: "Database error"})
+			return
+		}
+		if !allowed {
+			w.WriteHeader(http.StatusForbidden)
+			_ = encoder.Encode(Response{Code: 8, Message: "Permission denied"})
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	}
+}
+
+// PrincipalFromRequest 取出 RequirePermission 认证通过的调用方
+func PrincipalFromRequest(r *http.Request) (*pat.Principal, bool) {
+	p, ok := r.Context().Value(principalKey{}).(*pat.Principal)
+	return p, ok
+}
+
+// checkAdminSecret 校验 admin_secret，未配置或仍为默认值时一律拒绝
+func checkAdminSecret(secret string) bool {
+	expected := config.GetConfig().AdminSecret
+	if expected == "" || expected == config.DefaultConfig().AdminSecret {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(secret), []byte(expected)) == 1
+}
+
+// RequireAdmin 包装管理接口，在 RequirePermission 的基础上还接受 X-Admin-Secret 请求头
+// 请求头存在时只校验 admin_secret，不再检查 Bearer 凭据
+func RequireAdmin(permission string, next http.HandlerFunc) http.HandlerFunc {
+	withPermission := RequirePermission(permission, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret := r.Header.Get(AdminSecretHeader)
+		if secret == "" {
+			withPermission(w, r)
+			return
+		}
+		if !checkAdminSecret(secret) {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(Response{Code: 6, Message: "Unauthorized"})
+			return
+		}
+		p := &pat.Principal{SubjectType: SubjectTypeAdminSecret, Subject: SubjectTypeAdminSecret}
+		next(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, p)))
+	}
+}
+
+// ActorID 返回执行管理操作的用户ID，用于审计记录；通过 admin_secret 认证时返回 nil
+func ActorID(r *http.Request) *int {
+	p, ok := PrincipalFromRequest(r)
+	if !ok || p.SubjectType != jwts.SubjectTypeUser {
+		return nil
+	}
+	id := p.UserID
+	return &id
+}
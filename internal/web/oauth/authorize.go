@@ -0,0 +1,266 @@
+package oauth
+
+import (
+	"errors"
+	"goauthx/internal/account"
+	"goauthx/internal/oauth"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// authorizeParams 授权请求中需要在登录、授权页面之间透传的参数
+var authorizeParams = []string{
+	"response_type", "client_id", "redirect_uri", "scope", "state",
+	"code_challenge", "code_challenge_method", "nonce",
+}
+
+// authorizeRequest 已校验的授权请求
+type authorizeRequest struct {
+	values      url.Values
+	client      *oauth.Client
+	redirectURI string
+	scopes      []string
+}
+
+// authorizeError 授权请求错误，redirect 为 false 时不能回调客户端，只能展示错误页面
+type authorizeError struct {
+	code        string
+	description string
+	redirect    bool
+}
+
+func (e *authorizeError) Error() string {
+	return e.code + ": " + e.description
+}
+
+// parseAuthorizeRequest 按 RFC 6749 4.1.1 与 RFC 7636 校验授权请求
+func parseAuthorizeRequest(values url.Values) (*authorizeRequest, *authorizeError) {
+	clientID := values.Get("client_id")
+	if clientID == "" {
+		return nil, &authorizeError{code: "invalid_request", description: "缺少 client_id"}
+	}
+	client, err := oauth.GetClient(clientID)
+	if err != nil {
+		if errors.Is(err, oauth.ErrClientNotFound) {
+			return nil, &authorizeError{code: "invalid_client", description: "未知的客户端"}
+		}
+		return nil, &authorizeError{code: "server_error", description: "服务器内部错误，请稍后重试"}
+	}
+
+	redirectURI := values.Get("redirect_uri")
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+	}
+	if redirectURI == "" || !client.HasRedirectURI(redirectURI) {
+		return nil, &authorizeError{code: "invalid_request", description: "回调地址与注册的不一致"}
+	}
+
+	req := &authorizeRequest{
+		values:      values,
+		client:      client,
+		redirectURI: redirectURI,
+		scopes:      oauth.ParseScope(values.Get("scope")),
+	}
+	if values.Get("response_type") != "code" {
+		return req, &authorizeError{code: "unsupported_response_type", description: "only response_type=code is supported", redirect: true}
+	}
+	if !client.AllowsScopes(req.scopes) {
+		return req, &authorizeError{code: "invalid_scope", description: "requested scope is not allowed for this client", redirect: true}
+	}
+	challenge := values.Get("code_challenge")
+	method := values.Get("code_challenge_method")
+	if challenge == "" && client.IsPublic() {
+		return req, &authorizeError{code: "invalid_request", description: "PKCE code_challenge is required for public clients", redirect: true}
+	}
+	if challenge != "" && method != "" && method != "S256" && method != "plain" {
+		return req, &authorizeError{code: "invalid_request", description: "unsupported code_challenge_method", redirect: true}
+	}
+	return req, nil
+}
+
+// hidden 返回需要在页面表单中透传的授权参数
+func (req *authorizeRequest) hidden() map[string]string {
+	hidden := make(map[string]string)
+	for _, k := range authorizeParams {
+		if v := req.values.Get(k); v != "" {
+			hidden[k] = v
+		}
+	}
+	return hidden
+}
+
+// redirect 携带参数回调客户端
+func (req *authorizeRequest) redirect(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	u, err := url.Parse(req.redirectURI)
+	if err != nil {
+		renderError(w, r, http.StatusBadRequest, "回调地址无效")
+		return
+	}
+	q := u.Query()
+	for k, v := range params {
+		q.Set(k, v)
+	}
+	if state := req.values.Get("state"); state != "" {
+		q.Set("state", state)
+	}
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+func (req *authorizeRequest) redirectError(w http.ResponseWriter, r *http.Request, code, description string) {
+	req.redirect(w, r, map[string]string{"error": code, "error_description": description})
+}
+
+// HandleAuthorize 授权端点：GET 展示登录或授权页面，POST 处理页面表单
+func HandleAuthorize(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		handleAuthorizeGet(w, r)
+	case http.MethodPost:
+		handleAuthorizePost(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleAuthorizeGet(w http.ResponseWriter, r *http.Request) {
+	req, aerr := parseAuthorizeRequest(r.URL.Query())
+	if aerr != nil {
+		if aerr.redirect {
+			req.redirectError(w, r, aerr.code, aerr.description)
+		} else {
+			renderError(w, r, http.StatusBadRequest, aerr.description)
+		}
+		return
+	}
+	user, claims := currentUser(r)
+	if user == nil {
+		renderLogin(w, r, req, http.StatusOK, "", false)
+		return
+	}
+	proceed(w, r, req, user, claims.IssuedAt.Time)
+}
+
+func handleAuthorizePost(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderError(w, r, http.StatusBadRequest, "请求格式错误")
+		return
+	}
+	req, aerr := parseAuthorizeRequest(r.PostForm)
+	if aerr != nil {
+		if aerr.redirect {
+			req.redirectError(w, r, aerr.code, aerr.description)
+		} else {
+			renderError(w, r, http.StatusBadRequest, aerr.description)
+		}
+		return
+	}
+	if !checkCSRF(r) {
+		renderLogin(w, r, req, http.StatusForbidden, "页面已过期，请重新提交", false)
+		return
+	}
+
+	switch r.PostFormValue("action") {
+	case "login":
+		user, errMsg, needMFA := loginForm(r)
+		if user == nil {
+			renderLogin(w, r, req, http.StatusUnauthorized, errMsg, needMFA)
+			return
+		}
+		if err := startBrowserSession(w, r, int(user.UserId)); err != nil {
+			log.Printf("签发浏览器会话失败: %v", err)
+			renderLogin(w, r, req, http.StatusInternalServerError, "服务器内部错误，请稍后重试", false)
+			return
+		}
+		proceed(w, r, req, user, time.Now())
+	case "approve":
+		user, claims := currentUser(r)
+		if user == nil {
+			renderLogin(w, r, req, http.StatusUnauthorized, "登录已过期，请重新登录", false)
+			return
+		}
+		if err := oauth.SaveConsent(int(user.UserId), req.client.ClientID, req.scopes); err != nil {
+			renderError(w, r, http.StatusInternalServerError, "服务器内部错误，请稍后重试")
+			return
+		}
+		issueCode(w, r, req, user, claims.IssuedAt.Time)
+	case "deny":
+		req.redirectError(w, r, "access_denied", "the user denied the request")
+	case "switch":
+		_, claims := currentUser(r)
+		endBrowserSession(w, claims)
+		renderLogin(w, r, req, http.StatusOK, "", false)
+	default:
+		renderError(w, r, http.StatusBadRequest, "未知操作")
+	}
+}
+
+// proceed 已登录用户：受信任客户端或已授权过的 scope 直接回调，否则展示授权页面
+// authTime 为用户实际完成登录的时间
+func proceed(w http.ResponseWriter, r *http.Request, req *authorizeRequest, user *account.UserDoc, authTime time.Time) {
+	if !req.client.Trusted {
+		granted, err := oauth.HasConsent(int(user.UserId), req.client.ClientID, req.scopes)
+		if err != nil {
+			renderError(w, r, http.StatusInternalServerError, "服务器内部错误，请稍后重试")
+			return
+		}
+		if !granted {
+			renderPage(w, r, http.StatusOK, pageData{
+				Title:      "授权确认",
+				Step:       "consent",
+				Action:     "/oauth/authorize",
+				Hidden:     req.hidden(),
+				ClientName: req.client.Name,
+				Scopes:     req.scopes,
+				Username:   user.Username,
+			})
+			return
+		}
+	}
+	issueCode(w, r, req, user, authTime)
+}
+
+// issueCode 生成授权码并回调客户端
+func issueCode(w http.ResponseWriter, r *http.Request, req *authorizeRequest, user *account.UserDoc, authTime time.Time) {
+	// 未指定 code_challenge_method 时按 S256 处理，plain 只在客户端明确要求时使用
+	method := req.values.Get("code_challenge_method")
+	if req.values.Get("code_challenge") != "" && method == "" {
+		method = "S256"
+	}
+	info := sessionInfo(r)
+	code, err := oauth.NewAuthorizationCode(&oauth.AuthorizationCode{
+		ClientID:            req.client.ClientID,
+		UserID:              int(user.UserId),
+		RedirectURI:         req.redirectURI,
+		RedirectURIProvided: req.values.Get("redirect_uri") != "",
+		Scope:               strings.Join(req.scopes, " "),
+		CodeChallenge:       req.values.Get("code_challenge"),
+		CodeChallengeMethod: method,
+		Nonce:               req.values.Get("nonce"),
+		AuthTime:            authTime,
+		UserAgent:           info.UserAgent,
+		IP:                  info.IP,
+	})
+	if err != nil {
+		req.redirectError(w, r, "server_error", "failed to issue authorization code")
+		return
+	}
+	req.redirect(w, r, map[string]string{"code": code})
+}
+
+func renderLogin(w http.ResponseWriter, r *http.Request, req *authorizeRequest, status int, errMsg string, needMFA bool) {
+	renderPage(w, r, status, pageData{
+		Title:      "登录",
+		Step:       "login",
+		Error:      errMsg,
+		Action:     "/oauth/authorize",
+		Hidden:     req.hidden(),
+		ClientName: req.client.Name,
+		Login:      strings.TrimSpace(r.PostFormValue("username")),
+		RequireMFA: needMFA,
+	})
+}
@@ -0,0 +1,241 @@
+package oauth
+
+import (
+	"errors"
+	"goauthx/internal/account"
+	"goauthx/internal/oauth"
+	"goauthx/internal/web/account/jwts"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// DeviceAuthorizationResponse RFC 8628 3.2 设备授权响应
+type DeviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// HandleDeviceAuthorization 设备授权端点，CLI、电视等无法接收回调的设备由此获取设备码与用户码
+func HandleDeviceAuthorization(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request", "device authorization endpoint only accepts POST")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "malformed request body")
+		return
+	}
+	client, ok := authenticateClient(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+	scopes := oauth.ParseScope(r.PostFormValue("scope"))
+	if !client.AllowsScopes(scopes) {
+		writeError(w, http.StatusBadRequest, "invalid_scope", "requested scope is not allowed for this client")
+		return
+	}
+	da, err := oauth.NewDeviceAuthorization(client.ClientID, strings.Join(scopes, " "))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	verificationURI := issuerURL(r) + "/oauth/device"
+	writeJSON(w, http.StatusOK, DeviceAuthorizationResponse{
+		DeviceCode:              da.DeviceCode,
+		UserCode:                da.UserCode,
+		VerificationURI:         verificationURI,
+		VerificationURIComplete: verificationURI + "?user_code=" + url.QueryEscape(da.UserCode),
+		ExpiresIn:               int64(oauth.DeviceCodeTTL.Seconds()),
+		Interval:                int64(oauth.DevicePollInterval.Seconds()),
+	})
+}
+
+// HandleDevice 设备验证页面：已登录用户输入用户码并批准设备授权
+func HandleDevice(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		userCode := oauth.NormalizeUserCode(r.URL.Query().Get("user_code"))
+		user, _ := currentUser(r)
+		if user == nil {
+			renderDeviceLogin(w, r, userCode, http.StatusOK, "", false)
+			return
+		}
+		renderDeviceCode(w, r, user, userCode)
+	case http.MethodPost:
+		handleDevicePost(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleDevicePost(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderError(w, r, http.StatusBadRequest, "请求格式错误")
+		return
+	}
+	userCode := oauth.NormalizeUserCode(r.PostFormValue("user_code"))
+	if !checkCSRF(r) {
+		renderDeviceLogin(w, r, userCode, http.StatusForbidden, "页面已过期，请重新提交", false)
+		return
+	}
+
+	action := r.PostFormValue("action")
+	if action == "login" {
+		user, errMsg, needMFA := loginForm(r)
+		if user == nil {
+			renderDeviceLogin(w, r, userCode, http.StatusUnauthorized, errMsg, needMFA)
+			return
+		}
+		if err := startBrowserSession(w, r, int(user.UserId)); err != nil {
+			log.Printf("签发浏览器会话失败: %v", err)
+			renderDeviceLogin(w, r, userCode, http.StatusInternalServerError, "服务器内部错误，请稍后重试", false)
+			return
+		}
+		renderDeviceCode(w, r, user, userCode)
+		return
+	}
+
+	user, claims := currentUser(r)
+	if user == nil {
+		renderDeviceLogin(w, r, userCode, http.StatusUnauthorized, "登录已过期，请重新登录", false)
+		return
+	}
+	switch action {
+	case "continue":
+		if userCode == "" {
+			renderDevicePage(w, r, http.StatusBadRequest, user, "", "用户码格式错误")
+			return
+		}
+		renderDeviceCode(w, r, user, userCode)
+	case "approve", "deny":
+		err := oauth.CompleteDeviceAuthorization(userCode, int(user.UserId), claims.IssuedAt.Time, action == "approve")
+		if err != nil {
+			renderDevicePage(w, r, http.StatusBadRequest, user, "", "用户码无效或已过期")
+			return
+		}
+		msg := "已拒绝该设备的授权请求"
+		if action == "approve" {
+			msg = "授权成功，请返回设备继续操作"
+		}
+		renderPage(w, r, http.StatusOK, pageData{Title: "设备授权", Step: "done", Message: msg})
+	case "switch":
+		endBrowserSession(w, claims)
+		renderDeviceLogin(w, r, userCode, http.StatusOK, "", false)
+	default:
+		renderError(w, r, http.StatusBadRequest, "未知操作")
+	}
+}
+
+// renderDeviceCode 用户码有效时展示授权确认，否则展示用户码输入框
+func renderDeviceCode(w http.ResponseWriter, r *http.Request, user *account.UserDoc, userCode string) {
+	if userCode == "" {
+		renderDevicePage(w, r, http.StatusOK, user, "", "")
+		return
+	}
+	da, found := oauth.LookupUserCode(userCode)
+	if !found {
+		renderDevicePage(w, r, http.StatusBadRequest, user, userCode, "用户码无效或已过期")
+		return
+	}
+	client, err := oauth.GetClient(da.ClientID)
+	if err != nil {
+		renderDevicePage(w, r, http.StatusBadRequest, user, userCode, "请求授权的客户端不存在")
+		return
+	}
+	renderPage(w, r, http.StatusOK, pageData{
+		Title:      "设备授权",
+		Step:       "device_confirm",
+		Action:     "/oauth/device",
+		Hidden:     map[string]string{"user_code": userCode},
+		ClientName: client.Name,
+		Scopes:     oauth.ParseScope(da.Scope),
+		Username:   user.Username,
+		UserCode:   userCode,
+	})
+}
+
+func renderDevicePage(w http.ResponseWriter, r *http.Request, status int, user *account.UserDoc, userCode, errMsg string) {
+	renderPage(w, r, status, pageData{
+		Title:    "设备授权",
+		Step:     "device",
+		Error:    errMsg,
+		Action:   "/oauth/device",
+		Username: user.Username,
+		UserCode: userCode,
+	})
+}
+
+func renderDeviceLogin(w http.ResponseWriter, r *http.Request, userCode string, status int, errMsg string, needMFA bool) {
+	hidden := map[string]string{}
+	if userCode != "" {
+		hidden["user_code"] = userCode
+	}
+	renderPage(w, r, status, pageData{
+		Title:      "登录以授权设备",
+		Step:       "login",
+		Error:      errMsg,
+		Action:     "/oauth/device",
+		Hidden:     hidden,
+		Login:      strings.TrimSpace(r.PostFormValue("username")),
+		RequireMFA: needMFA,
+	})
+}
+
+func handleDeviceCodeGrant(w http.ResponseWriter, r *http.Request, client *oauth.Client) {
+	deviceCode := r.PostFormValue("device_code")
+	if deviceCode == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "missing device_code")
+		return
+	}
+	da, err := oauth.PollDeviceAuthorization(deviceCode, client.ClientID)
+	if err != nil {
+		switch {
+		case errors.Is(err, oauth.ErrAuthorizationPending):
+			writeError(w, http.StatusBadRequest, "authorization_pending", "")
+		case errors.Is(err, oauth.ErrSlowDown):
+			writeError(w, http.StatusBadRequest, "slow_down", "")
+		case errors.Is(err, oauth.ErrAccessDenied):
+			writeError(w, http.StatusBadRequest, "access_denied", "the user denied the request")
+		case errors.Is(err, oauth.ErrExpiredToken):
+			writeError(w, http.StatusBadRequest, "expired_token", "device code expired")
+		default:
+			writeError(w, http.StatusBadRequest, "invalid_grant", "invalid device_code")
+		}
+		return
+	}
+
+	banned, _, err := account.IsUserBanned(da.UserID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if banned {
+		writeError(w, http.StatusBadRequest, "invalid_grant", "user is banned")
+		return
+	}
+	pair, err := jwts.IssueTokenPair(da.UserID, sessionInfo(r), jwts.Grant{ClientID: client.ClientID, Scope: da.Scope})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", "failed to issue token")
+		return
+	}
+	resp := tokenResponse(pair)
+	if hasOpenIDScope(da.Scope) {
+		resp.IDToken, err = newIDToken(r, client.ClientID, da.UserID, da.Scope, "", da.AuthTime)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "server_error", "failed to issue id_token")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
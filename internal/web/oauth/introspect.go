@@ -0,0 +1,238 @@
+package oauth
+
+import (
+	"errors"
+	"goauthx/internal/oauth"
+	"goauthx/internal/web/account/jwts"
+	"goauthx/internal/web/account/pat"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// IntrospectionResponse RFC 7662 2.2 内省响应，Token 无效时只返回 active=false
+type IntrospectionResponse struct {
+	Active      bool   `json:"active"`
+	Scope       string `json:"scope,omitempty"`
+	ClientID    string `json:"client_id,omitempty"`
+	TokenType   string `json:"token_type,omitempty"`
+	Exp         int64  `json:"exp,omitempty"`
+	Iat         int64  `json:"iat,omitempty"`
+	Sub         string `json:"sub,omitempty"`
+	SubjectType string `json:"sub_type,omitempty"`
+	Iss         string `json:"iss,omitempty"`
+	JTI         string `json:"jti,omitempty"`
+	SessionID   string `json:"sid,omitempty"`
+}
+
+// caller 调用内省、吊销端点的客户端：OAuth 客户端或服务账号
+type caller struct {
+	ID     string
+	Public bool
+}
+
+// authenticateCaller 认证 OAuth 客户端或服务账号
+func authenticateCaller(r *http.Request) (*caller, bool) {
+	id, secret := clientCredentials(r)
+	if strings.HasPrefix(id, oauth.ServiceAccountIDPrefix) {
+		sa, err := oauth.GetServiceAccount(id)
+		if err != nil || sa.Disabled || !sa.VerifySecret(secret) {
+			return nil, false
+		}
+		return &caller{ID: sa.ID}, true
+	}
+	client, ok := authenticateClient(r)
+	if !ok {
+		return nil, false
+	}
+	return &caller{ID: client.ClientID, Public: client.IsPublic()}, true
+}
+
+// parseTokenRequest 校验内省、吊销请求的公共部分，失败时已写入错误响应
+func parseTokenRequest(w http.ResponseWriter, r *http.Request) (*caller, string, bool) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request", "endpoint only accepts POST")
+		return nil, "", false
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "malformed request body")
+		return nil, "", false
+	}
+	c, ok := authenticateCaller(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return nil, "", false
+	}
+	token := strings.TrimSpace(r.PostFormValue("token"))
+	if token == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "missing token")
+		return nil, "", false
+	}
+	return c, token, true
+}
+
+// HandleIntrospect 令牌内省端点（RFC 7662），仅机密客户端与服务账号可调用
+// 同时支持内省个人访问令牌
+// Access Token 可被任意资源服务内省，Refresh Token 只对签发给调用方的生效
+func HandleIntrospect(w http.ResponseWriter, r *http.Request) {
+	c, token, ok := parseTokenRequest(w, r)
+	if !ok {
+		return
+	}
+	if c.Public {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "public clients cannot introspect tokens")
+		return
+	}
+
+	inactive := IntrospectionResponse{Active: false}
+	if pat.IsPersonalAccessToken(token) {
+		p, ok := pat.PeekPrincipal(token)
+		if !ok {
+			writeJSON(w, http.StatusOK, inactive)
+			return
+		}
+		resp := IntrospectionResponse{
+			Active:      true,
+			Scope:       strings.Join(p.Scopes, " "),
+			TokenType:   "personal_access_token",
+			Iat:         p.Token.CreatedAt.Unix(),
+			Sub:         p.Subject,
+			SubjectType: p.SubjectType,
+			Iss:         issuerURL(r),
+			JTI:         p.Token.ID,
+		}
+		if p.Token.ExpiresAt != nil {
+			resp.Exp = p.Token.ExpiresAt.Unix()
+		}
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+	hintRefresh := r.PostFormValue("token_type_hint") == "refresh_token"
+	if !hintRefresh {
+		if resp, ok := introspectAccessToken(r, token); ok {
+			writeJSON(w, http.StatusOK, resp)
+			return
+		}
+	}
+	record, err := jwts.LookupRefreshToken(token)
+	if err != nil {
+		if !errors.Is(err, jwts.ErrInvalidRefreshToken) {
+			writeError(w, http.StatusInternalServerError, "server_error", "")
+			return
+		}
+		// 提示为 refresh_token 但实际是 Access Token 时仍然按 Access Token 处理
+		if hintRefresh {
+			if resp, ok := introspectAccessToken(r, token); ok {
+				writeJSON(w, http.StatusOK, resp)
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, inactive)
+		return
+	}
+	if record.ClientID == "" || record.ClientID != c.ID {
+		writeJSON(w, http.StatusOK, inactive)
+		return
+	}
+	writeJSON(w, http.StatusOK, IntrospectionResponse{
+		Active:      true,
+		Scope:       record.Scope,
+		ClientID:    record.ClientID,
+		TokenType:   "refresh_token",
+		Exp:         record.ExpiresAt.Unix(),
+		Iat:         record.CreatedAt.Unix(),
+		Sub:         strconv.Itoa(record.UserID),
+		SubjectType: jwts.SubjectTypeUser,
+		Iss:         issuerURL(r),
+		SessionID:   record.SessionID,
+	})
+}
+
+// introspectAccessToken 通过 jwts.ParseJWT 校验签名与白名单
+func introspectAccessToken(r *http.Request, token string) (IntrospectionResponse, bool) {
+	ok, claims := jwts.ParseJWT(token)
+	if !ok {
+		return IntrospectionResponse{}, false
+	}
+	resp := IntrospectionResponse{
+		Active:      true,
+		Scope:       claims.Scope,
+		ClientID:    claims.ClientID,
+		TokenType:   "Bearer",
+		Sub:         claims.Subject,
+		SubjectType: claims.SubjectType,
+		Iss:         issuerURL(r),
+		JTI:         claims.JTI,
+		SessionID:   claims.SessionID,
+	}
+	// 旧版 Token 没有 sub 与 sub_type
+	if resp.Sub == "" {
+		resp.Sub = strconv.Itoa(claims.UserID)
+	}
+	if resp.SubjectType == "" {
+		resp.SubjectType = jwts.SubjectTypeUser
+	}
+	if claims.ExpiresAt != nil {
+		resp.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.Iat = claims.IssuedAt.Unix()
+	}
+	if claims.IsService() {
+		resp.SessionID = ""
+	}
+	return resp, true
+}
+
+// HandleRevoke 令牌吊销端点（RFC 7009），客户端只能吊销签发给自己的 Token
+// 吊销 Access Token 或 Refresh Token 都会注销其所在的整个会话
+// Token 无效或已吊销时同样返回 200
+func HandleRevoke(w http.ResponseWriter, r *http.Request) {
+	c, token, ok := parseTokenRequest(w, r)
+	if !ok {
+		return
+	}
+
+	hintRefresh := r.PostFormValue("token_type_hint") == "refresh_token"
+	if !hintRefresh && revokeAccessToken(w, c, token) {
+		return
+	}
+	record, err := jwts.LookupRefreshToken(token)
+	if err != nil {
+		if !errors.Is(err, jwts.ErrInvalidRefreshToken) {
+			writeError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+			return
+		}
+		// 提示为 refresh_token 但实际是 Access Token
+		if hintRefresh && revokeAccessToken(w, c, token) {
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if record.ClientID != c.ID {
+		writeError(w, http.StatusBadRequest, "unauthorized_client", "token was issued to another client")
+		return
+	}
+	if _, err := jwts.RemoveUserSession(record.UserID, record.SessionID); err != nil {
+		writeError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "")
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// revokeAccessToken 吊销有效的 Access Token，token 不是有效的 Access Token 时返回 false
+func revokeAccessToken(w http.ResponseWriter, c *caller, token string) bool {
+	ok, claims := jwts.ParseJWT(token)
+	if !ok {
+		return false
+	}
+	if claims.ClientID != c.ID {
+		writeError(w, http.StatusBadRequest, "unauthorized_client", "token was issued to another client")
+		return true
+	}
+	jwts.RemoveJWTFromWhitelist(claims.JTI)
+	w.WriteHeader(http.StatusOK)
+	return true
+}
@@ -0,0 +1,205 @@
+package oauth
+
+import (
+	"encoding/json"
+	"github.com/golang-jwt/jwt/v5"
+	"goauthx/internal/account"
+	"goauthx/internal/config"
+	"goauthx/internal/oauth"
+	"goauthx/internal/rbac"
+	"goauthx/internal/web/account/jwts"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UserInfo OIDC 标准声明，同时用于 /userinfo 响应和 id_token
+type UserInfo struct {
+	Subject           string   `json:"sub"`
+	PreferredUsername string   `json:"preferred_username,omitempty"`
+	Email             string   `json:"email,omitempty"`
+	EmailVerified     *bool    `json:"email_verified,omitempty"`
+	Roles             []string `json:"roles,omitempty"`
+}
+
+// IDTokenClaims id_token 声明，见 OpenID Connect Core 2
+type IDTokenClaims struct {
+	PreferredUsername string   `json:"preferred_username,omitempty"`
+	Email             string   `json:"email,omitempty"`
+	EmailVerified     *bool    `json:"email_verified,omitempty"`
+	Roles             []string `json:"roles,omitempty"`
+	Nonce             string   `json:"nonce,omitempty"`
+	AuthTime          int64    `json:"auth_time,omitempty"`
+	AuthorizedParty   string   `json:"azp,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// ProviderMetadata OpenID Connect Discovery 1.0 提供方元数据
+type ProviderMetadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	DeviceAuthorizationEndpoint       string   `json:"device_authorization_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+}
+
+// issuerURL 返回 OIDC 签发者地址，未配置时按请求推断
+func issuerURL(r *http.Request) string {
+	if iss := config.GetConfig().OAuth.Issuer; iss != "" {
+		return strings.TrimRight(iss, "/")
+	}
+	scheme := "http"
+	if r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// userInfo 按授权的 scope 从用户文档中取出声明，scopes 为 nil 表示第一方 Token，返回全部声明
+func userInfo(user *account.UserDoc, scopes []string) (UserInfo, error) {
+	info := UserInfo{Subject: strconv.FormatInt(user.UserId, 10)}
+	if scopes == nil || slices.Contains(scopes, "profile") {
+		info.PreferredUsername = user.Username
+	}
+	if scopes == nil || slices.Contains(scopes, "email") {
+		verified := user.IsEmailVerified()
+		info.Email = user.Email
+		info.EmailVerified = &verified
+	}
+	if scopes == nil || slices.Contains(scopes, jwts.RolesScope) {
+		roles, err := rbac.UserRoles(int(user.UserId))
+		if err != nil {
+			return info, err
+		}
+		info.Roles = roles
+	}
+	return info, nil
+}
+
+// newIDToken 为授权了 openid scope 的客户端签发 id_token
+// nonce 与 authTime 仅在授权码模式下存在
+func newIDToken(r *http.Request, clientID string, userID int, scope string, nonce string, authTime time.Time) (string, error) {
+	user, err := account.FindUserByID(int64(userID))
+	if err != nil {
+		return "", err
+	}
+	info, err := userInfo(user, oauth.ParseScope(scope))
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := IDTokenClaims{
+		PreferredUsername: info.PreferredUsername,
+		Email:             info.Email,
+		EmailVerified:     info.EmailVerified,
+		Roles:             info.Roles,
+		Nonce:             nonce,
+		AuthorizedParty:   clientID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuerURL(r),
+			Subject:   info.Subject,
+			Audience:  jwt.ClaimStrings{clientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(jwts.AccessTokenTTL())),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	if !authTime.IsZero() {
+		claims.AuthTime = authTime.Unix()
+	}
+	return jwts.SignClaims(claims)
+}
+
+// hasOpenIDScope 判断 scope 中是否包含 openid
+func hasOpenIDScope(scope string) bool {
+	return slices.Contains(oauth.ParseScope(scope), "openid")
+}
+
+// HandleDiscovery 提供方元数据（/.well-known/openid-configuration）
+func HandleDiscovery(w http.ResponseWriter, r *http.Request) {
+	issuer := issuerURL(r)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(ProviderMetadata{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/userinfo",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		DeviceAuthorizationEndpoint:       issuer + "/oauth/device_authorization",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code", "refresh_token", "client_credentials", deviceGrantType},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{jwts.SigningAlgorithm()},
+		ScopesSupported:                   append(slices.Clone(oauth.DefaultScopes), jwts.RolesScope),
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "azp", "preferred_username", "email", "email_verified", "roles"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+	})
+}
+
+// writeBearerError RFC 6750 3.1 错误响应
+func writeBearerError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="`+code+`", error_description="`+description+`"`)
+	writeJSON(w, status, ErrorResponse{Error: code, ErrorDescription: description})
+}
+
+// HandleUserInfo 返回 Access Token 对应用户的声明（/userinfo）
+func HandleUserInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request", "userinfo endpoint only accepts GET or POST")
+		return
+	}
+	token := jwts.BearerToken(r)
+	if token == "" {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeJSON(w, http.StatusUnauthorized, ErrorResponse{Error: "invalid_request", ErrorDescription: "missing bearer token"})
+		return
+	}
+	ok, claims := jwts.ParseJWT(token)
+	if !ok {
+		writeBearerError(w, http.StatusUnauthorized, "invalid_token", "token is invalid or expired")
+		return
+	}
+
+	if claims.IsService() {
+		writeBearerError(w, http.StatusForbidden, "insufficient_scope", "service account tokens have no userinfo")
+		return
+	}
+	// OAuth 客户端的 Token 必须授权了 openid，第一方 Token 不受限制
+	var scopes []string
+	if claims.ClientID != "" {
+		if !hasOpenIDScope(claims.Scope) {
+			writeBearerError(w, http.StatusForbidden, "insufficient_scope", "openid scope required")
+			return
+		}
+		scopes = oauth.ParseScope(claims.Scope)
+	}
+	user, err := account.FindUserByID(int64(claims.UserID))
+	if err != nil {
+		writeBearerError(w, http.StatusUnauthorized, "invalid_token", "user not found")
+		return
+	}
+	info, err := userInfo(user, scopes)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
@@ -0,0 +1,204 @@
+package oauth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"goauthx/internal/account"
+	"goauthx/internal/config"
+	"goauthx/internal/web/account/captcha"
+	"goauthx/internal/web/account/jwts"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	sessionCookieName = "goauthx_session"
+	csrfCookieName    = "goauthx_csrf"
+	cookiePath        = "/oauth"
+	authorizePagePath = "./static/oauth_authorize.html"
+)
+
+// pageData 托管登录/授权页面的模板数据
+type pageData struct {
+	AppName    string
+	Title      string
+	Step       string
+	Error      string
+	Message    string
+	Action     string
+	Hidden     map[string]string
+	CSRF       string
+	ClientName string
+	Scopes     []string
+	Username   string
+	Login      string
+	RequireMFA bool
+	UserCode   string
+}
+
+// renderPage 渲染托管页面，模板每次请求时读取，修改后无需重启
+func renderPage(w http.ResponseWriter, r *http.Request, status int, data pageData) {
+	tmpl, err := template.ParseFiles(authorizePagePath)
+	if err != nil {
+		log.Printf("加载授权页面模板失败: %v", err)
+		http.Error(w, "Failed to load page template", http.StatusInternalServerError)
+		return
+	}
+	data.AppName = config.GetConfig().Name
+	data.CSRF = ensureCSRFToken(w, r)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// 禁止被嵌入 iframe，防止点击劫持
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("渲染授权页面失败: %v", err)
+	}
+}
+
+// renderError 渲染无法回调客户端时的错误页面
+func renderError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	renderPage(w, r, status, pageData{Title: "授权失败", Step: "error", Error: msg})
+}
+
+func secureCookie() bool {
+	return config.GetConfig().HTTPServer.EnableSSL
+}
+
+// ensureCSRFToken 双重提交 Cookie 方式的 CSRF Token
+func ensureCSRFToken(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(csrfCookieName); err == nil && len(c.Value) == 64 {
+		return c.Value
+	}
+	buf := make([]byte, 32)
+	_, _ = rand.Read(buf)
+	token := hex.EncodeToString(buf)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    token,
+		Path:     cookiePath,
+		HttpOnly: true,
+		Secure:   secureCookie(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return token
+}
+
+// checkCSRF 校验表单中的 CSRF Token 与 Cookie 一致
+func checkCSRF(r *http.Request) bool {
+	c, err := r.Cookie(csrfCookieName)
+	if err != nil || c.Value == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(c.Value), []byte(r.PostFormValue("csrf_token"))) == 1
+}
+
+// currentUser 从浏览器会话 Cookie 中取得当前登录用户
+func currentUser(r *http.Request) (*account.UserDoc, *jwts.Claims) {
+	c, err := r.Cookie(sessionCookieName)
+	if err != nil || c.Value == "" {
+		return nil, nil
+	}
+	ok, claims := jwts.ParseJWT(c.Value)
+	if !ok || claims.IsService() || claims.ClientID != "" {
+		return nil, nil
+	}
+	user, err := account.FindUserByID(int64(claims.UserID))
+	if err != nil {
+		return nil, nil
+	}
+	return user, claims
+}
+
+func sessionInfo(r *http.Request) jwts.SessionInfo {
+	return jwts.SessionInfo{UserAgent: r.UserAgent(), IP: captcha.ClientIP(r)}
+}
+
+// startBrowserSession 登录成功后签发浏览器会话 Token 并写入 Cookie
+func startBrowserSession(w http.ResponseWriter, r *http.Request, userID int) error {
+	hours := config.GetConfig().OAuth.LoginSessionHours
+	if hours <= 0 {
+		hours = 12
+	}
+	duration := time.Duration(hours) * time.Hour
+	token, err := jwts.GenerateJWT(userID, duration, sessionInfo(r))
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     cookiePath,
+		Expires:  time.Now().Add(duration),
+		HttpOnly: true,
+		Secure:   secureCookie(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// endBrowserSession 注销浏览器会话并清除 Cookie
+func endBrowserSession(w http.ResponseWriter, claims *jwts.Claims) {
+	if claims != nil {
+		jwts.RemoveJWTFromWhitelist(claims.JTI)
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     cookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   secureCookie(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// loginForm 校验托管登录表单，返回登录用户或需要展示给用户的错误
+// 开启两步验证的用户需要同时提交动态码，needMFA 表示需要展示动态码输入框
+func loginForm(r *http.Request) (user *account.UserDoc, errMsg string, needMFA bool) {
+	login := strings.TrimSpace(r.PostFormValue("username"))
+	password := strings.TrimSpace(r.PostFormValue("password"))
+	if login == "" || password == "" {
+		return nil, "请输入用户名和密码", false
+	}
+	user, err := account.FindUserByLogin(login)
+	if err != nil {
+		return nil, "用户名或密码错误", false
+	}
+	if !account.CheckPassword(user, password) {
+		return nil, "用户名或密码错误", false
+	}
+	banned, ban, err := account.IsUserBanned(int(user.UserId))
+	if err != nil {
+		return nil, "服务器内部错误，请稍后重试", false
+	}
+	if banned {
+		msg := "账号已被封禁"
+		if ban != nil && ban.BanReason != "" {
+			msg += "：" + ban.BanReason
+		}
+		return nil, msg, false
+	}
+	if account.EmailVerificationRequired(user) {
+		return nil, "邮箱尚未验证，请先点击验证邮件中的链接", false
+	}
+	if user.TOTPEnabled {
+		code := strings.TrimSpace(r.PostFormValue("mfa_code"))
+		if code == "" {
+			return nil, "请输入两步验证码", true
+		}
+		if err := account.VerifyMFA(user, code); err != nil {
+			if errors.Is(err, account.ErrMFALocked) {
+				return nil, "两步验证失败次数过多，请稍后重试", true
+			}
+			return nil, "两步验证码错误", true
+		}
+	}
+	return user, "", false
+}
@@ -0,0 +1,240 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"goauthx/internal/account"
+	"goauthx/internal/oauth"
+	"goauthx/internal/web/account/jwts"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TokenResponse RFC 6749 5.1 成功响应
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+// ErrorResponse RFC 6749 5.2 错误响应
+type ErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, description string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	writeJSON(w, status, ErrorResponse{Error: code, ErrorDescription: description})
+}
+
+// clientCredentials 按 client_secret_basic 或 client_secret_post 取出客户端凭据
+func clientCredentials(r *http.Request) (clientID, secret string) {
+	clientID, secret, hasBasic := r.BasicAuth()
+	if !hasBasic {
+		clientID = r.PostFormValue("client_id")
+		secret = r.PostFormValue("client_secret")
+	}
+	return clientID, secret
+}
+
+// authenticateClient 认证 OAuth 客户端，公开客户端只需提供 client_id
+func authenticateClient(r *http.Request) (*oauth.Client, bool) {
+	clientID, secret := clientCredentials(r)
+	if clientID == "" {
+		return nil, false
+	}
+	client, err := oauth.GetClient(clientID)
+	if err != nil {
+		return nil, false
+	}
+	if client.IsPublic() {
+		return client, secret == ""
+	}
+	return client, client.VerifySecret(secret)
+}
+
+// HandleToken 令牌端点
+func HandleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request", "token endpoint only accepts POST")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request", "malformed request body")
+		return
+	}
+	// client_credentials 模式由服务账号认证，不经过 OAuth 客户端
+	if r.PostFormValue("grant_type") == "client_credentials" {
+		handleClientCredentialsGrant(w, r)
+		return
+	}
+	client, ok := authenticateClient(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		handleAuthorizationCodeGrant(w, r, client)
+	case "refresh_token":
+		handleRefreshTokenGrant(w, r, client)
+	case deviceGrantType:
+		handleDeviceCodeGrant(w, r, client)
+	case "":
+		writeError(w, http.StatusBadRequest, "invalid_request", "missing grant_type")
+	default:
+		writeError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
+
+func handleAuthorizationCodeGrant(w http.ResponseWriter, r *http.Request, client *oauth.Client) {
+	codeValue := r.PostFormValue("code")
+	if codeValue == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "missing code")
+		return
+	}
+	code, found := oauth.ConsumeAuthorizationCode(codeValue)
+	if !found || code.ClientID != client.ClientID {
+		writeError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired authorization code")
+		return
+	}
+	// RFC 6749 4.1.3：授权请求携带了 redirect_uri 时必须传相同的值，未携带时可以省略
+	redirectURI := r.PostFormValue("redirect_uri")
+	if (code.RedirectURIProvided || redirectURI != "") && redirectURI != code.RedirectURI {
+		writeError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri mismatch")
+		return
+	}
+	if code.CodeChallenge != "" && !oauth.VerifyPKCE(code.CodeChallenge, code.CodeChallengeMethod, r.PostFormValue("code_verifier")) {
+		writeError(w, http.StatusBadRequest, "invalid_grant", "PKCE verification failed")
+		return
+	}
+
+	// 授权码签发后用户可能已被封禁
+	banned, _, err := account.IsUserBanned(code.UserID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if banned {
+		writeError(w, http.StatusBadRequest, "invalid_grant", "user is banned")
+		return
+	}
+
+	session := jwts.SessionInfo{UserAgent: code.UserAgent, IP: code.IP}
+	pair, err := jwts.IssueTokenPair(code.UserID, session, jwts.Grant{ClientID: client.ClientID, Scope: code.Scope})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", "failed to issue token")
+		return
+	}
+	resp := tokenResponse(pair)
+	if hasOpenIDScope(code.Scope) {
+		resp.IDToken, err = newIDToken(r, client.ClientID, code.UserID, code.Scope, code.Nonce, code.AuthTime)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "server_error", "failed to issue id_token")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func handleRefreshTokenGrant(w http.ResponseWriter, r *http.Request, client *oauth.Client) {
+	refreshToken := r.PostFormValue("refresh_token")
+	if refreshToken == "" {
+		writeError(w, http.StatusBadRequest, "invalid_request", "missing refresh_token")
+		return
+	}
+	pair, err := jwts.RefreshTokenPair(refreshToken, client.ClientID, sessionInfo(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, jwts.ErrInvalidRefreshToken), errors.Is(err, jwts.ErrClientMismatch):
+			writeError(w, http.StatusBadRequest, "invalid_grant", "invalid or expired refresh token")
+		case errors.Is(err, jwts.ErrRefreshTokenReused):
+			writeError(w, http.StatusBadRequest, "invalid_grant", "refresh token reused, session revoked")
+		case errors.Is(err, jwts.ErrRefreshDenied):
+			writeError(w, http.StatusBadRequest, "invalid_grant", "user is not allowed to log in, session revoked")
+		default:
+			writeError(w, http.StatusInternalServerError, "server_error", "")
+		}
+		return
+	}
+	resp := tokenResponse(pair)
+	// 刷新时重新签发的 id_token 不携带 nonce 与 auth_time
+	if hasOpenIDScope(pair.Scope) {
+		resp.IDToken, err = newIDToken(r, client.ClientID, pair.UserID, pair.Scope, "", time.Time{})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "server_error", "failed to issue id_token")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func handleClientCredentialsGrant(w http.ResponseWriter, r *http.Request) {
+	id, secret := clientCredentials(r)
+	if id == "" {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+	sa, err := oauth.GetServiceAccount(id)
+	if err != nil && !errors.Is(err, oauth.ErrServiceAccountNotFound) {
+		writeError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+	if sa == nil || sa.Disabled || !sa.VerifySecret(secret) {
+		writeError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	// 未指定 scope 时授予服务账号允许的全部 scope
+	scopes := oauth.ParseScope(r.PostFormValue("scope"))
+	if len(scopes) == 0 {
+		scopes = sa.Scopes
+	} else if !sa.AllowsScopes(scopes) {
+		writeError(w, http.StatusBadRequest, "invalid_scope", "requested scope is not allowed for this service account")
+		return
+	}
+	scope := strings.Join(scopes, " ")
+	token, _, err := jwts.GenerateServiceJWT(sa.ID, scope, sessionInfo(r))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", "failed to issue token")
+		return
+	}
+	if err := oauth.TouchServiceAccount(sa.ID); err != nil {
+		log.Printf("更新服务账号 %s 使用时间失败: %v", sa.ID, err)
+	}
+	// RFC 6749 4.4.3 不签发 Refresh Token
+	writeJSON(w, http.StatusOK, TokenResponse{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(jwts.AccessTokenTTL().Seconds()),
+		Scope:       scope,
+	})
+}
+
+func tokenResponse(pair *jwts.TokenPair) TokenResponse {
+	return TokenResponse{
+		AccessToken:  pair.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    pair.ExpiresIn,
+		RefreshToken: pair.RefreshToken,
+		Scope:        pair.Scope,
+	}
+}
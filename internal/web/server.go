@@ -3,22 +3,85 @@ package web
 import (
 	"fmt"
 	"goauthx/internal/config"
+	"goauthx/internal/rbac"
 	"log"
 	"net/http"
 )
 
 import (
 	"goauthx/internal/web/account/captcha"
+	"goauthx/internal/web/account/jwts"
 	"goauthx/internal/web/account/users"
+	"goauthx/internal/web/admin"
+	"goauthx/internal/web/authz"
+	"goauthx/internal/web/oauth"
 )
 
 func StartServer() error {
 	cfg := config.GetConfig()
 	addr := fmt.Sprintf(":%d", cfg.HTTPServer.Port)
 
+	if err := jwts.InitKeys(); err != nil {
+		return fmt.Errorf("load jwt signing key: %w", err)
+	}
+	jwts.StartKeyRotation()
+	if err := rbac.EnsureDefaults(); err != nil {
+		return fmt.Errorf("init roles and permissions: %w", err)
+	}
+
 	http.HandleFunc("/captcha", captcha.HandleCaptcha)
 	http.HandleFunc("/login", users.HandleLogin)
+	http.HandleFunc("/login/mfa", users.HandleLoginMFA)
+	http.HandleFunc("POST /login/magic", users.HandleMagicLink)
+	http.HandleFunc("GET /login/magic/verify", users.HandleMagicLinkVerify)
+	http.HandleFunc("POST /login/magic/verify", users.HandleMagicLinkVerify)
 	http.HandleFunc("/register", users.HandleRegister)
+	http.HandleFunc("/token/refresh", users.HandleRefreshToken)
+	http.HandleFunc("/password/forgot", users.HandleForgotPassword)
+	http.HandleFunc("/password/reset", users.HandleResetPassword)
+	http.HandleFunc("/password/change", users.HandleChangePassword)
+	http.HandleFunc("/email/change", users.HandleChangeEmail)
+	http.HandleFunc("GET /email/verify", users.HandleVerifyEmail)
+	http.HandleFunc("POST /email/verify", users.HandleVerifyEmail)
+	http.HandleFunc("POST /email/verify/resend", users.HandleResendVerification)
+	http.HandleFunc("POST /logout", users.HandleLogout)
+	http.HandleFunc("POST /logout/all", users.HandleLogoutAll)
+	http.HandleFunc("GET /sessions", users.HandleListSessions)
+	http.HandleFunc("DELETE /sessions/{jti}", users.HandleRevokeSession)
+	http.HandleFunc("POST /tokens", users.HandleCreateToken)
+	http.HandleFunc("GET /tokens", users.HandleListTokens)
+	http.HandleFunc("DELETE /tokens/{id}", users.HandleRevokeToken)
+	http.HandleFunc("POST /mfa/totp/setup", users.HandleTOTPSetup)
+	http.HandleFunc("POST /mfa/totp/confirm", users.HandleTOTPConfirm)
+	http.HandleFunc("POST /mfa/totp/disable", users.HandleTOTPDisable)
+	http.HandleFunc("POST /mfa/recovery-codes", users.HandleRecoveryCodesRegenerate)
+	http.HandleFunc("POST /webauthn/register/begin", users.HandleWebAuthnRegisterBegin)
+	http.HandleFunc("POST /webauthn/register/finish", users.HandleWebAuthnRegisterFinish)
+	http.HandleFunc("POST /webauthn/login/begin", users.HandleWebAuthnLoginBegin)
+	http.HandleFunc("POST /webauthn/login/finish", users.HandleWebAuthnLoginFinish)
+	http.HandleFunc("GET /webauthn/credentials", users.HandleListWebAuthnCredentials)
+	http.HandleFunc("DELETE /webauthn/credentials/{id}", users.HandleDeleteWebAuthnCredential)
+	http.HandleFunc("GET /.well-known/jwks.json", jwts.HandleJWKS)
+	http.HandleFunc("/oauth/authorize", oauth.HandleAuthorize)
+	http.HandleFunc("/oauth/token", oauth.HandleToken)
+	http.HandleFunc("/oauth/introspect", oauth.HandleIntrospect)
+	http.HandleFunc("/oauth/revoke", oauth.HandleRevoke)
+	http.HandleFunc("/oauth/device_authorization", oauth.HandleDeviceAuthorization)
+	http.HandleFunc("/oauth/device", oauth.HandleDevice)
+	http.HandleFunc("GET /.well-known/openid-configuration", oauth.HandleDiscovery)
+	http.HandleFunc("/userinfo", oauth.HandleUserInfo)
+	http.HandleFunc("GET /admin/v1/users", authz.RequireAdmin(admin.PermissionUsersRead, admin.HandleListUsers))
+	http.HandleFunc("POST /admin/v1/users", authz.RequireAdmin(admin.PermissionUsersWrite, admin.HandleCreateUser))
+	http.HandleFunc("POST /admin/v1/users/import", authz.RequireAdmin(admin.PermissionUsersWrite, admin.HandleImportUsers))
+	http.HandleFunc("GET /admin/v1/users/{id}", authz.RequireAdmin(admin.PermissionUsersRead, admin.HandleGetUser))
+	http.HandleFunc("PATCH /admin/v1/users/{id}", authz.RequireAdmin(admin.PermissionUsersWrite, admin.HandleUpdateUser))
+	http.HandleFunc("DELETE /admin/v1/users/{id}", authz.RequireAdmin(admin.PermissionUsersWrite, admin.HandleDeleteUser))
+	http.HandleFunc("POST /admin/v1/users/{id}/logout", authz.RequireAdmin(admin.PermissionUsersWrite, admin.HandleLogoutUser))
+	http.HandleFunc("POST /admin/v1/users/{id}/verification-email", authz.RequireAdmin(admin.PermissionUsersWrite, admin.HandleSendVerification))
+	http.HandleFunc("GET /admin/v1/users/{id}/bans", authz.RequireAdmin(admin.PermissionUsersRead, admin.HandleListUserBans))
+	http.HandleFunc("POST /admin/v1/users/{id}/bans", authz.RequireAdmin(admin.PermissionUsersWrite, admin.HandleBanUser))
+	http.HandleFunc("POST /admin/v1/users/{id}/unban", authz.RequireAdmin(admin.PermissionUsersWrite, admin.HandleUnbanUser))
+	http.HandleFunc("GET /admin/v1/bans", authz.RequireAdmin(admin.PermissionUsersRead, admin.HandleListActiveBans))
 
 	if cfg.HTTPServer.EnableSSL {
 		log.Printf("Starting HTTPS server on %s\n", addr)
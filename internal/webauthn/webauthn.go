@@ -0,0 +1,441 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// 认证器数据标志位
+const (
+	flagUserPresent            = 0x01
+	flagUserVerified           = 0x04
+	flagBackupEligible         = 0x08
+	flagBackupState            = 0x10
+	flagAttestedCredentialData = 0x40
+	flagExtensionData          = 0x80
+)
+
+const (
+	PublicKeyCredentialType = "public-key"
+	// 凭据ID的最大长度
+	maxCredentialIDLength = 1023
+)
+
+var (
+	ErrChallengeMismatch = errors.New("webauthn: challenge mismatch")
+	ErrOriginNotAllowed  = errors.New("webauthn: origin not allowed")
+	ErrUserNotVerified   = errors.New("webauthn: user verification required")
+	// ErrSignCount 签名计数没有增长，认证器可能被克隆
+	ErrSignCount = errors.New("webauthn: signature counter did not increase")
+)
+
+// RelyingParty 依赖方，ID 为站点域名，Origins 为允许发起仪式的来源
+// 移动端应用的来源如 android:apk-key-hash:... 需要显式配置
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+// Bytes JSON 中以 base64url 编码的二进制数据
+type Bytes []byte
+
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON 兼容带填充的 base64url 与标准 base64
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	s = strings.TrimRight(s, "=")
+	decoded, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		if decoded, err = base64.RawStdEncoding.DecodeString(s); err != nil {
+			return fmt.Errorf("webauthn: invalid base64url data")
+		}
+	}
+	*b = decoded
+	return nil
+}
+
+// NewChallenge 生成32字节的随机挑战
+func NewChallenge() (Bytes, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         Bytes    `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type RPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          Bytes  `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey,omitempty"`
+	UserVerification string `json:"userVerification,omitempty"`
+}
+
+// CreationOptions 注册仪式的参数，即 navigator.credentials.create() 的 publicKey
+type CreationOptions struct {
+	Challenge              Bytes                  `json:"challenge"`
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout,omitempty"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions 登录仪式的参数，即 navigator.credentials.get() 的 publicKey
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	Timeout          int64                  `json:"timeout,omitempty"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CreationOptions 生成注册参数，excluded 为用户已注册的凭据，避免同一认证器重复注册
+func (rp *RelyingParty) CreationOptions(challenge Bytes, user UserEntity, excluded []CredentialDescriptor, timeoutMillis int64) CreationOptions {
+	params := make([]CredentialParameter, 0, len(SupportedAlgorithms))
+	for _, alg := range SupportedAlgorithms {
+		params = append(params, CredentialParameter{Type: PublicKeyCredentialType, Alg: alg})
+	}
+	if excluded == nil {
+		excluded = []CredentialDescriptor{}
+	}
+	return CreationOptions{
+		Challenge:          challenge,
+		RP:                 RPEntity{ID: rp.ID, Name: rp.Name},
+		User:               user,
+		PubKeyCredParams:   params,
+		Timeout:            timeoutMillis,
+		ExcludeCredentials: excluded,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions 生成登录参数，allowed 为空时由认证器选择可发现凭据（通行密钥）
+func (rp *RelyingParty) RequestOptions(challenge Bytes, allowed []CredentialDescriptor, userVerification string, timeoutMillis int64) RequestOptions {
+	if allowed == nil {
+		allowed = []CredentialDescriptor{}
+	}
+	return RequestOptions{
+		Challenge:        challenge,
+		Timeout:          timeoutMillis,
+		RPID:             rp.ID,
+		AllowCredentials: allowed,
+		UserVerification: userVerification,
+	}
+}
+
+// AttestationResponse 注册仪式中浏览器返回的凭据，即 PublicKeyCredential.toJSON()
+type AttestationResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes    `json:"clientDataJSON"`
+		AttestationObject Bytes    `json:"attestationObject"`
+		Transports        []string `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// AssertionResponse 登录仪式中浏览器返回的凭据
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AuthenticatorData Bytes `json:"authenticatorData"`
+		Signature         Bytes `json:"signature"`
+		UserHandle        Bytes `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// AuthenticatorData 认证器数据，注册时包含新凭据的ID与公钥
+type AuthenticatorData struct {
+	RPIDHash     []byte
+	Flags        byte
+	SignCount    uint32
+	AAGUID       []byte
+	CredentialID []byte
+	// PublicKey COSE_Key 格式的凭据公钥
+	PublicKey []byte
+}
+
+func (a *AuthenticatorData) UserPresent() bool    { return a.Flags&flagUserPresent != 0 }
+func (a *AuthenticatorData) UserVerified() bool   { return a.Flags&flagUserVerified != 0 }
+func (a *AuthenticatorData) BackupEligible() bool { return a.Flags&flagBackupEligible != 0 }
+func (a *AuthenticatorData) BackupState() bool    { return a.Flags&flagBackupState != 0 }
+
+// parseAuthenticatorData 解析认证器数据：rpIdHash(32) flags(1) signCount(4) [凭据数据] [扩展]
+func parseAuthenticatorData(data []byte) (*AuthenticatorData, error) {
+	if len(data) < 37 {
+		return nil, errors.New("webauthn: authenticator data too short")
+	}
+	ad := &AuthenticatorData{
+		RPIDHash:  data[:32],
+		Flags:     data[32],
+		SignCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	rest := data[37:]
+	if ad.Flags&flagAttestedCredentialData != 0 {
+		if len(rest) < 18 {
+			return nil, errors.New("webauthn: attested credential data too short")
+		}
+		ad.AAGUID = rest[:16]
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen > maxCredentialIDLength || len(rest) < idLen {
+			return nil, errors.New("webauthn: invalid credential id length")
+		}
+		ad.CredentialID = rest[:idLen]
+		rest = rest[idLen:]
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("webauthn: invalid credential public key: %w", err)
+		}
+		ad.PublicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+	if ad.Flags&flagExtensionData != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("webauthn: invalid extension data: %w", err)
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("webauthn: trailing data after authenticator data")
+	}
+	return ad, nil
+}
+
+// verifyAuthenticatorData 校验依赖方ID哈希与用户在场、用户验证标志
+func (rp *RelyingParty) verifyAuthenticatorData(ad *AuthenticatorData, requireUV bool) error {
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(ad.RPIDHash, rpIDHash[:]) != 1 {
+		return errors.New("webauthn: relying party id mismatch")
+	}
+	if !ad.UserPresent() {
+		return errors.New("webauthn: user not present")
+	}
+	if requireUV && !ad.UserVerified() {
+		return ErrUserNotVerified
+	}
+	return nil
+}
+
+type collectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// verifyClientData 校验 clientDataJSON 的类型、挑战与来源
+func (rp *RelyingParty) verifyClientData(raw []byte, typ string, challenge Bytes) error {
+	var cd collectedClientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return fmt.Errorf("webauthn: invalid client data: %w", err)
+	}
+	if cd.Type != typ {
+		return fmt.Errorf("webauthn: unexpected client data type %q", cd.Type)
+	}
+	expected := base64.RawURLEncoding.EncodeToString(challenge)
+	if subtle.ConstantTimeCompare([]byte(strings.TrimRight(cd.Challenge, "=")), []byte(expected)) != 1 {
+		return ErrChallengeMismatch
+	}
+	if cd.CrossOrigin || !slices.Contains(rp.Origins, cd.Origin) {
+		return ErrOriginNotAllowed
+	}
+	return nil
+}
+
+// Credential 注册成功后需要保存的凭据
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte
+	Algorithm      int64
+	SignCount      uint32
+	AAGUID         []byte
+	Transports     []string
+	BackupEligible bool
+	BackupState    bool
+}
+
+// VerifyRegistration 校验注册仪式的响应，返回新凭据
+// 不校验证书链，packed 格式只校验签名，其他格式的证明声明被忽略
+func (rp *RelyingParty) VerifyRegistration(resp *AttestationResponse, challenge Bytes, requireUV bool) (*Credential, error) {
+	if resp.Type != PublicKeyCredentialType {
+		return nil, errors.New("webauthn: unexpected credential type")
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	v, rest, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: invalid attestation object: %w", err)
+	}
+	att, ok := v.(map[any]any)
+	if !ok || len(rest) != 0 {
+		return nil, errors.New("webauthn: invalid attestation object")
+	}
+	format, _ := att["fmt"].(string)
+	attStmt, _ := att["attStmt"].(map[any]any)
+	authData, _ := att["authData"].([]byte)
+	if format == "" || attStmt == nil || authData == nil {
+		return nil, errors.New("webauthn: invalid attestation object")
+	}
+
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(ad, requireUV); err != nil {
+		return nil, err
+	}
+	if ad.CredentialID == nil {
+		return nil, errors.New("webauthn: missing attested credential data")
+	}
+	if len(resp.RawID) > 0 && !bytes.Equal(resp.RawID, ad.CredentialID) {
+		return nil, errors.New("webauthn: credential id mismatch")
+	}
+	key, err := ParsePublicKey(ad.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+	switch format {
+	case "none":
+		if len(attStmt) != 0 {
+			return nil, errors.New("webauthn: none attestation with statement")
+		}
+	case "packed":
+		if err := verifyPackedAttestation(attStmt, key, signed); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Credential{
+		ID:             ad.CredentialID,
+		PublicKey:      ad.PublicKey,
+		Algorithm:      key.Algorithm,
+		SignCount:      ad.SignCount,
+		AAGUID:         ad.AAGUID,
+		Transports:     resp.Response.Transports,
+		BackupEligible: ad.BackupEligible(),
+		BackupState:    ad.BackupState(),
+	}, nil
+}
+
+// verifyPackedAttestation 校验 packed 格式的证明签名：
+// 带证书时使用叶子证书的公钥，否则为自证明，使用凭据公钥
+func verifyPackedAttestation(attStmt map[any]any, credKey *PublicKey, signed []byte) error {
+	alg, _ := attStmt["alg"].(int64)
+	sig, _ := attStmt["sig"].([]byte)
+	if sig == nil {
+		return errors.New("webauthn: packed attestation without signature")
+	}
+	x5c, _ := attStmt["x5c"].([]any)
+	if len(x5c) == 0 {
+		if alg != credKey.Algorithm {
+			return errors.New("webauthn: self attestation algorithm mismatch")
+		}
+		return credKey.Verify(signed, sig)
+	}
+	der, _ := x5c[0].([]byte)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return fmt.Errorf("webauthn: invalid attestation certificate: %w", err)
+	}
+	var sigAlg x509.SignatureAlgorithm
+	switch alg {
+	case AlgES256:
+		sigAlg = x509.ECDSAWithSHA256
+	case AlgRS256:
+		sigAlg = x509.SHA256WithRSA
+	case AlgEdDSA:
+		sigAlg = x509.PureEd25519
+	default:
+		return fmt.Errorf("webauthn: unsupported attestation algorithm %d", alg)
+	}
+	if err := cert.CheckSignature(sigAlg, signed, sig); err != nil {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// VerifyAssertion 校验登录仪式的响应，publicKey、signCount 为保存的凭据公钥与签名计数
+// 返回认证器数据，调用方需要保存新的签名计数
+func (rp *RelyingParty) VerifyAssertion(resp *AssertionResponse, challenge Bytes, publicKey []byte, signCount uint32, requireUV bool) (*AuthenticatorData, error) {
+	if resp.Type != PublicKeyCredentialType {
+		return nil, errors.New("webauthn: unexpected credential type")
+	}
+	if err := rp.verifyClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+	ad, err := parseAuthenticatorData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.verifyAuthenticatorData(ad, requireUV); err != nil {
+		return nil, err
+	}
+	key, err := ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(append([]byte{}, resp.Response.AuthenticatorData...), clientDataHash[:]...)
+	if err := key.Verify(signed, resp.Response.Signature); err != nil {
+		return nil, err
+	}
+	// 不支持计数的认证器（如同步的通行密钥）始终为 0
+	if (ad.SignCount != 0 || signCount != 0) && ad.SignCount <= signCount {
+		return nil, ErrSignCount
+	}
+	return ad, nil
+}
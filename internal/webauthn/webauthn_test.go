@@ -0,0 +1,614 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sort"
+	"testing"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+func testRP() *RelyingParty {
+	return &RelyingParty{ID: testRPID, Name: "Example", Origins: []string{testOrigin}}
+}
+
+// 测试用的 CBOR 编码，只覆盖 WebAuthn 用到的类型，映射按键的编码排序（CTAP2 规范编码）
+type cborMap map[any]any
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+	}
+}
+
+func encodeCBOR(v any) []byte {
+	switch v := v.(type) {
+	case int:
+		return encodeCBOR(int64(v))
+	case int64:
+		if v >= 0 {
+			return cborHead(0, uint64(v))
+		}
+		return cborHead(1, uint64(-1-v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	case []any:
+		out := cborHead(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	case cborMap:
+		type entry struct{ key, value []byte }
+		entries := make([]entry, 0, len(v))
+		for k, val := range v {
+			entries = append(entries, entry{encodeCBOR(k), encodeCBOR(val)})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			a, b := entries[i].key, entries[j].key
+			if len(a) != len(b) {
+				return len(a) < len(b)
+			}
+			return bytes.Compare(a, b) < 0
+		})
+		out := cborHead(5, uint64(len(v)))
+		for _, e := range entries {
+			out = append(append(out, e.key...), e.value...)
+		}
+		return out
+	}
+	panic("unsupported CBOR value")
+}
+
+// softAuthenticator 软件认证器，按 WebAuthn Level 3 生成注册与登录的响应
+type softAuthenticator struct {
+	alg          int64
+	signer       crypto.Signer
+	credentialID []byte
+	signCount    uint32
+	rpID         string
+	origin       string
+	flags        byte
+	// noCounter 模拟不支持签名计数的认证器，计数始终为 0
+	noCounter bool
+}
+
+func newSoftAuthenticator(t *testing.T, alg int64) *softAuthenticator {
+	t.Helper()
+	var signer crypto.Signer
+	var err error
+	switch alg {
+	case AlgES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		t.Fatalf("unsupported algorithm %d", alg)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return &softAuthenticator{
+		alg:          alg,
+		signer:       signer,
+		credentialID: id,
+		rpID:         testRPID,
+		origin:       testOrigin,
+		flags:        flagUserPresent | flagUserVerified,
+	}
+}
+
+func (a *softAuthenticator) coseKey() []byte {
+	switch key := a.signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		x := key.X.FillBytes(make([]byte, 32))
+		y := key.Y.FillBytes(make([]byte, 32))
+		return encodeCBOR(cborMap{
+			int64(coseKeyType): int64(coseKeyTypeEC2), int64(coseAlgorithm): AlgES256,
+			int64(coseCurve): int64(coseCurveP256), int64(coseX): x, int64(coseY): y,
+		})
+	case ed25519.PublicKey:
+		return encodeCBOR(cborMap{
+			int64(coseKeyType): int64(coseKeyTypeOKP), int64(coseAlgorithm): AlgEdDSA,
+			int64(coseCurve): int64(coseCurveEd25519), int64(coseX): []byte(key),
+		})
+	}
+	panic("unsupported key")
+}
+
+func (a *softAuthenticator) sign(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var sig []byte
+	var err error
+	if a.alg == AlgES256 {
+		digest := sha256.Sum256(data)
+		sig, err = a.signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	} else {
+		sig, err = a.signer.Sign(rand.Reader, data, crypto.Hash(0))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+func (a *softAuthenticator) authData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	flags := a.flags
+	if attested {
+		flags |= flagAttestedCredentialData
+	}
+	data := append(rpIDHash[:], flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func (a *softAuthenticator) clientData(typ string, challenge Bytes) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"type":      typ,
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    a.origin,
+	})
+	return data
+}
+
+// register 模拟 navigator.credentials.create()，format 为 none 或 packed（自证明）
+func (a *softAuthenticator) register(t *testing.T, challenge Bytes, format string) *AttestationResponse {
+	t.Helper()
+	clientData := a.clientData("webauthn.create", challenge)
+	authData := a.authData(true)
+	attStmt := cborMap{}
+	if format == "packed" {
+		hash := sha256.Sum256(clientData)
+		attStmt = cborMap{"alg": a.alg, "sig": a.sign(t, append(append([]byte{}, authData...), hash[:]...))}
+	}
+	resp := &AttestationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		RawID: a.credentialID,
+		Type:  PublicKeyCredentialType,
+	}
+	resp.Response.ClientDataJSON = clientData
+	resp.Response.AttestationObject = encodeCBOR(cborMap{"fmt": format, "attStmt": attStmt, "authData": authData})
+	return resp
+}
+
+// login 模拟 navigator.credentials.get()，每次调用签名计数加一
+func (a *softAuthenticator) login(t *testing.T, challenge Bytes) *AssertionResponse {
+	t.Helper()
+	if !a.noCounter {
+		a.signCount++
+	}
+	clientData := a.clientData("webauthn.get", challenge)
+	authData := a.authData(false)
+	hash := sha256.Sum256(clientData)
+	resp := &AssertionResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(a.credentialID),
+		RawID: a.credentialID,
+		Type:  PublicKeyCredentialType,
+	}
+	resp.Response.ClientDataJSON = clientData
+	resp.Response.AuthenticatorData = authData
+	resp.Response.Signature = a.sign(t, append(append([]byte{}, authData...), hash[:]...))
+	return resp
+}
+
+func newTestChallenge(t *testing.T) Bytes {
+	t.Helper()
+	challenge, err := NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return challenge
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	data := encodeCBOR(cborMap{
+		int64(1):  int64(2),
+		int64(-1): int64(-300),
+		"bytes":   []byte{1, 2, 3},
+		"list":    []any{"a", true, nil, int64(1 << 40)},
+	})
+	v, rest, err := decodeCBOR(append(data, 0xff))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, []byte{0xff}) {
+		t.Fatalf("rest = %x, want ff", rest)
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		t.Fatalf("decoded %T, want map", v)
+	}
+	if m[int64(1)] != int64(2) || m[int64(-1)] != int64(-300) {
+		t.Fatalf("unexpected integers: %v", m)
+	}
+	if b, _ := m["bytes"].([]byte); !bytes.Equal(b, []byte{1, 2, 3}) {
+		t.Fatalf("bytes = %v", m["bytes"])
+	}
+	list, _ := m["list"].([]any)
+	if len(list) != 4 || list[0] != "a" || list[1] != true || list[2] != nil || list[3] != int64(1<<40) {
+		t.Fatalf("list = %v", list)
+	}
+
+	// float16 1.5
+	if v, _, err := decodeCBOR([]byte{0xf9, 0x3e, 0x00}); err != nil || v != 1.5 {
+		t.Fatalf("float16 = %v, %v", v, err)
+	}
+
+	nested := []byte{}
+	for i := 0; i <= maxCBORDepth+1; i++ {
+		nested = append(nested, 0x81)
+	}
+	nested = append(nested, 0x00)
+	invalid := map[string][]byte{
+		"empty":          {},
+		"truncated text": {0x63, 'a', 'b'},
+		"huge array":     {0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		"duplicate key":  {0xa2, 0x01, 0x00, 0x01, 0x00},
+		"bytes key":      {0xa1, 0x41, 0x00, 0x00},
+		"indefinite":     {0x5f, 0x41, 0x00, 0xff},
+		"tag":            {0xc0, 0x00},
+		"too deep":       nested,
+	}
+	for name, data := range invalid {
+		if _, _, err := decodeCBOR(data); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	for _, alg := range []int64{AlgES256, AlgEdDSA} {
+		a := newSoftAuthenticator(t, alg)
+		key, err := ParsePublicKey(a.coseKey())
+		if err != nil {
+			t.Fatalf("alg %d: %v", alg, err)
+		}
+		if key.Algorithm != alg {
+			t.Fatalf("algorithm = %d, want %d", key.Algorithm, alg)
+		}
+		data := []byte("signed data")
+		if err := key.Verify(data, a.sign(t, data)); err != nil {
+			t.Fatalf("alg %d: verify: %v", alg, err)
+		}
+		if err := key.Verify([]byte("other data"), a.sign(t, data)); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("alg %d: verify tampered data: %v", alg, err)
+		}
+		if _, err := ParsePublicKey(append(a.coseKey(), 0x00)); err == nil {
+			t.Fatalf("alg %d: expected error for trailing data", alg)
+		}
+	}
+
+	// 不在曲线上的点
+	offCurve := encodeCBOR(cborMap{
+		int64(coseKeyType): int64(coseKeyTypeEC2), int64(coseAlgorithm): AlgES256,
+		int64(coseCurve): int64(coseCurveP256), int64(coseX): make([]byte, 32), int64(coseY): make([]byte, 32),
+	})
+	if _, err := ParsePublicKey(offCurve); err == nil {
+		t.Fatal("expected error for point not on curve")
+	}
+	// EC2 密钥声明为 EdDSA
+	mismatched := encodeCBOR(cborMap{
+		int64(coseKeyType): int64(coseKeyTypeEC2), int64(coseAlgorithm): AlgEdDSA,
+		int64(coseCurve): int64(coseCurveP256), int64(coseX): make([]byte, 32), int64(coseY): make([]byte, 32),
+	})
+	if _, err := ParsePublicKey(mismatched); err == nil {
+		t.Fatal("expected error for mismatched key type and algorithm")
+	}
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	rp := testRP()
+	for _, alg := range []int64{AlgES256, AlgEdDSA} {
+		for _, format := range []string{"none", "packed"} {
+			a := newSoftAuthenticator(t, alg)
+			challenge := newTestChallenge(t)
+			cred, err := rp.VerifyRegistration(a.register(t, challenge, format), challenge, true)
+			if err != nil {
+				t.Fatalf("alg %d %s: %v", alg, format, err)
+			}
+			if !bytes.Equal(cred.ID, a.credentialID) || cred.Algorithm != alg || cred.SignCount != 0 {
+				t.Fatalf("alg %d %s: unexpected credential %+v", alg, format, cred)
+			}
+			if !bytes.Equal(cred.PublicKey, a.coseKey()) {
+				t.Fatalf("alg %d %s: public key not stored as COSE", alg, format)
+			}
+		}
+	}
+}
+
+func TestVerifyRegistrationRejects(t *testing.T) {
+	rp := testRP()
+	tests := []struct {
+		name      string
+		modify    func(a *softAuthenticator)
+		tamper    func(resp *AttestationResponse)
+		challenge func(challenge Bytes) Bytes
+		requireUV bool
+		want      error
+	}{
+		{
+			name:      "challenge mismatch",
+			challenge: func(Bytes) Bytes { return Bytes("another challenge") },
+			want:      ErrChallengeMismatch,
+		},
+		{
+			name:   "origin not allowed",
+			modify: func(a *softAuthenticator) { a.origin = "https://evil.example" },
+			want:   ErrOriginNotAllowed,
+		},
+		{
+			name:   "rp id hash mismatch",
+			modify: func(a *softAuthenticator) { a.rpID = "evil.example" },
+		},
+		{
+			name:   "user not present",
+			modify: func(a *softAuthenticator) { a.flags = flagUserVerified },
+		},
+		{
+			name:      "user not verified",
+			modify:    func(a *softAuthenticator) { a.flags = flagUserPresent },
+			requireUV: true,
+			want:      ErrUserNotVerified,
+		},
+		{
+			name: "bad packed signature",
+			tamper: func(resp *AttestationResponse) {
+				// 挑战与来源不变，但 clientDataJSON 的哈希改变
+				var cd map[string]any
+				_ = json.Unmarshal(resp.Response.ClientDataJSON, &cd)
+				cd["extra"] = "x"
+				resp.Response.ClientDataJSON, _ = json.Marshal(cd)
+			},
+			want: ErrInvalidSignature,
+		},
+		{
+			name:   "raw id mismatch",
+			tamper: func(resp *AttestationResponse) { resp.RawID = []byte("other id") },
+		},
+		{
+			name:   "wrong ceremony type",
+			tamper: func(resp *AttestationResponse) { resp.Type = "password" },
+		},
+		{
+			name:   "malformed attestation object",
+			tamper: func(resp *AttestationResponse) { resp.Response.AttestationObject = []byte{0xa1, 0x63} },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newSoftAuthenticator(t, AlgES256)
+			if tt.modify != nil {
+				tt.modify(a)
+			}
+			challenge := newTestChallenge(t)
+			resp := a.register(t, challenge, "packed")
+			if tt.tamper != nil {
+				tt.tamper(resp)
+			}
+			if tt.challenge != nil {
+				challenge = tt.challenge(challenge)
+			}
+			_, err := rp.VerifyRegistration(resp, challenge, tt.requireUV)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	rp := testRP()
+	for _, alg := range []int64{AlgES256, AlgEdDSA} {
+		a := newSoftAuthenticator(t, alg)
+		challenge := newTestChallenge(t)
+		cred, err := rp.VerifyRegistration(a.register(t, challenge, "none"), challenge, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored := cred.SignCount
+		for i := 0; i < 3; i++ {
+			challenge := newTestChallenge(t)
+			ad, err := rp.VerifyAssertion(a.login(t, challenge), challenge, cred.PublicKey, stored, true)
+			if err != nil {
+				t.Fatalf("alg %d login %d: %v", alg, i, err)
+			}
+			if ad.SignCount <= stored {
+				t.Fatalf("sign count %d did not increase from %d", ad.SignCount, stored)
+			}
+			stored = ad.SignCount
+		}
+	}
+}
+
+func TestVerifyAssertionSignCount(t *testing.T) {
+	rp := testRP()
+	a := newSoftAuthenticator(t, AlgES256)
+	key := a.coseKey()
+	tests := []struct {
+		name   string
+		count  uint32
+		stored uint32
+		want   error
+	}{
+		{name: "increasing", count: 10, stored: 10},
+		{name: "regressed", count: 3, stored: 10, want: ErrSignCount},
+		{name: "repeated", count: 9, stored: 10, want: ErrSignCount},
+		{name: "reset to zero", count: 0, stored: 10, want: ErrSignCount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// login 会先把计数加一
+			a.signCount = tt.count
+			a.noCounter = tt.count == 0
+			challenge := newTestChallenge(t)
+			_, err := rp.VerifyAssertion(a.login(t, challenge), challenge, key, tt.stored, false)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// 不支持计数的认证器始终为 0，可以重复登录
+	a.signCount = 0
+	a.noCounter = true
+	for i := 0; i < 2; i++ {
+		challenge := newTestChallenge(t)
+		ad, err := rp.VerifyAssertion(a.login(t, challenge), challenge, key, 0, false)
+		if err != nil {
+			t.Fatalf("zero counter: %v", err)
+		}
+		if ad.SignCount != 0 {
+			t.Fatalf("sign count = %d, want 0", ad.SignCount)
+		}
+	}
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	rp := testRP()
+	tests := []struct {
+		name      string
+		modify    func(a *softAuthenticator)
+		tamper    func(resp *AssertionResponse)
+		challenge func(challenge Bytes) Bytes
+		requireUV bool
+		want      error
+	}{
+		{
+			name:      "challenge mismatch",
+			challenge: func(Bytes) Bytes { return Bytes("another challenge") },
+			want:      ErrChallengeMismatch,
+		},
+		{
+			name:   "origin not allowed",
+			modify: func(a *softAuthenticator) { a.origin = "https://example.com.evil.example" },
+			want:   ErrOriginNotAllowed,
+		},
+		{
+			name:   "rp id hash mismatch",
+			modify: func(a *softAuthenticator) { a.rpID = "evil.example" },
+		},
+		{
+			name:   "user not present",
+			modify: func(a *softAuthenticator) { a.flags = flagUserVerified },
+		},
+		{
+			name:      "user not verified",
+			modify:    func(a *softAuthenticator) { a.flags = flagUserPresent },
+			requireUV: true,
+			want:      ErrUserNotVerified,
+		},
+		{
+			name:   "bad signature",
+			tamper: func(resp *AssertionResponse) { resp.Response.Signature[len(resp.Response.Signature)-1] ^= 0xff },
+			want:   ErrInvalidSignature,
+		},
+		{
+			name: "registration client data",
+			tamper: func(resp *AssertionResponse) {
+				resp.Response.ClientDataJSON = bytes.Replace(resp.Response.ClientDataJSON, []byte("webauthn.get"), []byte("webauthn.create"), 1)
+			},
+		},
+		{
+			name:   "truncated authenticator data",
+			tamper: func(resp *AssertionResponse) { resp.Response.AuthenticatorData = resp.Response.AuthenticatorData[:36] },
+		},
+		{
+			name: "trailing authenticator data",
+			tamper: func(resp *AssertionResponse) {
+				resp.Response.AuthenticatorData = append(resp.Response.AuthenticatorData, 0)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := newSoftAuthenticator(t, AlgES256)
+			key := a.coseKey()
+			if tt.modify != nil {
+				tt.modify(a)
+			}
+			challenge := newTestChallenge(t)
+			resp := a.login(t, challenge)
+			if tt.tamper != nil {
+				tt.tamper(resp)
+			}
+			if tt.challenge != nil {
+				challenge = tt.challenge(challenge)
+			}
+			_, err := rp.VerifyAssertion(resp, challenge, key, 0, tt.requireUV)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// 使用另一把密钥签名的响应
+	a := newSoftAuthenticator(t, AlgES256)
+	other := newSoftAuthenticator(t, AlgES256)
+	challenge := newTestChallenge(t)
+	if _, err := rp.VerifyAssertion(other.login(t, challenge), challenge, a.coseKey(), 0, false); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("wrong key: err = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestBytesJSON(t *testing.T) {
+	in := Bytes{0xfb, 0xff, 0x00}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `"-_8A"` {
+		t.Fatalf("marshal = %s", data)
+	}
+	for _, s := range []string{`"-_8A"`, `"+/8A"`} {
+		var out Bytes
+		if err := json.Unmarshal([]byte(s), &out); err != nil || !bytes.Equal(out, in) {
+			t.Fatalf("unmarshal %s = %x, %v", s, out, err)
+		}
+	}
+}
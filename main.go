@@ -2,37 +2,90 @@ package main
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"goauthx/internal/command"
+	"goauthx/internal/config"
 	"goauthx/internal/web"
+	"golang.org/x/term"
+	"io"
 	"log"
 	"os"
 	"strings"
 )
 
 func main() {
-	// 启动命令行监听协程
-	go func() {
-		reader := bufio.NewReader(os.Stdin)
-		for {
-			fmt.Print("> ")
-			input, err := reader.ReadString('\n')
-			if err != nil {
-				log.Printf("读取命令失败: %v", err)
-				continue
-			}
-			input = strings.TrimSpace(input)
-			if input == "" {
-				continue
-			}
-			if err := command.ParseAndExecute(input); err != nil {
-				log.Printf("命令执行错误: %v", err)
-			}
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "serve":
+		case "ctl":
+			os.Exit(runCtl(os.Args[2:]))
+		case "exec":
+			os.Exit(runExec(os.Args[2:]))
+		case "run":
+			os.Exit(runScript(os.Args[2:]))
+		case "help", "-h", "--help":
+			printUsage(os.Stdout)
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "unknown mode: %s\n", os.Args[1])
+			printUsage(os.Stderr)
+			os.Exit(exitUsage)
 		}
-	}()
+	}
+	serve()
+}
+
+// serve 启动 HTTP 服务与控制台
+func serve() {
+	// 远程控制台，供 goauthx ctl 连接
+	if path := config.GetConfig().Console.SocketPath; path != "" {
+		go func() {
+			if err := command.ServeSocket(path); err != nil {
+				log.Printf("远程控制台启动失败: %v", err)
+			}
+		}()
+	}
+	// 启动命令行监听协程
+	go runConsole()
 
 	err := web.StartServer()
 	if err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
+
+// runConsole 从标准输入读取命令，标准输入关闭时（如 systemd、Docker 下运行）退出
+// 控制台退出后服务继续运行，不会中断正在处理的请求
+func runConsole() {
+	// 终端中支持行编辑、历史记录与 Tab 补全，Ctrl-C / Ctrl-D 退出控制台
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		err := command.RunTerminal(os.Stdin, os.Stdout, command.Run)
+		if err != nil && !errors.Is(err, io.EOF) {
+			log.Printf("控制台错误，控制台退出: %v", err)
+			return
+		}
+		log.Printf("控制台已退出，服务继续运行，可以使用 goauthx ctl 连接远程控制台，再次按 Ctrl-C 停止服务")
+		return
+	}
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print("> ")
+		input, err := reader.ReadString('\n')
+		if err != nil && (!errors.Is(err, io.EOF) || input == "") {
+			if errors.Is(err, io.EOF) {
+				log.Printf("标准输入已关闭，控制台退出，可以使用 goauthx ctl 连接远程控制台")
+			} else {
+				log.Printf("读取命令失败，控制台退出: %v", err)
+			}
+			return
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+		if err := command.ParseAndExecute(input); err != nil {
+			log.Printf("命令执行错误: %v", err)
+		}
+	}
+}